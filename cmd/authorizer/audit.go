@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"authorizer/internal/app/audit"
+)
+
+// auditFlags registers the flags of "audit verify <audit-log>"
+func auditFlags(*flag.FlagSet) func(c *cli, args []string) int {
+	return verifyAudit
+}
+
+// verifyAudit executes the subcommand "audit verify <audit-log>" and returns the exit code
+func verifyAudit(c *cli, args []string) int {
+	if len(args) != 2 || args[0] != "verify" {
+		return c.usageError("audit", "usage: authorizer audit verify <audit-log>")
+	}
+
+	records, err := audit.Verify(args[1])
+	if err != nil {
+		fmt.Fprintf(c.stderr, "audit log is not valid after %d records: %v\n", records, err)
+
+		return exitFailure
+	}
+
+	fmt.Fprintf(c.stdout, "audit log is valid, %d records\n", records)
+
+	return exitOK
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	cmd2 "authorizer/internal/root"
+	"flag"
+	"fmt"
+	"os"
+
+	"authorizer/internal/app/service"
+	"authorizer/internal/app/storage"
+	"authorizer/internal/root/evaluation"
+	"authorizer/internal/root/reader"
+	"authorizer/internal/root/writer"
+)
+
+// evaluateCommand executes a labeled input and compares the decisions with the labels
+type evaluateCommand struct {
+	format string
+}
+
+// evaluateFlags registers the flags of "evaluate [file]", the file is read from the stdin when it is omitted or "-".
+// The input is ndjson with the label of every transaction, as written by generate
+func evaluateFlags(fs *flag.FlagSet) func(c *cli, args []string) int {
+	e := &evaluateCommand{}
+	fs.StringVar(&e.format, "format", "table", "format of the evaluation: table or json")
+
+	return e.run
+}
+
+func (e *evaluateCommand) run(c *cli, args []string) int {
+	if len(args) > 1 {
+		return c.usageError("evaluate", "usage: authorizer evaluate [flags] [file]")
+	}
+
+	if e.format != "table" && e.format != "json" {
+		return c.usageError("evaluate", "unknown evaluation format %q, it must be table or json", e.format)
+	}
+
+	rulesStore, logCloser, err := c.setup()
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+
+		return exitFailure
+	}
+	defer logCloser.Close()
+
+	r := c.stdin
+
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return c.failure("error opening input: %v", err)
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	// every transaction is explained, so every rule is evaluated even after a violation
+	svc := service.New(&storage.InMemory{}, service.WithRulesStore(rulesStore), service.WithExplain(true))
+	result := evaluation.New()
+
+	err = cmd2.Execute(svc, r, c.stdout,
+		cmd2.WithInputFormat(result.Format(reader.NDJSON)),
+		cmd2.WithOutputFormat(result.Output, writer.Fields{}))
+	if err != nil {
+		return c.failure("%v", err)
+	}
+
+	if err = result.Write(c.stdout, e.format); err != nil {
+		return c.failure("error writing evaluation: %v", err)
+	}
+
+	return exitOK
+}
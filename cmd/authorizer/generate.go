@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"authorizer/internal/root/workload"
+)
+
+// generateCommand writes a synthetic workload with labeled fraud patterns
+type generateCommand struct {
+	config workload.Config
+	start  string
+	output string
+}
+
+// generateFlags registers the flags of "generate", every flag has the value of workload.DefaultConfig by default
+func generateFlags(fs *flag.FlagSet) func(c *cli, args []string) int {
+	g := &generateCommand{config: workload.DefaultConfig()}
+	cfg := &g.config
+
+	fs.Int64Var(&cfg.Seed, "seed", cfg.Seed, "seed of the random numbers, the same seed generates the same workload")
+	fs.IntVar(&cfg.Accounts, "accounts", cfg.Accounts, "number of accounts")
+	fs.IntVar(&cfg.Transactions, "transactions", cfg.Transactions,
+		"legitimate transactions of every account, the fraud is added to them")
+	fs.StringVar(&g.start, "start", cfg.Start.Format(time.RFC3339), "time of the beginning of the workload")
+	fs.Float64Var(&cfg.Rate, "rate", cfg.Rate, "mean legitimate transactions per hour of every account")
+	fs.IntVar(&cfg.Limit, "limit", cfg.Limit, "available limit of every account")
+	fs.IntVar(&cfg.Merchants, "merchants", cfg.Merchants, "number of merchants")
+	fs.Float64Var(&cfg.MerchantSkew, "merchant-skew", cfg.MerchantSkew,
+		"zipf exponent of the merchants, greater than 1 concentrates the transactions, otherwise they are uniform")
+	fs.IntVar(&cfg.AmountMedian, "amount-median", cfg.AmountMedian, "median of the log-normal amounts")
+	fs.Float64Var(&cfg.AmountSpread, "amount-spread", cfg.AmountSpread, "sigma of the log-normal amounts")
+	fs.Float64Var(&cfg.Doubles, "doubles", cfg.Doubles, "probability that a transaction is doubled")
+	fs.Float64Var(&cfg.Bursts, "bursts", cfg.Bursts, "probability that a transaction is followed by a burst")
+	fs.Float64Var(&cfg.CardTesting, "card-testing", cfg.CardTesting,
+		"probability that a transaction is followed by a card-testing attack")
+	fs.StringVar(&g.output, "output", "-", "file of the workload, - is the stdout")
+
+	return g.run
+}
+
+func (g *generateCommand) run(c *cli, args []string) int {
+	if len(args) > 0 {
+		return c.usageError("generate", "generate doesn't accept arguments")
+	}
+
+	start, err := time.Parse(time.RFC3339, g.start)
+	if err != nil {
+		return c.usageError("generate", "invalid start: %v", err)
+	}
+
+	g.config.Start = start.UTC()
+
+	if err = g.config.Validate(); err != nil {
+		return c.usageError("generate", "%v", err)
+	}
+
+	var w io.Writer = c.stdout
+
+	if g.output != "-" {
+		f, err := os.Create(g.output)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "error creating output: %v\n", err)
+
+			return exitFailure
+		}
+		defer f.Close()
+
+		w = f
+	}
+
+	summary, err := workload.Generate(w, g.config)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "error writing workload: %v\n", err)
+
+		return exitFailure
+	}
+
+	fmt.Fprintf(c.stderr, "%d accounts, %d transactions, %d fraudulent, %d labeled to be declined\n",
+		summary.Accounts, summary.Transactions, summary.Fraud, summary.Declines)
+
+	patterns := make([]string, 0, len(summary.Patterns))
+	for pattern := range summary.Patterns {
+		patterns = append(patterns, pattern)
+	}
+
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		fmt.Fprintf(c.stderr, "  %s: %d\n", pattern, summary.Patterns[pattern])
+	}
+
+	return exitOK
+}
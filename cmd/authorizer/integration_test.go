@@ -13,6 +13,7 @@ import (
 
 	"authorizer/internal/app/service"
 	"authorizer/internal/app/storage"
+	"authorizer/internal/root/reader"
 )
 
 func TestIntegration(t *testing.T) {
@@ -20,18 +21,54 @@ func TestIntegration(t *testing.T) {
 		name   string
 		writer *bytes.Buffer
 		db     service.Storage
+		opts   []cmd2.Option
 	}{
 		{"run",
 			new(bytes.Buffer),
 			&storage.InMemory{},
+			nil,
 		},
 		{"simple-run",
 			new(bytes.Buffer),
 			&storage.InMemory{},
+			nil,
 		},
 		{"double-creation",
 			new(bytes.Buffer),
 			&storage.InMemory{},
+			nil,
+		},
+		{"geolocation",
+			new(bytes.Buffer),
+			&storage.InMemory{},
+			nil,
+		},
+		{"rule-settings",
+			new(bytes.Buffer),
+			&storage.InMemory{},
+			nil,
+		},
+		{"credit-line",
+			new(bytes.Buffer),
+			&storage.InMemory{},
+			nil,
+		},
+		{"multiple-accounts",
+			new(bytes.Buffer),
+			&storage.InMemory{},
+			nil,
+		},
+		{"csv-run",
+			new(bytes.Buffer),
+			&storage.InMemory{},
+			[]cmd2.Option{cmd2.WithInputFormat(reader.CSV(map[string]string{
+				"TYPE":          reader.FieldOperation,
+				"ACTIVE":        reader.FieldActiveCard,
+				"LIMIT":         reader.FieldAvailableLimit,
+				"MERCHANT_NAME": reader.FieldMerchant,
+				"AMT":           reader.FieldAmount,
+				"TX_TIME":       reader.FieldTime,
+			}))},
 		},
 	}
 
@@ -44,7 +81,7 @@ func TestIntegration(t *testing.T) {
 				assert.NoError(t, err)
 			}
 
-			cmd2.Execute(service, input, tt.writer)
+			cmd2.Execute(service, input, tt.writer, tt.opts...)
 
 			expected, err := ioutil.ReadFile("testdata/" + tt.name + ".out")
 			if err != nil {
@@ -1,42 +1,328 @@
 package main
 
 import (
-	cmd2 "authorizer/internal/root"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
-	"authorizer/internal/app/service"
-	"authorizer/internal/app/storage"
+	log "github.com/sirupsen/logrus"
+
+	"authorizer/internal/app/service/rules"
+	"authorizer/internal/common/config"
 	"authorizer/internal/common/logfile"
 )
 
+// Exit codes of the commands
+const (
+	exitOK      = 0
+	exitFailure = 1
+	// exitUsage is returned when the command line is not valid
+	exitUsage = 2
+)
+
 func main() {
-	logfile.Init()
+	c := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
 
-	// simple flow to respond to common arguments
-	if len(os.Args) > 1 {
-		switch os.Args[1:][0] {
-		case "version":
-			fmt.Println("v1.0")
+	os.Exit(c.execute(os.Args[1:]))
+}
 
-		case "help":
-			fmt.Println("send file with transactions to stdin")
+// cli contains the streams used by the commands and the global flags
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	global globalFlags
+}
+
+// command is a subcommand of the cli
+type command struct {
+	name string
+	// args is the usage of the positional arguments
+	args    string
+	summary string
+	// flags registers the flags of the command and returns the function that runs it with the positional arguments
+	flags func(fs *flag.FlagSet) func(c *cli, args []string) int
+}
+
+func commands() []command {
+	return []command{
+		{"run", "", "process the operations of the stdin and write the responses to the stdout", runFlags},
+		{"serve", "", "receive the operations in POST /operations and expose GET /metrics", serveFlags},
+		{"replay", "<audit-log>", "execute the inputs of an audit log again and report the decisions that changed",
+			replayFlags},
+		{"repl", "", "execute the operations and the commands typed by an operator in an interactive session",
+			replFlags},
+		{"validate", "[file]", "parse the operations of a file, or the stdin, and report the lines that can't be executed",
+			validateFlags},
+		{"generate", "", "write a synthetic workload with labeled fraud patterns as ndjson", generateFlags},
+		{"evaluate", "[file]", "execute a labeled input and report the precision and recall of every rule",
+			evaluateFlags},
+		{"statement", "[file]", "execute the operations of a file, or the stdin, and write the statements of an account",
+			statementFlags},
+		{"snapshot", "export|import <file>", "process the stdin and then export the state to the file, " +
+			"or import it before the stdin", snapshotFlags},
+		{"audit", "verify <audit-log>", "verify that the audit log was not modified, truncated or reordered", auditFlags},
+		{"version", "", "print the version, the commit and the build date", versionFlags},
+		{"help", "[command]", "print the usage of the cli or of a command", nil},
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd, true
 		}
+	}
+
+	return command{}, false
+}
+
+// globalFlags are accepted before the command and by every command
+type globalFlags struct {
+	config        string
+	log           logfile.Config
+	rules         string
+	rulesInterval time.Duration
+	explain       bool
+}
+
+func (g *globalFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.config, "config", "", "json file with the value of any flag by name: {\"log-level\": \"info\"}")
+	fs.StringVar(&g.log.Level, "log-level", g.log.Level, "log level: debug, info, warning or error")
+	fs.StringVar(&g.log.Format, "log-format", g.log.Format, "log format: text or json")
+	fs.StringVar(&g.log.Path, "log-path", g.log.Path, "log file, or stderr")
+	fs.Int64Var(&g.log.MaxSize, "log-max-size", g.log.MaxSize, "rotate the log file after this many bytes")
+	fs.DurationVar(&g.log.MaxAge, "log-max-age", g.log.MaxAge, "rotate the log file after this period")
+	fs.IntVar(&g.log.MaxBackups, "log-max-backups", g.log.MaxBackups,
+		"number of rotated log files kept, 0 keeps all of them")
+	fs.StringVar(&g.rules, "rules", "", "json file with the configuration of the business rules")
+	fs.DurationVar(&g.rulesInterval, "rules-interval", 5*time.Second,
+		"how often the rules file is checked for changes, it is also reloaded on SIGHUP")
+	fs.BoolVar(&g.explain, "explain", false, "add the result of every business rule to the transaction responses")
+}
+
+// execute runs the command of the arguments and returns the exit code:
+// authorizer [global flags] [command] [flags] [arguments], the command is run when it is omitted
+func (c *cli) execute(args []string) int {
+	c.global = globalFlags{log: logfile.DefaultConfig()}
+
+	// the flags of run are also accepted before the command because it is run when the command is omitted
+	global := c.newFlagSet("authorizer")
+	c.global.register(global)
+	runFlags(global)
+	global.Usage = func() { c.usage(c.stderr) }
+
+	if err := global.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+
+	name, args := "run", global.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		return c.help(args)
+	}
+
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(c.stderr, "unknown command %q\n\n", name)
+		c.usage(c.stderr)
+
+		return exitUsage
+	}
+
+	// the values are kept before the command registers its flags, registering a flag resets its variable
+	values := config.Values{}
+
+	global.Visit(func(f *flag.Flag) {
+		values[f.Name] = f.Value.String()
+	})
+
+	// the global flags are also registered in the command, so they can be written after it
+	fs := c.newFlagSet("authorizer " + cmd.name)
+	c.global.register(fs)
+	runCommand := cmd.flags(fs)
+	fs.Usage = func() { c.commandUsage(c.stderr, cmd) }
 
-		os.Exit(0)
+	if unknown := values.Unknown(fs); len(unknown) > 0 {
+		return c.usageError(cmd.name, "%s doesn't accept -%s", cmd.name, strings.Join(unknown, ", -"))
 	}
 
-	// Initialize DB
-	db := storage.InMemory{}
+	if err := config.Apply(fs, values, "command line"); err != nil {
+		fmt.Fprintln(c.stderr, err)
 
-	// Initialize service
-	svc := service.New(&db)
+		return exitUsage
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+
+	if err := c.configure(fs); err != nil {
+		fmt.Fprintln(c.stderr, err)
+
+		return exitUsage
+	}
+
+	return runCommand(c, fs.Args())
+}
+
+// configure sets the flags that were not set in the command line with the environment and then with the config file
+func (c *cli) configure(fs *flag.FlagSet) error {
+	if err := config.Apply(fs, config.FromEnv(fs), "environment"); err != nil {
+		return err
+	}
+
+	if c.global.config == "" {
+		return nil
+	}
+
+	values, err := config.Load(c.global.config)
+	if err != nil {
+		return err
+	}
+
+	// the config file is shared by all the commands, so it can contain the flags of any of them
+	sets := []*flag.FlagSet{fs}
+
+	for _, cmd := range commands() {
+		if cmd.flags != nil {
+			other := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+			cmd.flags(other)
+			sets = append(sets, other)
+		}
+	}
 
-	// Get input from stdin
-	stdin := os.Stdin
-	// Return output to stdout
-	stdout := os.Stdout
+	if unknown := values.Unknown(sets...); len(unknown) > 0 {
+		return fmt.Errorf("unknown flags in config file %s: %s", c.global.config, strings.Join(unknown, ", "))
+	}
+
+	return config.Apply(fs, values, "config file "+c.global.config)
+}
+
+func (c *cli) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+
+	return fs
+}
+
+// parseExitCode is the exit code of an error parsing the flags, the usage was already written by the flag set
+func parseExitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+
+	return exitUsage
+}
+
+// help executes "help [command]"
+func (c *cli) help(args []string) int {
+	if len(args) == 0 {
+		c.usage(c.stdout)
+
+		return exitOK
+	}
+
+	cmd, ok := findCommand(args[0])
+	if len(args) > 1 || !ok || cmd.flags == nil {
+		fmt.Fprintf(c.stderr, "usage: authorizer help [command]\nRun 'authorizer help' for the commands.\n")
+
+		return exitUsage
+	}
+
+	c.commandUsage(c.stdout, cmd)
+
+	return exitOK
+}
+
+// usage writes the commands and the global flags
+func (c *cli) usage(w io.Writer) {
+	fmt.Fprint(w, "Usage: authorizer [flags] [command] [command flags] [arguments]\n\nCommands:\n")
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands() {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.summary)
+	}
+
+	tw.Flush()
+
+	fmt.Fprint(w, "\nWithout a command the operations of the stdin are processed as with run.\n\nFlags:\n")
+
+	global := flag.NewFlagSet("authorizer", flag.ContinueOnError)
+	(&globalFlags{log: logfile.DefaultConfig()}).register(global)
+	global.SetOutput(w)
+	global.PrintDefaults()
+
+	fmt.Fprintf(w, "\nThe flags can be written before or after the command. Every flag can also be set with "+
+		"an environment variable\nlike %s for -log-level, or in the config file. The command line has "+
+		"precedence over the\nenvironment and the environment over the config file.\n", config.EnvName("log-level"))
+}
+
+// commandUsage writes the arguments and the flags of the command, the global flags are only written by usage
+func (c *cli) commandUsage(w io.Writer, cmd command) {
+	fmt.Fprintf(w, "Usage: %s\n\n%s.\n", strings.TrimSpace("authorizer "+cmd.name+" [flags] "+cmd.args),
+		strings.ToUpper(cmd.summary[:1])+cmd.summary[1:])
+
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(w)
+	cmd.flags(fs)
+
+	hasFlags := false
+
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+
+	if hasFlags {
+		fmt.Fprint(w, "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	fmt.Fprint(w, "\nRun 'authorizer help' for the global flags.\n")
+}
+
+// usageError writes the error and how to get the usage of the command, it returns exitUsage
+func (c *cli) usageError(name string, format string, a ...interface{}) int {
+	fmt.Fprintf(c.stderr, format+"\n", a...)
+	fmt.Fprintf(c.stderr, "Run 'authorizer help %s' for usage.\n", name)
+
+	return exitUsage
+}
+
+// failure writes the error of a command that was run, it returns exitFailure
+func (c *cli) failure(format string, a ...interface{}) int {
+	log.Errorf(format, a...)
+	fmt.Fprintf(c.stderr, format+"\n", a...)
+
+	return exitFailure
+}
+
+// setup initializes the log and loads the rules of the commands that process operations,
+// the rules file is watched while the command runs. The closer returned closes the log
+func (c *cli) setup() (*rules.Store, io.Closer, error) {
+	logCloser, err := logfile.Init(c.global.log)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error initializing log: %w", err)
+	}
+
+	rulesStore := rules.NewStore(rules.DefaultConfig())
+
+	if c.global.rules != "" {
+		if err = rulesStore.Reload(c.global.rules); err != nil {
+			logCloser.Close()
+
+			return nil, nil, fmt.Errorf("error loading rules config: %w", err)
+		}
+
+		go rulesStore.Watch(context.Background(), c.global.rules, c.global.rulesInterval)
+	}
 
-	// Execute application
-	cmd2.Execute(svc, stdin, stdout)
+	return rulesStore, logCloser, nil
 }
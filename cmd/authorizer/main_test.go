@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCLI(stdin string) (*cli, *bytes.Buffer, *bytes.Buffer) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+
+	return &cli{stdin: strings.NewReader(stdin), stdout: stdout, stderr: stderr}, stdout, stderr
+}
+
+func TestCli_execute(t *testing.T) {
+	defer log.SetOutput(os.Stderr)
+
+	input, err := ioutil.ReadFile("testdata/run.in")
+	assert.NoError(t, err)
+
+	expected, err := ioutil.ReadFile("testdata/run.out")
+	assert.NoError(t, err)
+
+	quiet := []string{"-log-path", "stderr", "-log-level", "error"}
+
+	tests := []struct {
+		name       string
+		args       []string
+		want       int
+		wantStdout string
+		wantStderr string
+	}{
+		{"defaultCommand", quiet, exitOK, string(expected), ""},
+		{"run", append([]string{"run"}, quiet...), exitOK, string(expected), ""},
+		{"globalFlagsBeforeCommand", append(quiet, "run"), exitOK, string(expected), ""},
+		{"metricsSummary", append([]string{"run", "-metrics-summary"}, quiet...), exitOK, string(expected),
+			`authorizer_operations_total{operation="transaction",outcome="approved"}`},
+		{"version", []string{"version"}, exitOK, "authorizer dev (commit unknown, built unknown", ""},
+		{"versionShort", []string{"version", "-short"}, exitOK, "dev\n", ""},
+		{"help", []string{"help"}, exitOK, "Usage: authorizer [flags] [command]", ""},
+		{"helpCommand", []string{"help", "replay"}, exitOK, "Usage: authorizer replay [flags] <audit-log>", ""},
+		{"helpFlag", []string{"run", "-h"}, exitOK, "", "Usage: authorizer run [flags]"},
+		{"unknownCommand", []string{"rnu"}, exitUsage, "", `unknown command "rnu"`},
+		{"unknownFlag", []string{"version", "-verbose"}, exitUsage, "", "flag provided but not defined: -verbose"},
+		{"flagOfOtherCommand", []string{"-report", "stderr", "serve"}, exitUsage, "", "serve doesn't accept -report"},
+		{"unexpectedArgument", []string{"run", "operations"}, exitUsage, "", "run doesn't accept arguments"},
+		{"missingArgument", []string{"replay"}, exitUsage, "", "usage: authorizer replay"},
+		{"invalidFormat", append([]string{"run", "-input-format", "xml"}, quiet...), exitUsage, "", "xml"},
+		{"generate", []string{"generate", "-transactions", "1", "-doubles", "0", "-bursts", "0", "-card-testing", "0"},
+			exitOK, `{"account":{"activeCard":true,"availableLimit":100000},"accountId":1}` + "\n", ""},
+		{"invalidGenerate", []string{"generate", "-doubles", "2"}, exitUsage, "", "doubles must be a probability"},
+		{"evaluate", []string{"evaluate", "-log-path", "stderr", "-log-level", "fatal"}, exitOK,
+			"         tp  fp  fn  tn  precision  recall\noverall  0   0   0   0   0.000      0.000", ""},
+		{"invalidEvaluateFormat", []string{"evaluate", "-format", "csv"}, exitUsage, "", "unknown evaluation format"},
+		{"statement", []string{"statement", "-log-path", "stderr", "-log-level", "fatal", "-format", "csv",
+			"-from", "2019-01-01T00:00:00Z", "-to", "2019-03-01T00:00:00Z", "-period", "month"}, exitOK,
+			"accountId,from,to,entry,time,merchant,amount,availableLimit\n" +
+				"1,2019-01-01T00:00:00Z,2019-02-01T00:00:00Z,opening,,,,600\n", ""},
+		{"statementWithoutRange", []string{"statement", "-from", "2019-01-01T00:00:00Z"}, exitUsage, "",
+			"-from and -to are required"},
+		{"statementUnknownAccount", []string{"statement", "-log-path", "stderr", "-log-level", "fatal",
+			"-account", "2", "-from", "2019-01-01T00:00:00Z", "-to", "2019-03-01T00:00:00Z"}, exitFailure, "",
+			"account 2: account not found"},
+		{"shortHorizon", []string{"serve", "-history-horizon", "1m", "-log-path", "stderr", "-log-level", "fatal"},
+			exitUsage, "", "-history-horizon 1m0s is shorter than the window of the rules 10m0s"},
+		{"auditWithoutVerify", []string{"audit", "check", "audit.log"}, exitUsage, "", "usage: authorizer audit"},
+		{"snapshotWithoutFile", []string{"snapshot", "export"}, exitUsage, "", "usage: authorizer snapshot"},
+		{"snapshotUnknownSubcommand", []string{"snapshot", "save", "state.json"}, exitUsage, "",
+			"usage: authorizer snapshot"},
+		{"snapshotFlagOfRun", []string{"snapshot", "-snapshot-export", "state.json", "export", "state.json"},
+			exitUsage, "", "flag provided but not defined: -snapshot-export"},
+		{"snapshotMissingFile", append(append([]string{"snapshot"}, quiet...), "import", "missing.json"), exitFailure, "",
+			"error importing snapshot"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c, stdout, stderr := newTestCLI(string(input))
+
+			assert.Equal(t, tt.want, c.execute(tt.args))
+			assert.True(t, strings.HasPrefix(stdout.String(), tt.wantStdout), stdout.String())
+			assert.Contains(t, stderr.String(), tt.wantStderr)
+		})
+	}
+}
+
+func TestCli_configure(t *testing.T) {
+	defer log.SetOutput(os.Stderr)
+
+	path := filepath.Join(t.TempDir(), "authorizer.json")
+	content := `{"log-path": "stderr", "log-level": "error", "metrics-summary": false, "output-format": "csv",
+		"listen": ":9090"}`
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	t.Setenv("AUTHORIZER_OUTPUT_FIELDS", "line")
+
+	input := `{"account": {"activeCard": true, "availableLimit": 100}}` + "\n"
+
+	// the config file sets the format, the environment the fields and the command line has precedence over both
+	c, stdout, _ := newTestCLI(input)
+	assert.Equal(t, exitOK, c.execute([]string{"-config", path}))
+	assert.Equal(t, "line,activeCard,availableLimit,violations,ruleSetVersion\n1,true,100,,\n", stdout.String())
+
+	c, stdout, _ = newTestCLI(input)
+	assert.Equal(t, exitOK, c.execute([]string{"-config", path, "run", "-output-format", "ndjson"}))
+	assert.Equal(t, `{"line":1,"account":{"activeCard":true,"availableLimit":100},"violations":[]}`+"\n",
+		stdout.String())
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"lisen": ":9090"}`), 0600))
+
+	c, _, stderr := newTestCLI(input)
+	assert.Equal(t, exitUsage, c.execute([]string{"version", "-config", path}))
+	assert.Contains(t, stderr.String(), "unknown flags in config file")
+
+	t.Setenv("AUTHORIZER_EXPLAIN", "maybe")
+
+	c, _, stderr = newTestCLI(input)
+	assert.Equal(t, exitUsage, c.execute([]string{"version"}))
+	assert.Contains(t, stderr.String(), `invalid value "maybe" for explain in environment`)
+
+	// the log is configured by the same environment variables as the other flags
+	t.Setenv("AUTHORIZER_EXPLAIN", "true")
+	t.Setenv("AUTHORIZER_LOG_MAX_AGE", "one day")
+
+	c, _, stderr = newTestCLI(input)
+	assert.Equal(t, exitUsage, c.execute([]string{"version"}))
+	assert.Contains(t, stderr.String(), `invalid value "one day" for log-max-age in environment`)
+}
+
+func TestCli_replay(t *testing.T) {
+	defer log.SetOutput(os.Stderr)
+
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	input := `{"account": {"activeCard": true, "availableLimit": 100}}
+{"transaction": {"merchant": "Oxxo", "amount": 20, "time": "2019-02-13T11:00:00.000Z",` +
+		` "coordinates": {"lat": 19.4326, "long": -99.1332}}}
+{"transaction": {"merchant": "Oxxo", "amount": 20, "time": "2019-02-13T12:00:00.000Z",` +
+		` "coordinates": {"lat": 32.5149, "long": -117.0382}}}
+`
+	quiet := []string{"-log-path", "stderr", "-log-level", "error"}
+
+	c, _, _ := newTestCLI(input)
+	assert.Equal(t, exitOK, c.execute(append([]string{"run", "-audit", auditPath}, quiet...)))
+
+	c, stdout, _ := newTestCLI("")
+	assert.Equal(t, exitOK, c.execute(append(append([]string{"replay"}, quiet...), auditPath)))
+	assert.Equal(t, "replayed 3 records, 0 decisions changed\n", stdout.String())
+
+	// without the impossible-travel rule the second transaction is approved
+	rulesPath := filepath.Join(t.TempDir(), "rules.json")
+	assert.NoError(t, os.WriteFile(rulesPath, []byte(`{"impossibleTravel": {"enabled": false}}`), 0600))
+
+	c, stdout, _ = newTestCLI("")
+	assert.Equal(t, exitFailure, c.execute(append(append([]string{"replay", "-rules", rulesPath}, quiet...), auditPath)))
+	assert.Equal(t, "record 3: recorded transaction violations [impossible-travel] availableLimit 80, "+
+		"replayed transaction violations [] availableLimit 60\nreplayed 3 records, 1 decisions changed\n",
+		stdout.String())
+}
+
+func TestCli_snapshot(t *testing.T) {
+	defer log.SetOutput(os.Stderr)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	quiet := []string{"-log-path", "stderr", "-log-level", "error"}
+
+	c, _, stderr := newTestCLI(`{"account": {"activeCard": true, "availableLimit": 100}}` + "\n")
+	assert.Equal(t, exitOK, c.execute(append(append([]string{"snapshot"}, quiet...), "export", path)), stderr.String())
+
+	// the account of the snapshot is restored before the stdin, so it isn't created again
+	c, stdout, stderr := newTestCLI(`{"transaction": {"merchant": "Oxxo", "amount": 20, ` +
+		`"time": "2019-02-13T11:00:00.000Z"}}` + "\n")
+	assert.Equal(t, exitOK, c.execute(append(append([]string{"snapshot"}, quiet...), "import", path)), stderr.String())
+	assert.Equal(t, `{"account":{"activeCard":true,"availableLimit":80},"violations":[],"ruleSetVersion":"default"}`+"\n",
+		stdout.String())
+}
+
+func TestCli_notifications(t *testing.T) {
+	defer log.SetOutput(os.Stderr)
+
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		events = append(events, r.Header.Get("X-Authorizer-Event-Type"))
+	}))
+	defer webhook.Close()
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "notifications.json")
+	config, err := json.Marshal(map[string]interface{}{
+		"violations": []string{"insufficient-limit"},
+		"lowLimit":   50,
+		"outbox":     filepath.Join(dir, "outbox"),
+		"webhooks":   []map[string]string{{"url": webhook.URL, "secret": "s3cr3t"}},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(configPath, config, 0600))
+
+	input := `{"account": {"activeCard": true, "availableLimit": 100}}
+{"transaction": {"merchant": "Oxxo", "amount": 60, "time": "2019-02-13T11:00:00.000Z"}}
+{"transaction": {"merchant": "Walmart", "amount": 90, "time": "2019-02-13T12:00:00.000Z"}}
+`
+	c, _, stderr := newTestCLI(input)
+	assert.Equal(t, exitOK, c.execute([]string{"run", "-notifications", configPath,
+		"-log-path", "stderr", "-log-level", "fatal"}), stderr.String())
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, []string{"low-limit", "card-declined"}, events)
+
+	c, _, stderr = newTestCLI("")
+	assert.Equal(t, exitFailure, c.execute([]string{"run", "-notifications", filepath.Join(dir, "missing.json"),
+		"-log-path", "stderr", "-log-level", "fatal"}))
+	assert.Contains(t, stderr.String(), "error starting notifications: error reading")
+}
+
+func TestCli_validate(t *testing.T) {
+	defer log.SetOutput(os.Stderr)
+
+	input := `{"account": {"activeCard": true, "availableLimit": 100}}
+{"transaction": {"merchant": "Burger King", "amount": "twenty"}}
+abcde
+{"transaction": {"merchant": "", "amount": 0, "time": "2019-02-13T10:00:00.000Z", "mcc": "5814"}}
+{"account": {"activeCard": true, "availableLimit": 100}}
+`
+	quiet := []string{"-log-path", "stderr", "-log-level", "fatal"}
+
+	c, stdout, _ := newTestCLI(input)
+	assert.Equal(t, exitFailure, c.execute(append([]string{"validate"}, quiet...)))
+	assert.Equal(t, `line 2: invalid input: transaction: json: cannot unmarshal string into Go struct field `+
+		`ProcessTransaction.transaction.amount of type int
+line 3: unknown operation
+line 4: unknown field transaction.mcc
+line 4: merchant is missing
+line 4: amount must be greater than 0
+line 5: account 1 was already created in line 1
+5 records, 4 invalid, 6 problems
+`, stdout.String())
+
+	c, stdout, _ = newTestCLI("")
+	assert.Equal(t, exitOK, c.execute(append(append([]string{"validate"}, quiet...), "testdata/run.in")))
+	assert.True(t, strings.HasSuffix(stdout.String(), ", 0 invalid, 0 problems\n"))
+}
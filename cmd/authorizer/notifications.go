@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"authorizer/internal/app/notify"
+	"authorizer/internal/app/service"
+)
+
+// notificationsDrainTimeout is how long the commands wait for the pending events to be delivered before exiting,
+// the events not delivered are kept in the outbox
+const notificationsDrainTimeout = 10 * time.Second
+
+// startNotifier sends the notifications of the events committed in the storage to the webhooks of the configuration
+// in path, when path is empty nothing is sent. The function returned waits for the pending events and stops the
+// notifier
+func startNotifier(path string, events service.EventLog) (func(), error) {
+	if path == "" {
+		return func() {}, nil
+	}
+
+	config, err := notify.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := notify.Start(config, events)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notificationsDrainTimeout)
+		defer cancel()
+
+		if err := n.Drain(ctx); err != nil {
+			log.Warnf("notifications: %s", err)
+		}
+
+		if err := n.Close(); err != nil {
+			log.Errorf("error closing notifications outbox: %s", err)
+		}
+	}
+
+	return stop, nil
+}
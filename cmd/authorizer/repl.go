@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"authorizer/internal/app/service"
+	"authorizer/internal/app/storage"
+	"authorizer/internal/root/repl"
+)
+
+// replCommand keeps a service alive to execute the operations typed by an operator
+type replCommand struct {
+	color string
+	audit string
+}
+
+// replFlags registers the flags of "repl"
+func replFlags(fs *flag.FlagSet) func(c *cli, args []string) int {
+	r := &replCommand{}
+	fs.StringVar(&r.color, "color", "auto", "color the responses: auto (when the stdout is a terminal), always or never")
+	fs.StringVar(&r.audit, "audit", "", "hash-chained audit log where every decision is recorded")
+
+	return r.run
+}
+
+func (r *replCommand) run(c *cli, args []string) int {
+	if len(args) > 0 {
+		return c.usageError("repl", "repl doesn't accept arguments, use load inside the session")
+	}
+
+	var color bool
+
+	switch r.color {
+	case "auto":
+		color = isTerminal(c.stdout)
+	case "always":
+		color = true
+	case "never":
+		color = false
+	default:
+		return c.usageError("repl", "unknown color mode %q, it must be auto, always or never", r.color)
+	}
+
+	rulesStore, logCloser, err := c.setup()
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+
+		return exitFailure
+	}
+	defer logCloser.Close()
+
+	opts, closeAudit, err := openAudit(r.audit)
+	if err != nil {
+		return c.failure("error opening audit log: %v", err)
+	}
+	defer closeAudit()
+
+	// every decision is explained, the session only writes the explanation with "explain last"
+	db := &storage.InMemory{}
+	svc := service.New(db, service.WithRulesStore(rulesStore), service.WithExplain(true))
+
+	session := repl.New(svc, db, c.stdout, repl.WithColor(color), repl.WithExecuteOptions(opts...))
+
+	prompt := ""
+	if isTerminal(c.stdin) {
+		prompt = "authorizer> "
+
+		fmt.Fprintln(c.stdout, "type help to see the commands, quit to end the session")
+	}
+
+	if err = session.Run(c.stdin, prompt); err != nil {
+		return c.failure("error reading the session: %v", err)
+	}
+
+	return exitOK
+}
+
+// isTerminal reports if the stream is a character device, like a terminal
+func isTerminal(stream interface{}) bool {
+	f, ok := stream.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	cmd2 "authorizer/internal/root"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"authorizer/internal/app/audit"
+	"authorizer/internal/app/service"
+	"authorizer/internal/app/storage"
+)
+
+// replayFlags registers the flags of "replay <audit-log>", the inputs are executed with the rules of the global flags,
+// so a new rules configuration can be compared with the decisions that were taken
+func replayFlags(fs *flag.FlagSet) func(c *cli, args []string) int {
+	verbose := fs.Bool("verbose", false, "write the inputs of the decisions that changed")
+
+	return func(c *cli, args []string) int {
+		if len(args) != 1 {
+			return c.usageError("replay", "usage: authorizer replay [flags] <audit-log>")
+		}
+
+		return c.replay(args[0], *verbose)
+	}
+}
+
+// replay executes the inputs of the audit log in a new storage and compares the decisions with the recorded ones,
+// the inputs are read as ndjson
+func (c *cli) replay(path string, verbose bool) int {
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "error opening audit log: %v\n", err)
+
+		return exitFailure
+	}
+	defer f.Close()
+
+	rulesStore, logCloser, err := c.setup()
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+
+		return exitFailure
+	}
+	defer logCloser.Close()
+
+	svc := service.New(&storage.InMemory{},
+		service.WithRulesStore(rulesStore),
+		service.WithExplain(c.global.explain))
+
+	input := &replayReader{scanner: audit.NewScanner(f)}
+	comparer := &replayComparer{input: input, output: c.stdout, verbose: verbose}
+
+	// the responses are discarded, the comparer writes the changed decisions
+	if err = cmd2.Execute(svc, input, io.Discard, cmd2.WithAuditor(comparer)); err != nil {
+		return c.failure("error replaying audit log after %d records: %v", comparer.replayed, err)
+	}
+
+	if err = input.scanner.Err(); err != nil {
+		return c.failure("error reading audit log after %d records: %v", comparer.replayed, err)
+	}
+
+	fmt.Fprintf(c.stdout, "replayed %d records, %d decisions changed\n", comparer.replayed, comparer.changed)
+
+	if comparer.changed > 0 {
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+// replayReader reads the inputs of the audit records as ndjson lines, the records are kept until the decisions
+// of their inputs are compared
+type replayReader struct {
+	scanner *audit.Scanner
+	pending []audit.Record
+	buf     []byte
+}
+
+func (r *replayReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if !r.scanner.Scan() {
+			return 0, io.EOF
+		}
+
+		record := r.scanner.Record()
+		r.pending = append(r.pending, record)
+		r.buf = append([]byte(record.Entry.Input), '\n')
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+// replayComparer is the auditor of the replay, it compares every decision with the recorded one
+type replayComparer struct {
+	input    *replayReader
+	output   io.Writer
+	verbose  bool
+	replayed int
+	changed  int
+}
+
+func (c *replayComparer) Append(e audit.Entry) error {
+	if len(c.input.pending) == 0 {
+		return fmt.Errorf("decision of an input that is not in the audit log: %s", e.Input)
+	}
+
+	record := c.input.pending[0]
+	c.input.pending = c.input.pending[1:]
+	c.replayed++
+
+	if sameDecision(record.Entry, e) {
+		return nil
+	}
+
+	c.changed++
+
+	fmt.Fprintf(c.output, "record %d: recorded %s, replayed %s\n", record.Sequence, decision(record.Entry), decision(e))
+
+	if c.verbose {
+		fmt.Fprintf(c.output, "  %s\n", record.Entry.Input)
+	}
+
+	return nil
+}
+
+func sameDecision(recorded, replayed audit.Entry) bool {
+	return recorded.Operation == replayed.Operation &&
+		recorded.AccountID == replayed.AccountID &&
+		recorded.AvailableLimit == replayed.AvailableLimit &&
+		strings.Join(recorded.Violations, ",") == strings.Join(replayed.Violations, ",")
+}
+
+func decision(e audit.Entry) string {
+	return fmt.Sprintf("%s violations [%s] availableLimit %d",
+		e.Operation, strings.Join(e.Violations, ","), e.AvailableLimit)
+}
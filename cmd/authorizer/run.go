@@ -0,0 +1,230 @@
+package main
+
+import (
+	cmd2 "authorizer/internal/root"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"authorizer/internal/app/audit"
+	"authorizer/internal/app/service"
+	"authorizer/internal/app/snapshot"
+	"authorizer/internal/app/storage"
+	"authorizer/internal/common/metrics"
+	"authorizer/internal/root/reader"
+	"authorizer/internal/root/writer"
+)
+
+// runCommand processes the operations of the stdin
+type runCommand struct {
+	// name is the command that is run, run or snapshot
+	name          string
+	stdin         stdinFlags
+	audit         string
+	importPath    string
+	exportPath    string
+	notifications string
+}
+
+// runFlags registers the flags of "run"
+func runFlags(fs *flag.FlagSet) func(c *cli, args []string) int {
+	r := &runCommand{name: "run"}
+	r.register(fs)
+	fs.StringVar(&r.importPath, "snapshot-import", "", "restore the state of the snapshot before reading the stdin")
+	fs.StringVar(&r.exportPath, "snapshot-export", "", "write the state in a snapshot when the stdin ends")
+
+	return r.run
+}
+
+// register registers the flags shared by "run" and "snapshot"
+func (r *runCommand) register(fs *flag.FlagSet) {
+	r.stdin.register(fs)
+	fs.StringVar(&r.audit, "audit", "", "hash-chained audit log where every decision is recorded")
+	fs.StringVar(&r.notifications, "notifications", "", "json file of the webhooks notified of the decisions")
+}
+
+func (r *runCommand) run(c *cli, args []string) int {
+	if len(args) > 0 {
+		return c.usageError(r.name, "run doesn't accept arguments, the operations are read from the stdin")
+	}
+
+	stdinOpts, report, err := r.stdin.options()
+	if err != nil {
+		return c.usageError(r.name, "%v", err)
+	}
+
+	rulesStore, logCloser, err := c.setup()
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+
+		return exitFailure
+	}
+	defer logCloser.Close()
+
+	db := storage.InMemory{}
+
+	if r.importPath != "" {
+		if err = snapshot.Import(&db, r.importPath); err != nil {
+			return c.failure("error importing snapshot: %v", err)
+		}
+	}
+
+	stopNotifier, err := startNotifier(r.notifications, &db)
+	if err != nil {
+		return c.failure("error starting notifications: %v", err)
+	}
+	defer stopNotifier()
+
+	registry := metrics.NewRegistry()
+
+	svc := service.New(&db,
+		service.WithRulesStore(rulesStore),
+		service.WithExplain(c.global.explain),
+		service.WithMetrics(service.NewMetrics(registry)))
+
+	opts, closeAudit, err := openAudit(r.audit)
+	if err != nil {
+		return c.failure("error opening audit log: %v", err)
+	}
+	defer closeAudit()
+
+	// Execute application, the input is the stdin and the output the stdout
+	if err = cmd2.Execute(svc, c.stdin, c.stdout, append(opts, stdinOpts...)...); err != nil {
+		return c.failure("%v", err)
+	}
+
+	if report != nil {
+		if err = writeReport(report, r.stdin.reportPath, r.stdin.reportFormat, c.stderr); err != nil {
+			return c.failure("error writing report: %v", err)
+		}
+	}
+
+	if r.stdin.metricsSummary {
+		if err = metrics.WritePrometheus(c.stderr, registry); err != nil {
+			return c.failure("error writing metrics: %v", err)
+		}
+	}
+
+	if r.exportPath != "" {
+		if err = snapshot.Export(&db, r.exportPath); err != nil {
+			return c.failure("error exporting snapshot: %v", err)
+		}
+	}
+
+	return exitOK
+}
+
+// openAudit returns the option that records the decisions in the audit log of path, when path is empty there are
+// no options. The function returned closes the audit log
+func openAudit(path string) ([]cmd2.Option, func(), error) {
+	if path == "" {
+		return nil, func() {}, nil
+	}
+
+	auditLog, err := audit.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return []cmd2.Option{cmd2.WithAuditor(auditLog)}, func() { auditLog.Close() }, nil
+}
+
+// inputFlags configure how the operations are read
+type inputFlags struct {
+	inputFormat      string
+	csvMapping       string
+	fixedWidthLayout string
+}
+
+func (f *inputFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.inputFormat, "input-format", reader.FormatNDJSON, "format of the input: ndjson, csv or fixed-width")
+	fs.StringVar(&f.csvMapping, "csv-mapping", "", "renames the csv columns to fields: COLUMN=field,COLUMN=field")
+	fs.StringVar(&f.fixedWidthLayout, "fixed-width-layout", "",
+		"columns of the fixed-width records in order: field:width,field:width, the field - is ignored")
+}
+
+// format returns the format of the input, strict is used to validate the input
+func (f *inputFlags) format(strict bool) (reader.Format, error) {
+	o := reader.Options{Strict: strict}
+
+	var err error
+
+	if o.Mapping, err = reader.ParseMapping(f.csvMapping); err != nil {
+		return nil, err
+	}
+
+	if o.Layout, err = reader.ParseLayout(f.fixedWidthLayout); err != nil {
+		return nil, err
+	}
+
+	return reader.NewFormat(f.inputFormat, o)
+}
+
+// stdinFlags are the flags only used when the operations are read from the stdin
+type stdinFlags struct {
+	inputFlags
+	outputFormat   string
+	outputFields   string
+	reportPath     string
+	reportFormat   string
+	metricsSummary bool
+}
+
+func (f *stdinFlags) register(fs *flag.FlagSet) {
+	f.inputFlags.register(fs)
+	fs.StringVar(&f.outputFormat, "output-format", writer.FormatNDJSON,
+		"format of the stdout: ndjson, pretty, csv or table")
+	fs.StringVar(&f.outputFields, "output-fields", "",
+		"fields added to every response to join it to its input: line,requestId,operation,timestamp")
+	fs.StringVar(&f.reportPath, "report", "", "write a summary of the run when the stdin ends: stderr or a file")
+	fs.StringVar(&f.reportFormat, "report-format", "table", "format of the report: table or json")
+	fs.BoolVar(&f.metricsSummary, "metrics-summary", false, "write the metrics to stderr when the stdin ends")
+}
+
+// options returns the options of root.Execute and the report that is filled when -report is set
+func (f *stdinFlags) options() ([]cmd2.Option, *cmd2.Report, error) {
+	format, err := f.format(false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	output, err := writer.NewFormat(f.outputFormat)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fields, err := writer.ParseFields(f.outputFields)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := []cmd2.Option{cmd2.WithInputFormat(format), cmd2.WithOutputFormat(output, fields)}
+
+	if f.reportPath == "" {
+		return opts, nil, nil
+	}
+
+	if f.reportFormat != "table" && f.reportFormat != "json" {
+		return nil, nil, fmt.Errorf("unknown report format %q, it must be table or json", f.reportFormat)
+	}
+
+	report := cmd2.NewReport()
+
+	return append(opts, cmd2.WithReport(report)), report, nil
+}
+
+// writeReport writes the report to stderr or creates the file in path
+func writeReport(report *cmd2.Report, path, format string, stderr io.Writer) error {
+	if path == "stderr" {
+		return report.Write(stderr, format)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating report file: %w", err)
+	}
+	defer f.Close()
+
+	return report.Write(f, format)
+}
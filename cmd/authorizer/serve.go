@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"authorizer/internal/app/service"
+	"authorizer/internal/app/service/rules"
+	"authorizer/internal/app/snapshot"
+	"authorizer/internal/app/storage"
+	"authorizer/internal/common/metrics"
+	"authorizer/internal/root/server"
+)
+
+// serveCommand receives the operations in http
+type serveCommand struct {
+	listen        string
+	audit         string
+	importPath    string
+	notifications string
+	retention     retentionFlags
+}
+
+// serveFlags registers the flags of "serve"
+func serveFlags(fs *flag.FlagSet) func(c *cli, args []string) int {
+	s := &serveCommand{}
+	fs.StringVar(&s.listen, "listen", ":8080", "address of the http server")
+	fs.StringVar(&s.audit, "audit", "", "hash-chained audit log where every decision is recorded")
+	fs.StringVar(&s.notifications, "notifications", "", "json file of the webhooks notified of the decisions")
+	fs.StringVar(&s.importPath, "snapshot-import", "", "restore the state of the snapshot before listening")
+	s.retention.register(fs)
+
+	return s.run
+}
+
+func (s *serveCommand) run(c *cli, args []string) int {
+	if len(args) > 0 {
+		return c.usageError("serve", "serve doesn't accept arguments")
+	}
+
+	rulesStore, logCloser, err := c.setup()
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+
+		return exitFailure
+	}
+	defer logCloser.Close()
+
+	if window := rulesStore.Load().MaxWindow(); s.retention.horizon > 0 && s.retention.horizon < window {
+		return c.usageError("serve", "-history-horizon %s is shorter than the window of the rules %s",
+			s.retention.horizon, window)
+	}
+
+	db := storage.InMemory{}
+
+	if s.importPath != "" {
+		if err = snapshot.Import(&db, s.importPath); err != nil {
+			return c.failure("error importing snapshot: %v", err)
+		}
+	}
+
+	stopNotifier, err := startNotifier(s.notifications, &db)
+	if err != nil {
+		return c.failure("error starting notifications: %v", err)
+	}
+	defer stopNotifier()
+
+	registry := metrics.NewRegistry()
+
+	svc := service.New(&db,
+		service.WithRulesStore(rulesStore),
+		service.WithExplain(c.global.explain),
+		service.WithMetrics(service.NewMetrics(registry)))
+
+	opts, closeAudit, err := openAudit(s.audit)
+	if err != nil {
+		return c.failure("error opening audit log: %v", err)
+	}
+	defer closeAudit()
+
+	closeArchive, err := s.retention.start(&db, rulesStore)
+	if err != nil {
+		return c.failure("error opening history archive: %v", err)
+	}
+	defer closeArchive()
+
+	if err = serve(s.listen, server.New(svc, registry, opts...).WithEvents(&db).WithHistory(svc)); err != nil {
+		return c.failure("error running server: %v", err)
+	}
+
+	return exitOK
+}
+
+// retentionFlags configure the compaction of the history and the outbox in server mode
+type retentionFlags struct {
+	horizon   time.Duration
+	interval  time.Duration
+	archive   string
+	maxEvents int
+}
+
+func (f *retentionFlags) register(fs *flag.FlagSet) {
+	fs.DurationVar(&f.horizon, "history-horizon", 0,
+		"remove the transactions older than this before the last event of their account, 0 keeps all of them")
+	fs.DurationVar(&f.interval, "compaction-interval", time.Minute, "how often the history is compacted")
+	fs.StringVar(&f.archive, "history-archive", "", "file where the transactions removed from the history are appended")
+	fs.IntVar(&f.maxEvents, "events-retention", 0,
+		"how many authorization events are kept for the consumers of /events, 0 keeps all of them")
+}
+
+// start runs the compaction in the background, the horizon is never shorter than the windows of the rules loaded
+// at the time of each compaction. The function returned closes the archive
+func (f *retentionFlags) start(db *storage.InMemory, rulesStore *rules.Store) (func(), error) {
+	if f.horizon <= 0 && f.maxEvents <= 0 {
+		return func() {}, nil
+	}
+
+	r := storage.Retention{
+		Horizon:    f.horizon,
+		MinHorizon: func() time.Duration { return rulesStore.Load().MaxWindow() },
+		MaxEvents:  f.maxEvents,
+	}
+
+	var archive *os.File
+
+	if f.archive != "" {
+		var err error
+
+		archive, err = os.OpenFile(f.archive, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Archive = archive
+	}
+
+	go db.RunCompaction(context.Background(), f.interval, r)
+
+	return func() {
+		if archive != nil {
+			archive.Close()
+		}
+	}, nil
+}
+
+// serve runs the http server until the process receives SIGINT or SIGTERM
+func serve(addr string, s *server.Server) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// the requests end with the context, so the event streams don't delay the shutdown
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Errorf("error shutting down server: %+v", err)
+		}
+	}()
+
+	log.Infof("listening on %s", addr)
+
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import "flag"
+
+// snapshotFlags registers the flags of "snapshot export|import <file>", they are the flags of run without
+// -snapshot-import and -snapshot-export, the file is the argument
+func snapshotFlags(fs *flag.FlagSet) func(c *cli, args []string) int {
+	r := &runCommand{name: "snapshot"}
+	r.register(fs)
+
+	return func(c *cli, args []string) int {
+		if len(args) != 2 || (args[0] != "export" && args[0] != "import") {
+			return c.usageError("snapshot", "usage: authorizer snapshot export|import <file>")
+		}
+
+		// export processes the stdin and then writes the snapshot, import restores it and then processes the stdin
+		if args[0] == "export" {
+			r.exportPath = args[1]
+		} else {
+			r.importPath = args[1]
+		}
+
+		return r.run(c, nil)
+	}
+}
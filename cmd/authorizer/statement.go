@@ -0,0 +1,128 @@
+package main
+
+import (
+	cmd2 "authorizer/internal/root"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"authorizer/internal/app/service"
+	"authorizer/internal/app/snapshot"
+	"authorizer/internal/app/storage"
+	"authorizer/internal/root/writer"
+)
+
+// statementCommand executes the operations of an input and writes the statements of an account
+type statementCommand struct {
+	input      inputFlags
+	accountID  int
+	from       string
+	to         string
+	period     string
+	format     string
+	importPath string
+}
+
+// statementFlags registers the flags of "statement [file]", the operations are read from the file or the stdin
+// when it is "-" or it is omitted without -snapshot-import
+func statementFlags(fs *flag.FlagSet) func(c *cli, args []string) int {
+	s := &statementCommand{}
+	s.input.register(fs)
+	fs.IntVar(&s.accountID, "account", 1, "id of the account")
+	fs.StringVar(&s.from, "from", "", "start of the statements in RFC 3339, it is required")
+	fs.StringVar(&s.to, "to", "", "end of the statements in RFC 3339 (excluded), it is required")
+	fs.StringVar(&s.period, "period", "", "a statement per day, week or month, a single statement when it is empty")
+	fs.StringVar(&s.format, "format", writer.StatementJSON, "format of the statements: json or csv")
+	fs.StringVar(&s.importPath, "snapshot-import", "", "restore the state of the snapshot before the operations")
+
+	return s.run
+}
+
+func (s *statementCommand) run(c *cli, args []string) int {
+	if len(args) > 1 {
+		return c.usageError("statement", "usage: authorizer statement [flags] [file]")
+	}
+
+	q, err := s.query()
+	if err != nil {
+		return c.usageError("statement", "%v", err)
+	}
+
+	if s.format != writer.StatementJSON && s.format != writer.StatementCSV {
+		return c.usageError("statement", "unknown statement format %q, it must be json or csv", s.format)
+	}
+
+	format, err := s.input.format(false)
+	if err != nil {
+		return c.usageError("statement", "%v", err)
+	}
+
+	rulesStore, logCloser, err := c.setup()
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+
+		return exitFailure
+	}
+	defer logCloser.Close()
+
+	db := storage.InMemory{}
+
+	if s.importPath != "" {
+		if err = snapshot.Import(&db, s.importPath); err != nil {
+			return c.failure("error importing snapshot: %v", err)
+		}
+	}
+
+	svc := service.New(&db, service.WithRulesStore(rulesStore))
+
+	if len(args) == 1 || s.importPath == "" {
+		r := c.stdin
+
+		if len(args) == 1 && args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return c.failure("error opening input: %v", err)
+			}
+			defer f.Close()
+
+			r = f
+		}
+
+		// only the state is needed, the responses are discarded so they can't fail to be written
+		_ = cmd2.Execute(svc, r, io.Discard, cmd2.WithInputFormat(format))
+	}
+
+	statements, err := svc.Statements(q)
+	if err != nil {
+		return c.failure("error reading statements: %v", err)
+	}
+
+	if err = writer.WriteStatements(c.stdout, statements, s.format); err != nil {
+		return c.failure("error writing statements: %v", err)
+	}
+
+	return exitOK
+}
+
+func (s *statementCommand) query() (service.StatementQuery, error) {
+	q := service.StatementQuery{AccountID: s.accountID, Period: s.period}
+
+	if s.from == "" || s.to == "" {
+		return q, errors.New("-from and -to are required")
+	}
+
+	var err error
+
+	if q.From, err = time.Parse(time.RFC3339, s.from); err != nil {
+		return q, fmt.Errorf("-from must be a RFC 3339 time: %w", err)
+	}
+
+	if q.To, err = time.Parse(time.RFC3339, s.to); err != nil {
+		return q, fmt.Errorf("-to must be a RFC 3339 time: %w", err)
+	}
+
+	return q, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"authorizer/internal/common/logfile"
+	"authorizer/internal/root/reader"
+)
+
+// validateFlags registers the flags of "validate [file]", the file is read from the stdin when it is omitted or "-".
+// The records are read in strict mode (see reader.Strict) and nothing is executed, so no storage is needed
+func validateFlags(fs *flag.FlagSet) func(c *cli, args []string) int {
+	input := &inputFlags{}
+	input.register(fs)
+
+	return func(c *cli, args []string) int {
+		if len(args) > 1 {
+			return c.usageError("validate", "usage: authorizer validate [flags] [file]")
+		}
+
+		format, err := input.format(true)
+		if err != nil {
+			return c.usageError("validate", "%v", err)
+		}
+
+		logCloser, err := logfile.Init(c.global.log)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "error initializing log: %v\n", err)
+
+			return exitFailure
+		}
+		defer logCloser.Close()
+
+		r := c.stdin
+
+		if len(args) == 1 && args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				fmt.Fprintf(c.stderr, "error opening input: %v\n", err)
+
+				return exitFailure
+			}
+			defer f.Close()
+
+			r = f
+		}
+
+		return c.validate(format(r))
+	}
+}
+
+// validate decodes every record without executing it and writes every problem of the records that are not valid
+func (c *cli) validate(decoder reader.Decoder) int {
+	records, invalid, problems := 0, 0, 0
+
+	for {
+		req, err := decoder.Decode()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil && !errors.Is(err, reader.ErrInvalidInput) && !errors.Is(err, reader.ErrUnknownOperation) {
+			fmt.Fprintf(c.stderr, "error reading input after %d records: %v\n", records, err)
+
+			return exitFailure
+		}
+
+		records++
+
+		if err == nil {
+			continue
+		}
+
+		invalid++
+
+		var validation *reader.ValidationError
+		if !errors.As(err, &validation) {
+			problems++
+
+			fmt.Fprintf(c.stdout, "line %d: %v\n", req.Line, err)
+
+			continue
+		}
+
+		for _, problem := range validation.Problems {
+			problems++
+
+			fmt.Fprintf(c.stdout, "line %d: %s\n", req.Line, problem)
+		}
+	}
+
+	fmt.Fprintf(c.stdout, "%d records, %d invalid, %d problems\n", records, invalid, problems)
+
+	if invalid > 0 {
+		return exitFailure
+	}
+
+	return exitOK
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+)
+
+// version, commit and date are set at build time, see scripts/build.sh:
+// go build -ldflags "-X main.version=v1.2.0 -X main.commit=3f2a1c9 -X main.date=2021-06-01T10:00:00Z"
+//
+//nolint:gochecknoglobals // -ldflags -X can only set package variables
+var (
+	version = "dev"
+	commit  = "unknown"
+	date    = "unknown"
+)
+
+// versionFlags registers the flags of "version"
+func versionFlags(fs *flag.FlagSet) func(c *cli, args []string) int {
+	short := fs.Bool("short", false, "print only the version")
+
+	return func(c *cli, args []string) int {
+		if len(args) > 0 {
+			return c.usageError("version", "version doesn't accept arguments")
+		}
+
+		if *short {
+			fmt.Fprintln(c.stdout, version)
+
+			return exitOK
+		}
+
+		fmt.Fprintf(c.stdout, "authorizer %s (commit %s, built %s, %s)\n", version, commit, date, runtime.Version())
+
+		return exitOK
+	}
+}
@@ -0,0 +1,324 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is the information of a decision that must be audited
+type Entry struct {
+	Input          string   `json:"input"`
+	Operation      string   `json:"operation"`
+	AccountID      int      `json:"accountId"`
+	Violations     []string `json:"violations"`
+	AvailableLimit int      `json:"availableLimit"`
+}
+
+// Record is a line of the audit log, every record contains the hash of the previous one
+// so any modification, truncation or reordering breaks the chain
+type Record struct {
+	Sequence     int       `json:"sequence"`
+	Time         time.Time `json:"time"`
+	Entry        Entry     `json:"entry"`
+	PreviousHash string    `json:"previousHash"`
+	Hash         string    `json:"hash"`
+}
+
+// Head is stored next to the audit log (path + ".head") with the last record written,
+// it is needed to detect that records were removed from the end of the log
+type Head struct {
+	Sequence int    `json:"sequence"`
+	Hash     string `json:"hash"`
+}
+
+// Log appends records to an audit log file, it is safe for concurrent use
+type Log struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	head Head
+	now  func() time.Time
+}
+
+// Open opens or creates the audit log in path, when the log already has records the chain continues from the last one,
+// a log that doesn't match its head file is not continued
+func Open(path string) (*Log, error) {
+	head, err := lastRecord(path)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := readHead(path)
+
+	switch {
+	case err != nil && head.Sequence > 0:
+		return nil, err
+	case err != nil:
+		if err = writeHead(path, head); err != nil {
+			return nil, err
+		}
+	case stored != head:
+		return nil, fmt.Errorf("audit log doesn't match its head, it can't be continued: head is record %d, last is %d",
+			stored.Sequence, head.Sequence)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log: %w", err)
+	}
+
+	return &Log{
+		path: path,
+		file: f,
+		head: head,
+		now:  time.Now,
+	}, nil
+}
+
+// Append writes a new record chained to the previous one and updates the head file,
+// the record is synced to disk before returning
+func (l *Log) Append(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record := Record{
+		Sequence:     l.head.Sequence + 1,
+		Time:         l.now().UTC(),
+		Entry:        e,
+		PreviousHash: l.head.Hash,
+	}
+
+	hash, err := record.computeHash()
+	if err != nil {
+		return err
+	}
+
+	record.Hash = hash
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling audit record: %w", err)
+	}
+
+	if _, err = l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing audit record: %w", err)
+	}
+
+	if err = l.file.Sync(); err != nil {
+		return fmt.Errorf("error syncing audit log: %w", err)
+	}
+
+	l.head = Head{Sequence: record.Sequence, Hash: record.Hash}
+
+	return writeHead(l.path, l.head)
+}
+
+// Close closes the audit log file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
+
+// Verify reads the whole audit log and returns the number of valid records,
+// it fails on the first record that is not chained to the previous one or whose hash doesn't match its content,
+// and when the last record is not the one stored in the head file
+func Verify(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("error opening audit log: %w", err)
+	}
+	defer f.Close()
+
+	last, err := verifyChain(f)
+	if err != nil {
+		return last.Sequence, err
+	}
+
+	head, err := readHead(path)
+	if err != nil {
+		return last.Sequence, err
+	}
+
+	if head != last {
+		return last.Sequence, fmt.Errorf("log truncated: head is record %d (%s) but last record is %d (%s)",
+			head.Sequence, head.Hash, last.Sequence, last.Hash)
+	}
+
+	return last.Sequence, nil
+}
+
+// verifyChain returns the last valid record of the chain
+func verifyChain(r io.Reader) (Head, error) {
+	s := NewScanner(r)
+	for s.Scan() {
+	}
+
+	return s.last, s.Err()
+}
+
+// Scanner reads the records of an audit log in order, it stops at the first record
+// that is not chained to the previous one or whose hash doesn't match its content
+type Scanner struct {
+	scanner *bufio.Scanner
+	line    int
+	last    Head
+	record  Record
+	err     error
+}
+
+// NewScanner returns a Scanner that reads the records from r
+func NewScanner(r io.Reader) *Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+
+	return &Scanner{scanner: scanner}
+}
+
+// Scan advances to the next valid record, it returns false at the end of the log or when a record is not valid
+func (s *Scanner) Scan() bool {
+	if s.err != nil || !s.scanner.Scan() {
+		return false
+	}
+
+	s.line++
+
+	var record Record
+	if err := json.Unmarshal(s.scanner.Bytes(), &record); err != nil {
+		s.err = fmt.Errorf("line %d: invalid record: %w", s.line, err)
+
+		return false
+	}
+
+	if record.Sequence != s.last.Sequence+1 {
+		s.err = fmt.Errorf("line %d: expected sequence %d, got %d", s.line, s.last.Sequence+1, record.Sequence)
+
+		return false
+	}
+
+	if record.PreviousHash != s.last.Hash {
+		s.err = fmt.Errorf("line %d: record is not chained to the previous one", s.line)
+
+		return false
+	}
+
+	hash, err := record.computeHash()
+	if err != nil {
+		s.err = err
+
+		return false
+	}
+
+	if hash != record.Hash {
+		s.err = fmt.Errorf("line %d: record was modified", s.line)
+
+		return false
+	}
+
+	s.record = record
+	s.last = Head{Sequence: record.Sequence, Hash: record.Hash}
+
+	return true
+}
+
+// Record is the record read by the last call to Scan
+func (s *Scanner) Record() Record {
+	return s.record
+}
+
+// Err is the error that stopped Scan, nil at the end of the log
+func (s *Scanner) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+
+	if err := s.scanner.Err(); err != nil {
+		return fmt.Errorf("error reading audit log: %w", err)
+	}
+
+	return nil
+}
+
+// maxLineSize is the biggest record accepted, records contain the whole input line
+// so they can be bigger than the default token size of bufio.Scanner
+const maxLineSize = 1024 * 1024
+
+// computeHash is the sha256 of the record without its own hash
+func (r Record) computeHash() (string, error) {
+	r.Hash = ""
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling audit record: %w", err)
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lastRecord verifies an existing log to continue its chain, a new log starts from an empty head
+func lastRecord(path string) (Head, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return Head{}, nil
+	}
+
+	if err != nil {
+		return Head{}, fmt.Errorf("error opening audit log: %w", err)
+	}
+	defer f.Close()
+
+	last, err := verifyChain(f)
+	if err != nil {
+		return last, fmt.Errorf("audit log is corrupted, it can't be continued: %w", err)
+	}
+
+	return last, nil
+}
+
+func headPath(path string) string {
+	return path + ".head"
+}
+
+func writeHead(path string, head Head) error {
+	b, err := json.Marshal(head)
+	if err != nil {
+		return fmt.Errorf("error marshaling audit head: %w", err)
+	}
+
+	// the head is written to a temporary file and renamed so it is never half written
+	tmp := headPath(path) + ".tmp"
+	if err = os.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("error writing audit head: %w", err)
+	}
+
+	if err = os.Rename(tmp, headPath(path)); err != nil {
+		return fmt.Errorf("error writing audit head: %w", err)
+	}
+
+	return nil
+}
+
+func readHead(path string) (Head, error) {
+	var head Head
+
+	b, err := os.ReadFile(headPath(path))
+	if err != nil {
+		return head, fmt.Errorf("error reading audit head, truncation can't be verified: %w", err)
+	}
+
+	if err = json.Unmarshal(b, &head); err != nil {
+		return head, fmt.Errorf("invalid audit head: %w", err)
+	}
+
+	return head, nil
+}
@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeLog(t *testing.T, entries int) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := Open(path)
+	assert.NoError(t, err)
+
+	for i := 0; i < entries; i++ {
+		err = l.Append(Entry{
+			Input:          `{"transaction": {"merchant": "uno", "amount": 10}}`,
+			Operation:      "transaction",
+			AccountID:      1,
+			Violations:     []string{},
+			AvailableLimit: 100 - i*10,
+		})
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, l.Close())
+
+	return path
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(lines []string) []string
+		want    int
+		wantErr string
+	}{
+		{"valid",
+			func(lines []string) []string { return lines },
+			3,
+			"",
+		},
+		{"modified",
+			func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], `"availableLimit":90`, `"availableLimit":900`, 1)
+				return lines
+			},
+			1,
+			"line 2: record was modified",
+		},
+		{"reordered",
+			func(lines []string) []string {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			1,
+			"line 2: expected sequence 2, got 3",
+		},
+		{"removedInTheMiddle",
+			func(lines []string) []string {
+				return append(lines[:1], lines[2:]...)
+			},
+			1,
+			"line 2: expected sequence 2, got 3",
+		},
+		{"truncated",
+			func(lines []string) []string {
+				return lines[:2]
+			},
+			2,
+			"log truncated",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeLog(t, 3)
+
+			b, err := os.ReadFile(path)
+			assert.NoError(t, err)
+
+			lines := tt.tamper(strings.Split(strings.TrimSpace(string(b)), "\n"))
+			assert.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600))
+
+			got, err := Verify(path)
+			assert.Equal(t, tt.want, got)
+
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOpen_continuesChain(t *testing.T) {
+	path := writeLog(t, 2)
+
+	l, err := Open(path)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Append(Entry{Input: "abcde", Operation: "unknown", Violations: []string{"unknown-command"}}))
+	assert.NoError(t, l.Close())
+
+	got, err := Verify(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, got)
+}
+
+func TestOpen_truncatedLog(t *testing.T) {
+	path := writeLog(t, 2)
+
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	lines := strings.SplitAfter(string(b), "\n")
+	assert.NoError(t, os.WriteFile(path, []byte(lines[0]), 0600))
+
+	_, err = Open(path)
+	assert.Error(t, err)
+}
+
+func TestVerify_missingHead(t *testing.T) {
+	path := writeLog(t, 1)
+	assert.NoError(t, os.Remove(headPath(path)))
+
+	_, err := Verify(path)
+	assert.Error(t, err)
+}
+
+func TestScanner(t *testing.T) {
+	path := writeLog(t, 3)
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	s := NewScanner(f)
+
+	var limits []int
+	for s.Scan() {
+		assert.Equal(t, len(limits)+1, s.Record().Sequence)
+
+		limits = append(limits, s.Record().Entry.AvailableLimit)
+	}
+
+	assert.NoError(t, s.Err())
+	assert.Equal(t, []int{100, 90, 80}, limits)
+
+	s = NewScanner(strings.NewReader(`{"sequence": 2}` + "\n"))
+	assert.False(t, s.Scan())
+	assert.EqualError(t, s.Err(), "line 1: expected sequence 1, got 2")
+}
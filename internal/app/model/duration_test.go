@@ -0,0 +1,40 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuration_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Duration
+		wantErr bool
+	}{
+		{"minutes", `"2m"`, Duration{2 * time.Minute}, false},
+		{"composed", `"1h30m"`, Duration{90 * time.Minute}, false},
+		{"number", `120`, Duration{}, true},
+		{"invalid", `"two minutes"`, Duration{}, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var got Duration
+
+			err := json.Unmarshal([]byte(tt.input), &got)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDuration_MarshalJSON(t *testing.T) {
+	got, err := json.Marshal(Duration{90 * time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, `"1m30s"`, string(got))
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrAccountNotFound is returned by the storage when the operation needs an account that wasn't created
+var ErrAccountNotFound = errors.New("account not found")
+
+// ErrEventsCompacted is returned by the storage when the events requested were removed by the retention,
+// the consumer must start again from the first event kept
+var ErrEventsCompacted = errors.New("events were compacted")
+
+// CompactedError is the ErrEventsCompacted of a storage, First is the offset of the first event kept
+type CompactedError struct {
+	First int
+}
+
+func (e *CompactedError) Error() string {
+	return fmt.Sprintf("%s: the first event kept is %d", ErrEventsCompacted, e.First)
+}
+
+func (e *CompactedError) Unwrap() error {
+	return ErrEventsCompacted
+}
+
+// ErrOffsetAhead is returned by the storage when the events requested are after the last event appended,
+// the offset of the consumer belongs to another log
+var ErrOffsetAhead = errors.New("offset is after the last event")
+
+// ConflictError is returned by the storage when an account is written with a version that is not the stored one,
+// another operation changed the account after it was read
+type ConflictError struct {
+	AccountID int
+	// Version is the version of the account that was read
+	Version int
+	// Stored is the version found in the storage
+	Stored int
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("account %d was modified, version %d was read but the stored one is %d",
+		e.AccountID, e.Version, e.Stored)
+}
@@ -2,12 +2,53 @@ package model
 
 import "time"
 
+// InitialMerchant is the merchant of the transaction that the storage adds to the history when the account is
+// created, its amount is the initial limit
+const InitialMerchant = "initial"
+
+// PaymentMerchant is the merchant of the transactions that the storage adds to the history for the payments,
+// their amount is negative as they restore the limit
+const PaymentMerchant = "payment"
+
+// IsReservedMerchant reports if the merchant is one of the merchants of the transactions added by the storage,
+// the transactions of the input can't use them
+func IsReservedMerchant(merchant string) bool {
+	return merchant == InitialMerchant || merchant == PaymentMerchant
+}
+
 // Transaction is the object that represents the operation
 // executed on the AvailableLimit of the account
 type Transaction struct {
+	// Id is assigned by the storage when the transaction is executed
+	Id       string    `json:"-"`
 	Merchant string    `json:"merchant"`
 	Amount   int       `json:"amount"`
 	Time     time.Time `json:"time"`
+	// Country and Coordinates are optional, they are used by the geolocation rules when present
+	Country     string       `json:"country,omitempty"`
+	Coordinates *Coordinates `json:"coordinates,omitempty"`
+}
+
+// DeclinedTransaction is a transaction that was declined with its violations, the declined attempts are kept
+// apart from the history so they don't change the rules that analyze the approved transactions
+type DeclinedTransaction struct {
+	Transaction
+	Violations []string `json:"violations"`
+}
+
+// Coordinates is the place where a transaction was executed, in decimal degrees
+type Coordinates struct {
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"long"`
+}
+
+// DailyTotal summarizes the transactions of a day that are no longer in the history of an account,
+// they keep the amounts needed by the rules that limit the spending of a period
+type DailyTotal struct {
+	// Day is the start of the day in UTC
+	Day          time.Time `json:"day"`
+	Transactions int       `json:"transactions"`
+	Amount       int       `json:"amount"`
 }
 
 // Account is the object that represents the account of a person
@@ -16,4 +57,121 @@ type Account struct {
 	Id             int  `json:"-"`
 	ActiveCard     bool `json:"activeCard"`
 	AvailableLimit int  `json:"availableLimit"`
+	// HomeCountry restricts the transactions to a single country when it is set
+	HomeCountry  string       `json:"homeCountry,omitempty"`
+	RuleSettings RuleSettings `json:"ruleSettings,omitempty"`
+	// CreditLine is optional, it makes the account a credit card that is billed every month
+	CreditLine *CreditLine `json:"creditLine,omitempty"`
+	// Version increases every time the account is written, it is used to detect concurrent modifications
+	Version int `json:"-"`
+}
+
+// Payment is the object that represents a payment of the balance of a credit line, it restores the AvailableLimit
+type Payment struct {
+	Amount int       `json:"amount"`
+	Time   time.Time `json:"time"`
+}
+
+// CreditLine contains the terms of the credit card of an account and the state of its billing cycles.
+// The cycles only move with the time of the transactions and the payments, never with the clock,
+// so the same input always produces the same statements
+type CreditLine struct {
+	// Limit is the credit limit, it is the available limit of the account when it is created
+	Limit int `json:"limit"`
+	// ClosingDay is the day of the month, 1 to 28, when the cycle closes at 00:00 UTC
+	ClosingDay int `json:"closingDay"`
+	// DueDays is the number of days after the close to pay the minimum payment
+	DueDays int `json:"dueDays"`
+	// MinimumPaymentPercent is the part of the statement balance that must be paid, but at least MinimumPayment
+	MinimumPaymentPercent int `json:"minimumPaymentPercent"`
+	MinimumPayment        int `json:"minimumPayment,omitempty"`
+	// NextClose is the end of the open cycle, the first transaction or payment of the account starts it
+	NextClose *time.Time `json:"nextClose,omitempty"`
+	// Statement is the last cycle closed
+	Statement *BillingStatement `json:"statement,omitempty"`
+	// LatePayments counts the statements whose minimum payment wasn't paid by their due date
+	LatePayments int `json:"latePayments,omitempty"`
+}
+
+// BillingStatement is the balance of a credit line when a cycle closed and the payments received after it
+type BillingStatement struct {
+	ClosedAt       time.Time `json:"closedAt"`
+	Balance        int       `json:"balance"`
+	MinimumPayment int       `json:"minimumPayment"`
+	DueDate        time.Time `json:"dueDate"`
+	Paid           int       `json:"paid"`
+	// Late is set when the due date passed before the minimum payment was paid
+	Late bool `json:"late,omitempty"`
+}
+
+// Copy returns a new credit line with the same terms and state, so it can be stored without sharing the pointers
+func (c *CreditLine) Copy() *CreditLine {
+	if c == nil {
+		return nil
+	}
+
+	credit := *c
+
+	if c.NextClose != nil {
+		nextClose := *c.NextClose
+		credit.NextClose = &nextClose
+	}
+
+	if c.Statement != nil {
+		statement := *c.Statement
+		credit.Statement = &statement
+	}
+
+	return &credit
+}
+
+// RuleSettings are the overrides of the business rules for a single account, the key is the name of the rule
+type RuleSettings map[string]RuleOverride
+
+// RuleOverride changes how a business rule is applied to an account,
+// the zero value of every field means that the default of the rule is used
+type RuleOverride struct {
+	Disabled bool `json:"disabled,omitempty"`
+	// Window replaces the period of time analyzed by the velocity rules
+	Window *Duration `json:"window,omitempty"`
+	// Threshold replaces the number of transactions (or the speed in km/h for impossibleTravel) that raises the violation
+	Threshold int `json:"threshold,omitempty"`
+	// ExemptUntil disables the rule for the transactions executed before this time
+	ExemptUntil *time.Time `json:"exemptUntil,omitempty"`
+}
+
+// IsZero reports if the override doesn't change anything
+func (o RuleOverride) IsZero() bool {
+	return !o.Disabled && o.Window == nil && o.Threshold == 0 && o.ExemptUntil == nil
+}
+
+// Copy returns a new map with the same overrides, so the settings can be stored without sharing the map
+func (rs RuleSettings) Copy() RuleSettings {
+	if rs == nil {
+		return nil
+	}
+
+	settings := make(RuleSettings, len(rs))
+	for rule, override := range rs {
+		settings[rule] = override
+	}
+
+	return settings
+}
+
+// AuthorizationEvent is the decision of a transaction, the storage keeps it with the writes of the decision
+// so the downstream systems receive every decision that changed the state and only those
+type AuthorizationEvent struct {
+	// Offset is assigned by the storage, the events of every account are numbered in the order they were committed
+	// starting at 1
+	Offset      int         `json:"offset"`
+	ID          string      `json:"id"`
+	AccountID   int         `json:"accountId"`
+	RequestID   string      `json:"requestId,omitempty"`
+	Transaction Transaction `json:"transaction"`
+	Approved    bool        `json:"approved"`
+	Violations  []string    `json:"violations"`
+	// AvailableLimit is the limit of the account after the decision
+	AvailableLimit int    `json:"availableLimit"`
+	RuleSetVersion string `json:"ruleSetVersion,omitempty"`
 }
@@ -0,0 +1,440 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/app/service"
+)
+
+// Headers of the requests sent to the webhooks
+const (
+	HeaderEventID   = "X-Authorizer-Event-Id"
+	HeaderEventType = "X-Authorizer-Event-Type"
+	// HeaderSignature is "t=<unix time>,v1=<hex hmac-sha256 of "<unix time>.<body>">", see Sign
+	HeaderSignature = "X-Authorizer-Signature"
+)
+
+// ErrInvalidSignature is returned by Verify when the request wasn't signed with the secret
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Webhook is an url that receives the events as json in a POST request
+type Webhook struct {
+	URL string `json:"url"`
+	// Secret signs the requests, the webhook verifies them with the same secret
+	Secret string `json:"secret"`
+	// Events are the types of the events sent to the webhook, every type when it is empty
+	Events []string `json:"events,omitempty"`
+}
+
+func (w Webhook) accepts(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+
+	for _, t := range w.Events {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Retry is the exponential backoff between the attempts to deliver an event to a webhook
+type Retry struct {
+	Initial model.Duration `json:"initial"`
+	Max     model.Duration `json:"max"`
+	// MaxAttempts discards the event for the webhook after this many attempts, 0 retries until it is delivered
+	MaxAttempts int `json:"maxAttempts"`
+}
+
+// Config is the json file of the notifications
+type Config struct {
+	service.Notifications
+	// Outbox is the file where the events are kept until they are delivered
+	Outbox   string    `json:"outbox"`
+	Webhooks []Webhook `json:"webhooks"`
+	Retry    Retry     `json:"retry"`
+	// Timeout of every request
+	Timeout model.Duration `json:"timeout"`
+}
+
+// LoadConfig reads the configuration file, the retry and the timeout have a default when they are not set
+func LoadConfig(path string) (Config, error) {
+	config := Config{
+		Retry:   Retry{Initial: model.Duration{Duration: time.Second}, Max: model.Duration{Duration: time.Minute}},
+		Timeout: model.Duration{Duration: 10 * time.Second},
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("error reading notifications config: %w", err)
+	}
+
+	if err = json.Unmarshal(b, &config); err != nil {
+		return config, fmt.Errorf("error parsing notifications config: %w", err)
+	}
+
+	return config, config.Validate()
+}
+
+// Validate verifies that the events can be stored and delivered
+func (c Config) Validate() error {
+	if c.Outbox == "" {
+		return errors.New("notifications outbox is missing")
+	}
+
+	if len(c.Webhooks) == 0 {
+		return errors.New("notifications need at least one webhook")
+	}
+
+	seen := map[string]bool{}
+
+	for _, w := range c.Webhooks {
+		u, err := url.Parse(w.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook %q is not an http url", w.URL)
+		}
+
+		if seen[w.URL] {
+			return fmt.Errorf("webhook %q is repeated", w.URL)
+		}
+
+		seen[w.URL] = true
+
+		if w.Secret == "" {
+			return fmt.Errorf("webhook %q has no secret", w.URL)
+		}
+
+		for _, t := range w.Events {
+			if t != service.EventCardDeclined && t != service.EventLowLimit {
+				return fmt.Errorf("webhook %q has the unknown event %q", w.URL, t)
+			}
+		}
+	}
+
+	if c.Retry.Initial.Duration <= 0 || c.Retry.Max.Duration < c.Retry.Initial.Duration {
+		return errors.New("retry.initial must be greater than 0 and not greater than retry.max")
+	}
+
+	if c.Timeout.Duration <= 0 {
+		return errors.New("timeout must be greater than 0")
+	}
+
+	return nil
+}
+
+// Sign returns the signature of the body sent at the time, the timestamp is signed too, so the webhook can reject
+// old requests sent again
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+
+	return "t=" + unix + ",v1=" + hex.EncodeToString(mac(secret, unix, body))
+}
+
+// Verify checks the signature header of a request received by a webhook, the timestamp of the signature must be
+// within tolerance of now, in the past or in the future, so a request signed ahead of time can't be sent later
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var unix, signature string
+
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return ErrInvalidSignature
+		}
+
+		switch kv[0] {
+		case "t":
+			unix = kv[1]
+		case "v1":
+			signature = kv[1]
+		}
+	}
+
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, mac(secret, unix, body)) {
+		return ErrInvalidSignature
+	}
+
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > tolerance {
+		return fmt.Errorf("%w: it is older than %s", ErrInvalidSignature, tolerance)
+	}
+
+	if -age > tolerance {
+		return fmt.Errorf("%w: it is more than %s in the future", ErrInvalidSignature, tolerance)
+	}
+
+	return nil
+}
+
+func mac(secret, unix string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(unix + "."))
+	h.Write(body)
+
+	return h.Sum(nil)
+}
+
+// followBatch is the number of authorization events read from the storage at once
+const followBatch = 100
+
+// Notifier follows the authorization events committed in the storage, keeps their notifications in the outbox and
+// delivers them to every webhook in the background. Each webhook receives the events in order and an event is
+// retried until the webhook answers with 2xx
+type Notifier struct {
+	outbox *Outbox
+	events service.EventLog
+	config Config
+	client *http.Client
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	now    func() time.Time
+}
+
+// Start opens the outbox, starts delivering its pending events and following the events of the storage after the
+// offset of the outbox
+func Start(config Config, events service.EventLog) (*Notifier, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	urls := make([]string, 0, len(config.Webhooks))
+	for _, w := range config.Webhooks {
+		urls = append(urls, w.URL)
+	}
+
+	outbox, err := OpenOutbox(config.Outbox, urls)
+	if err != nil {
+		return nil, fmt.Errorf("error opening outbox: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Notifier{
+		outbox: outbox,
+		events: events,
+		config: config,
+		client: &http.Client{Timeout: config.Timeout.Duration},
+		cancel: cancel,
+		now:    time.Now,
+	}
+
+	n.wg.Add(1)
+
+	go n.follow(ctx)
+
+	for _, w := range config.Webhooks {
+		n.wg.Add(1)
+
+		go n.deliver(ctx, w)
+	}
+
+	return n, nil
+}
+
+// Drain waits until every event committed in the storage is read and delivered or the context ends
+func (n *Notifier) Drain(ctx context.Context) error {
+	for {
+		changed := n.outbox.wait()
+		if n.followed() && n.outbox.Pending() == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d events weren't delivered: %w", n.outbox.Pending(), ctx.Err())
+		case <-changed:
+		}
+	}
+}
+
+// followed reports if the outbox has the events of every authorization event committed in the storage
+func (n *Notifier) followed() bool {
+	events, _, err := n.events.Events(n.outbox.Offset(), 1)
+
+	return err == nil && len(events) == 0
+}
+
+// follow appends the notifications of the authorization events to the outbox in the order they were committed,
+// until the context ends. The offset of the outbox is written with the events, so the events are read again
+// from the storage only when they weren't synced
+func (n *Notifier) follow(ctx context.Context) {
+	defer n.wg.Done()
+
+	for ctx.Err() == nil {
+		after := n.outbox.Offset()
+
+		events, committed, err := n.events.Events(after, followBatch)
+
+		var compacted *model.CompactedError
+
+		switch {
+		case errors.As(err, &compacted):
+			log.Errorf("notifications: the events %d to %d were compacted before they were read",
+				after+1, compacted.First-1)
+			n.outbox.skip(compacted.First - 1)
+
+			continue
+		case errors.Is(err, model.ErrOffsetAhead):
+			// the offset belongs to the storage of a previous run, e.g. a server started without a snapshot
+			log.Warnf("notifications: the outbox is at event %d of another storage, reading from the first event", after)
+			n.outbox.skip(0)
+
+			continue
+		case err != nil:
+			log.Errorf("notifications: error reading events: %s", err)
+
+			return
+		}
+
+		if len(events) == 0 {
+			select {
+			case <-ctx.Done():
+			case <-committed:
+			}
+
+			continue
+		}
+
+		notifications := make([]service.Event, 0, len(events))
+
+		for _, e := range events {
+			if notification, ok := n.config.Notifications.Event(e); ok {
+				notifications = append(notifications, notification)
+			}
+		}
+
+		if err = n.outbox.Append(events[len(events)-1].Offset, notifications...); err != nil {
+			log.Errorf("notifications: %s", err)
+
+			return
+		}
+	}
+}
+
+// Close stops the deliveries and closes the outbox, the pending events are delivered when the outbox is opened again
+func (n *Notifier) Close() error {
+	n.cancel()
+	n.wg.Wait()
+
+	return n.outbox.Close()
+}
+
+// deliver sends the events of the outbox to the webhook until the context ends
+func (n *Notifier) deliver(ctx context.Context, w Webhook) {
+	defer n.wg.Done()
+
+	logger := log.WithField("webhook", w.URL)
+
+	for {
+		e, err := n.outbox.next(ctx, w.URL)
+		if err != nil {
+			return
+		}
+
+		if w.accepts(e.Type) && !n.retry(ctx, w, e, logger) {
+			return
+		}
+
+		if err = n.outbox.ack(w.URL, e.ID); err != nil {
+			logger.Errorf("error acknowledging event %s: %s", e.ID, err)
+
+			return
+		}
+	}
+}
+
+// retry sends the event until it is delivered or the attempts are exhausted,
+// it is false when the context ended before
+func (n *Notifier) retry(ctx context.Context, w Webhook, e service.Event, logger *log.Entry) bool {
+	backoff := n.config.Retry.Initial.Duration
+
+	for attempt := 1; ; attempt++ {
+		err := n.send(ctx, w, e)
+		if err == nil {
+			logger.Debugf("event %s delivered after %d attempts", e.ID, attempt)
+
+			return true
+		}
+
+		if ctx.Err() != nil {
+			return false
+		}
+
+		if n.config.Retry.MaxAttempts > 0 && attempt >= n.config.Retry.MaxAttempts {
+			logger.Errorf("event %s discarded after %d attempts: %s", e.ID, attempt, err)
+
+			return true
+		}
+
+		logger.Warnf("error delivering event %s, retrying in %s: %s", e.ID, backoff, err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return false
+		case <-timer.C:
+		}
+
+		if backoff *= 2; backoff > n.config.Retry.Max.Duration {
+			backoff = n.config.Retry.Max.Duration
+		}
+	}
+}
+
+// send posts the event to the webhook, any answer that is not 2xx is an error
+func (n *Notifier) send(ctx context.Context, w Webhook, e service.Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, e.ID)
+	req.Header.Set(HeaderEventType, e.Type)
+	req.Header.Set(HeaderSignature, Sign(w.Secret, n.now(), body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+
+	return nil
+}
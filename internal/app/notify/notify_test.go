@@ -0,0 +1,339 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/app/service"
+	"authorizer/internal/app/storage"
+	"authorizer/internal/app/violations"
+)
+
+// receiver is a webhook that records the events it accepts once, it answers 500 to the first failures requests
+type receiver struct {
+	mu       sync.Mutex
+	secret   string
+	failures int
+	events   []service.Event
+	attempts int
+	invalid  int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attempts++
+
+	body, _ := io.ReadAll(req.Body)
+	if err := Verify(r.secret, req.Header.Get(HeaderSignature), body, time.Now(), time.Minute); err != nil {
+		r.invalid++
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	var e service.Event
+	if err := json.Unmarshal(body, &e); err != nil || e.ID != req.Header.Get(HeaderEventID) {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	// a request sent before a restart can be received after it, the duplicates are discarded by the id
+	for _, received := range r.events {
+		if received.ID == e.ID {
+			return
+		}
+	}
+
+	r.events = append(r.events, e)
+}
+
+func (r *receiver) received() []service.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]service.Event(nil), r.events...)
+}
+
+func newConfig(t *testing.T, webhooks ...Webhook) Config {
+	return Config{
+		Notifications: service.Notifications{
+			Violations: []string{violations.ViolationHighFrequencySmallInterval},
+			LowLimit:   60,
+		},
+		Outbox:   filepath.Join(t.TempDir(), "outbox"),
+		Webhooks: webhooks,
+		Retry: Retry{
+			Initial: model.Duration{Duration: time.Millisecond},
+			Max:     model.Duration{Duration: 5 * time.Millisecond},
+		},
+		Timeout: model.Duration{Duration: time.Second},
+	}
+}
+
+func event(id, eventType string) service.Event {
+	e := service.Event{ID: id, Type: eventType, AccountID: 1, AvailableLimit: 50,
+		Transaction: model.Transaction{Merchant: "Oxxo", Amount: 20, Time: time.Date(2019, 2, 13, 10, 0, 0, 0, time.UTC)}}
+	if eventType == service.EventCardDeclined {
+		e.Violation = violations.ViolationHighFrequencySmallInterval
+	}
+
+	return e
+}
+
+// commit appends the authorization events of the notifications to the storage, the events of other types are
+// approved without crossing the low limit
+func commit(t *testing.T, db *storage.InMemory, events ...service.Event) {
+	uow, err := db.Begin()
+	assert.NoError(t, err)
+
+	for _, e := range events {
+		ae := model.AuthorizationEvent{ID: e.ID, AccountID: e.AccountID, Transaction: e.Transaction,
+			Approved: e.Violation == "", Violations: []string{}, AvailableLimit: e.AvailableLimit}
+
+		switch e.Type {
+		case service.EventCardDeclined:
+			ae.Violations = []string{e.Violation}
+		case service.EventLowLimit:
+		default:
+			ae.AvailableLimit = 500
+		}
+
+		assert.NoError(t, uow.AppendEvent(ae))
+	}
+
+	assert.NoError(t, uow.Commit())
+}
+
+func drain(t *testing.T, n *Notifier) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, n.Drain(ctx))
+}
+
+func TestNotifier(t *testing.T) {
+	fraud := &receiver{secret: "fraud-secret", failures: 2}
+	cardholder := &receiver{secret: "cardholder-secret"}
+	fraudServer, cardholderServer := httptest.NewServer(fraud), httptest.NewServer(cardholder)
+
+	defer fraudServer.Close()
+	defer cardholderServer.Close()
+
+	db := &storage.InMemory{}
+
+	n, err := Start(newConfig(t,
+		Webhook{URL: fraudServer.URL, Secret: fraud.secret, Events: []string{service.EventCardDeclined}},
+		Webhook{URL: cardholderServer.URL, Secret: cardholder.secret}), db)
+	assert.NoError(t, err)
+
+	// the events are read from the storage after they are committed, the approved one is not notified
+	commit(t, db, event("1", service.EventCardDeclined), event("2", service.EventLowLimit))
+	commit(t, db, event("approved", ""), event("3", service.EventCardDeclined))
+
+	drain(t, n)
+	assert.NoError(t, n.Close())
+
+	// the fraud webhook failed twice and only receives the declines, in order
+	assert.Equal(t, []service.Event{event("1", service.EventCardDeclined), event("3", service.EventCardDeclined)},
+		fraud.received())
+	assert.Equal(t, 4, fraud.attempts)
+	assert.Equal(t, []string{"1", "2", "3"}, ids(cardholder.received()))
+	assert.Zero(t, fraud.invalid+cardholder.invalid)
+}
+
+func TestNotifier_outboxSurvivesRestart(t *testing.T) {
+	r := &receiver{secret: "secret", failures: 1000}
+	server := httptest.NewServer(r)
+
+	defer server.Close()
+
+	config := newConfig(t, Webhook{URL: server.URL, Secret: r.secret})
+	db := &storage.InMemory{}
+
+	n, err := Start(config, db)
+	assert.NoError(t, err)
+
+	commit(t, db, event("1", service.EventLowLimit), event("2", service.EventCardDeclined))
+	assert.Eventually(t, func() bool { return n.outbox.Offset() == 2 }, 5*time.Second, time.Millisecond)
+	assert.NoError(t, n.Close())
+	assert.Empty(t, r.received())
+
+	r.mu.Lock()
+	r.failures = 0
+	r.mu.Unlock()
+
+	// the events are delivered when the outbox is opened again, without reading them again from the storage
+	n, err = Start(config, db)
+	assert.NoError(t, err)
+	drain(t, n)
+	assert.NoError(t, n.Close())
+	assert.Equal(t, []string{"1", "2"}, ids(r.received()))
+
+	outbox, err := OpenOutbox(config.Outbox, []string{server.URL})
+	assert.NoError(t, err)
+	assert.Zero(t, outbox.Pending())
+	assert.Equal(t, 2, outbox.Offset())
+	assert.NoError(t, outbox.Close())
+
+	// a new storage starts its offsets again, its events are not taken for the ones already read
+	db = &storage.InMemory{}
+
+	n, err = Start(config, db)
+	assert.NoError(t, err)
+
+	commit(t, db, event("3", service.EventLowLimit))
+	drain(t, n)
+	assert.NoError(t, n.Close())
+	assert.Equal(t, []string{"1", "2", "3"}, ids(r.received()))
+}
+
+func TestNotifier_compactedEvents(t *testing.T) {
+	r := &receiver{secret: "secret"}
+	server := httptest.NewServer(r)
+
+	defer server.Close()
+
+	db := &storage.InMemory{}
+	commit(t, db, event("1", service.EventLowLimit), event("2", service.EventLowLimit))
+
+	_, err := db.Compact(storage.Retention{MaxEvents: 1})
+	assert.NoError(t, err)
+
+	// the first event was removed before it was read, the notifier continues with the first event kept
+	n, err := Start(newConfig(t, Webhook{URL: server.URL, Secret: r.secret}), db)
+	assert.NoError(t, err)
+	drain(t, n)
+	assert.NoError(t, n.Close())
+	assert.Equal(t, []string{"2"}, ids(r.received()))
+}
+
+func TestNotifier_maxAttempts(t *testing.T) {
+	r := &receiver{secret: "secret", failures: 3}
+	server := httptest.NewServer(r)
+
+	defer server.Close()
+
+	config := newConfig(t, Webhook{URL: server.URL, Secret: r.secret})
+	config.Retry.MaxAttempts = 2
+
+	db := &storage.InMemory{}
+
+	n, err := Start(config, db)
+	assert.NoError(t, err)
+
+	commit(t, db, event("1", service.EventLowLimit), event("2", service.EventLowLimit))
+	drain(t, n)
+	assert.NoError(t, n.Close())
+
+	// the first event is discarded after 2 attempts, the second one is delivered in the second attempt
+	assert.Equal(t, []string{"2"}, ids(r.received()))
+	assert.Equal(t, 4, r.attempts)
+}
+
+func TestOutbox_compaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox")
+
+	outbox, err := OpenOutbox(path, []string{"http://fraud"})
+	assert.NoError(t, err)
+
+	outbox.compactAfter = 10
+
+	for i := 0; i < 50; i++ {
+		id := strconv.Itoa(i)
+		assert.NoError(t, outbox.Append(i+1, event(id, service.EventLowLimit)))
+		assert.NoError(t, outbox.ack("http://fraud", id))
+	}
+
+	assert.NoError(t, outbox.Append(51, event("pending", service.EventLowLimit)))
+	assert.NoError(t, outbox.Close())
+
+	// the delivered events are removed from the file while the outbox is open, the pending one is kept
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Less(t, strings.Count(string(b), "\n"), 10)
+
+	outbox, err = OpenOutbox(path, []string{"http://fraud"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, outbox.Pending())
+	assert.Equal(t, 51, outbox.Offset())
+	assert.NoError(t, outbox.Close())
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2019, 2, 13, 10, 0, 0, 0, time.UTC)
+	body := []byte(`{"id":"1"}`)
+	header := Sign("secret", now, body)
+
+	assert.NoError(t, Verify("secret", header, body, now.Add(time.Second), time.Minute))
+	assert.ErrorIs(t, Verify("other", header, body, now, time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", header, []byte(`{"id":"2"}`), now, time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", header, body, now.Add(2*time.Minute), time.Minute), ErrInvalidSignature)
+	assert.NoError(t, Verify("secret", header, body, now.Add(-time.Second), time.Minute))
+	assert.ErrorIs(t, Verify("secret", header, body, now.Add(-2*time.Minute), time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", "v1=abc", body, now, time.Minute), ErrInvalidSignature)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string
+	}{
+		{"valid", func(c *Config) {}, ""},
+		{"no outbox", func(c *Config) { c.Outbox = "" }, "notifications outbox is missing"},
+		{"no webhooks", func(c *Config) { c.Webhooks = nil }, "notifications need at least one webhook"},
+		{"not http", func(c *Config) { c.Webhooks[0].URL = "ftp://fraud" }, `webhook "ftp://fraud" is not an http url`},
+		{"no secret", func(c *Config) { c.Webhooks[0].Secret = "" }, `webhook "http://fraud" has no secret`},
+		{"unknown event", func(c *Config) { c.Webhooks[0].Events = []string{"card-blocked"} },
+			`webhook "http://fraud" has the unknown event "card-blocked"`},
+		{"no backoff", func(c *Config) { c.Retry.Initial.Duration = 0 },
+			"retry.initial must be greater than 0 and not greater than retry.max"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := newConfig(t, Webhook{URL: "http://fraud", Secret: "secret"})
+			tt.modify(&c)
+
+			err := c.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func ids(events []service.Event) []string {
+	result := make([]string, 0, len(events))
+	for _, e := range events {
+		result = append(result, e.ID)
+	}
+
+	return result
+}
@@ -0,0 +1,368 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"authorizer/internal/app/service"
+)
+
+// outboxCompactRecords is the number of records of the file after which it is rewritten when most of them are
+// events delivered to every webhook, so the file doesn't grow while the process runs
+const outboxCompactRecords = 1000
+
+// Outbox keeps the events in a file until every webhook received them, so they are delivered after a crash.
+// Every webhook receives the events in the order they were appended. The file also keeps the offset of the last
+// authorization event of the storage whose events were appended
+type Outbox struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	// records are the lines of the file, it is compacted after compactAfter records
+	records      int
+	compactAfter int
+	// events are the events not delivered to every webhook, events[0] is the event number base
+	events []service.Event
+	base   int
+	// cursors are the number of the next event of every webhook
+	cursors map[string]int
+	offset  int
+	// changed is closed when an event is appended or delivered
+	changed chan struct{}
+}
+
+// outboxRecord is a line of the outbox file, either an event, the delivery of an event to a webhook or the offset
+// of the authorization events appended
+type outboxRecord struct {
+	Event     *service.Event `json:"event,omitempty"`
+	Delivered string         `json:"delivered,omitempty"`
+	Webhook   string         `json:"webhook,omitempty"`
+	Offset    int            `json:"offset,omitempty"`
+}
+
+// OpenOutbox reads the events of the file that weren't delivered to every webhook, the file is created when
+// it doesn't exist. The file is rewritten without the events already delivered
+func OpenOutbox(path string, webhooks []string) (*Outbox, error) {
+	events, delivered, offset, err := readOutbox(path)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Outbox{path: path, compactAfter: outboxCompactRecords, cursors: map[string]int{}, offset: offset,
+		changed: make(chan struct{})}
+
+	for _, url := range webhooks {
+		cursor := 0
+		for cursor < len(events) && delivered[url][events[cursor].ID] {
+			cursor++
+		}
+
+		o.cursors[url] = cursor
+	}
+
+	o.events = events
+	o.trim()
+
+	if err = o.rewrite(); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// readOutbox reads the events of the file with their deliveries and the offset of the last authorization event,
+// the events after the last offset were not synced and are read again from the storage
+func readOutbox(path string) ([]service.Event, map[string]map[string]bool, int, error) {
+	delivered := map[string]map[string]bool{}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, delivered, 0, nil
+	}
+
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer f.Close()
+
+	var (
+		events []service.Event
+		synced int
+		offset int
+	)
+
+	scanner := bufio.NewScanner(f)
+
+	for line := 1; scanner.Scan(); line++ {
+		var r outboxRecord
+		if err = json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// the last line can be incomplete after a crash, its events are read again from the storage
+			if !scanner.Scan() {
+				return events[:synced], delivered, offset, scanner.Err()
+			}
+
+			return nil, nil, 0, fmt.Errorf("invalid outbox record in line %d: %w", line, err)
+		}
+
+		switch {
+		case r.Event != nil:
+			events = append(events, *r.Event)
+		case r.Delivered != "":
+			if delivered[r.Webhook] == nil {
+				delivered[r.Webhook] = map[string]bool{}
+			}
+
+			delivered[r.Webhook][r.Delivered] = true
+		case r.Offset > 0:
+			synced, offset = len(events), r.Offset
+		default:
+			return nil, nil, 0, fmt.Errorf("invalid outbox record in line %d", line)
+		}
+	}
+
+	return events[:synced], delivered, offset, scanner.Err()
+}
+
+// rewrite replaces the file with the pending events and their deliveries, the new file is renamed over the old one
+// and the old one is closed
+func (o *Outbox) rewrite() error {
+	tmp, err := os.CreateTemp(filepath.Dir(o.path), filepath.Base(o.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(w)
+	records := 0
+
+	for i := range o.events {
+		if err = encoder.Encode(outboxRecord{Event: &o.events[i]}); err != nil {
+			tmp.Close()
+
+			return err
+		}
+
+		records++
+	}
+
+	for url, cursor := range o.cursors {
+		for _, e := range o.events[:cursor-o.base] {
+			if err = encoder.Encode(outboxRecord{Delivered: e.ID, Webhook: url}); err != nil {
+				tmp.Close()
+
+				return err
+			}
+
+			records++
+		}
+	}
+
+	if o.offset > 0 {
+		if err = encoder.Encode(outboxRecord{Offset: o.offset}); err != nil {
+			tmp.Close()
+
+			return err
+		}
+
+		records++
+	}
+
+	if err = w.Flush(); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp.Name(), o.path); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(o.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if o.file != nil {
+		o.file.Close()
+	}
+
+	o.file = f
+	o.records = records
+
+	return nil
+}
+
+// Append writes the events followed by the offset of the last authorization event read from the storage, it starts
+// at 1. The events are delivered to the webhooks only after they are synced to the disk
+func (o *Outbox) Append(offset int, events ...service.Event) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	records := make([]outboxRecord, 0, len(events)+1)
+	for i := range events {
+		records = append(records, outboxRecord{Event: &events[i]})
+	}
+
+	if err := o.write(append(records, outboxRecord{Offset: offset})...); err != nil {
+		return fmt.Errorf("error writing events to the outbox: %w", err)
+	}
+
+	o.events = append(o.events, events...)
+	o.offset = offset
+	o.broadcast()
+
+	return nil
+}
+
+// Offset returns the offset of the last authorization event whose events were appended
+func (o *Outbox) Offset() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.offset
+}
+
+// skip moves the offset without appending events, it is written with the next events
+func (o *Outbox) skip(offset int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.offset = offset
+	o.broadcast()
+}
+
+// next waits until there is an event that the webhook hasn't received and returns it
+func (o *Outbox) next(ctx context.Context, webhook string) (service.Event, error) {
+	for {
+		o.mu.Lock()
+		i := o.cursors[webhook] - o.base
+
+		if i < len(o.events) {
+			e := o.events[i]
+			o.mu.Unlock()
+
+			return e, nil
+		}
+
+		changed := o.changed
+		o.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return service.Event{}, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// ack records that the webhook received its next event, the events received by every webhook are forgotten
+func (o *Outbox) ack(webhook, eventID string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err := o.write(outboxRecord{Delivered: eventID, Webhook: webhook}); err != nil {
+		return fmt.Errorf("error writing delivery to the outbox: %w", err)
+	}
+
+	o.cursors[webhook]++
+	o.trim()
+	o.broadcast()
+
+	if o.records >= o.compactAfter && o.records > 2*o.live() {
+		if err := o.rewrite(); err != nil {
+			return fmt.Errorf("error compacting the outbox: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Pending returns the number of events that weren't delivered to every webhook
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.events)
+}
+
+// wait returns a channel that is closed when an event is appended or delivered, or the offset changes
+func (o *Outbox) wait() <-chan struct{} {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.changed
+}
+
+// Close closes the file, the events not delivered are read again by OpenOutbox
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.file.Close()
+}
+
+// write appends the records to the file with a single sync
+func (o *Outbox) write(records ...outboxRecord) error {
+	var b []byte
+
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+
+		b = append(append(b, line...), '\n')
+	}
+
+	if _, err := o.file.Write(b); err != nil {
+		return err
+	}
+
+	o.records += len(records)
+
+	return o.file.Sync()
+}
+
+// trim forgets the events delivered to every webhook
+func (o *Outbox) trim() {
+	min := o.base + len(o.events)
+	for _, cursor := range o.cursors {
+		if cursor < min {
+			min = cursor
+		}
+	}
+
+	o.events = o.events[min-o.base:]
+	o.base = min
+}
+
+// live is the number of records that a rewrite keeps, the pending events, their deliveries and the offset
+func (o *Outbox) live() int {
+	records := len(o.events) + 1
+	for _, cursor := range o.cursors {
+		records += cursor - o.base
+	}
+
+	return records
+}
+
+func (o *Outbox) broadcast() {
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/app/violations"
+)
+
+// defaultDueDays is the number of days to pay a statement when the credit line doesn't set it
+const defaultDueDays = 20
+
+// maxClosingDay is the last closing day that exists in every month
+const maxClosingDay = 28
+
+// maxDueDays keeps the due date of a statement before the close of the next cycle
+const maxDueDays = 27
+
+// ProcessPayment is the input of the payment operation
+type ProcessPayment struct {
+	Payment   model.Payment `json:"payment"`
+	AccountID int           `json:"-"`
+	RequestID string        `json:"requestId,omitempty"`
+}
+
+// ProcessPayment pays the balance of the credit line of an account
+// 1.- Get account information based on the accountID, it must exist and have a credit line
+// 2.- Close the billing cycles that ended before the time of the payment (see bill)
+// 3.- The amount must be positive and can't be more than the balance, the part of the limit used
+// 4.- Restore the available limit and register the payment in the history
+// 5.- The payment counts for the minimum payment of the last statement
+// 6.- If the account was modified after it was read, the steps are repeated as in ProcessTransaction
+func (s *Service) ProcessPayment(p ProcessPayment) (response TransactionResponse, err error) {
+	defer func() { s.metrics.operation("payment", response, err) }()
+
+	logger := requestLogger(p.AccountID, p.RequestID)
+
+	return s.retry(logger, func() (TransactionResponse, error) {
+		return s.processPayment(p, logger)
+	})
+}
+
+// processPayment is a single attempt of ProcessPayment
+func (s *Service) processPayment(p ProcessPayment, logger *log.Entry) (response TransactionResponse, err error) {
+	uow, err := s.storage.Begin()
+	if err != nil {
+		logger.Errorf("error:%s", err)
+
+		return response, err
+	}
+	defer rollback(uow, logger)
+
+	account := uow.GetAccount(p.AccountID)
+	if bill(&account, p.Payment.Time) {
+		if account, err = saveBilled(uow, account, logger); err != nil {
+			return response, err
+		}
+	}
+
+	response.Account = account
+
+	if violation := paymentViolation(account, p.Payment); violation != "" {
+		logger.Errorf("violation:%s", violation)
+
+		response.Violations = []string{violation}
+
+		return response, commit(uow, logger)
+	}
+
+	if account.CreditLine.Statement != nil {
+		account.CreditLine.Statement.Paid += p.Payment.Amount
+	}
+
+	account, err = uow.ExecutePayment(account, p.Payment)
+	if err != nil {
+		logger.Errorf("error:%s", err)
+
+		return response, err
+	}
+
+	if err = uow.Commit(); err != nil {
+		logger.Errorf("error:%s", err)
+
+		return response, err
+	}
+
+	response.Account = account
+	response.Violations = []string{}
+
+	return response, nil
+}
+
+func paymentViolation(a model.Account, p model.Payment) string {
+	switch {
+	case a.Version == 0:
+		return violations.ViolationAccountNotInitialized
+	case a.CreditLine == nil:
+		return violations.ViolationCreditLineNotEnabled
+	case p.Amount <= 0:
+		return violations.ViolationInvalidPaymentAmount
+	case p.Amount > a.CreditLine.Limit-a.AvailableLimit:
+		return violations.ViolationPaymentExceedsBalance
+	}
+
+	return ""
+}
+
+// newCreditLine validates the terms of the credit line of a new account, its limit is the available limit and
+// the state of the cycles starts empty
+func newCreditLine(terms *model.CreditLine, limit int) (*model.CreditLine, error) {
+	if terms == nil {
+		return nil, nil
+	}
+
+	credit := &model.CreditLine{
+		Limit:                 limit,
+		ClosingDay:            terms.ClosingDay,
+		DueDays:               terms.DueDays,
+		MinimumPaymentPercent: terms.MinimumPaymentPercent,
+		MinimumPayment:        terms.MinimumPayment,
+	}
+
+	if credit.DueDays == 0 {
+		credit.DueDays = defaultDueDays
+	}
+
+	switch {
+	case credit.ClosingDay < 1 || credit.ClosingDay > maxClosingDay:
+		return nil, errors.New("creditLine.closingDay must be between 1 and 28")
+	case credit.DueDays < 1 || credit.DueDays > maxDueDays:
+		return nil, errors.New("creditLine.dueDays must be between 1 and 27")
+	case credit.MinimumPaymentPercent < 0 || credit.MinimumPaymentPercent > 100:
+		return nil, errors.New("creditLine.minimumPaymentPercent must be between 0 and 100")
+	case credit.MinimumPayment < 0:
+		return nil, errors.New("creditLine.minimumPayment must not be negative")
+	}
+
+	return credit, nil
+}
+
+// bill moves the credit line of the account to the time of an operation: the cycles that ended before t are closed
+// with the balance of the account and the last statement is flagged as late when its due date passed without the
+// minimum payment. The first operation with time starts the first cycle, the operations without time don't move it.
+// The operations are expected in time order, the ones older than the last close are part of the open cycle.
+// It reports if the credit line changed, so it is stored whatever the decision of the operation is (see saveBilled)
+func bill(a *model.Account, t time.Time) bool {
+	if a.CreditLine == nil || t.IsZero() {
+		return false
+	}
+
+	credit := a.CreditLine.Copy()
+	a.CreditLine = credit
+
+	if credit.NextClose == nil {
+		nextClose := closeAfter(t, credit.ClosingDay)
+		credit.NextClose = &nextClose
+
+		return true
+	}
+
+	changed := false
+
+	for {
+		// the due date is always before the next close, so the statement is checked first
+		if st := credit.Statement; st != nil && !st.Late && st.Paid < st.MinimumPayment && !t.Before(st.DueDate) {
+			st.Late = true
+			credit.LatePayments++
+			changed = true
+		}
+
+		if t.Before(*credit.NextClose) {
+			return changed
+		}
+
+		changed = true
+
+		closedAt := *credit.NextClose
+		balance := credit.Limit - a.AvailableLimit
+
+		credit.Statement = &model.BillingStatement{
+			ClosedAt:       closedAt,
+			Balance:        balance,
+			MinimumPayment: minimumPayment(credit, balance),
+			DueDate:        closedAt.AddDate(0, 0, credit.DueDays),
+		}
+
+		nextClose := closedAt.AddDate(0, 1, 0)
+		credit.NextClose = &nextClose
+	}
+}
+
+// saveBilled stores the account whose credit line was moved by bill, the cycles closed and the late payments are
+// kept even when the operation is declined. It returns the account read again with the version of the write
+func saveBilled(uow UnitOfWork, account model.Account, logger *log.Entry) (model.Account, error) {
+	if err := uow.UpdateAccount(account); err != nil {
+		logger.Errorf("error billing account:%s", err)
+
+		return account, err
+	}
+
+	return uow.GetAccount(account.Id), nil
+}
+
+// closeAfter is the first closing day after t
+func closeAfter(t time.Time, closingDay int) time.Time {
+	utc := t.UTC()
+
+	closeAt := time.Date(utc.Year(), utc.Month(), closingDay, 0, 0, 0, 0, time.UTC)
+	if !closeAt.After(utc) {
+		closeAt = closeAt.AddDate(0, 1, 0)
+	}
+
+	return closeAt
+}
+
+// minimumPayment is the percent of the balance rounded up, at least the minimum payment of the credit line
+// and at most the balance
+func minimumPayment(credit *model.CreditLine, balance int) int {
+	if balance <= 0 {
+		return 0
+	}
+
+	minimum := (balance*credit.MinimumPaymentPercent + 99) / 100
+	if minimum < credit.MinimumPayment {
+		minimum = credit.MinimumPayment
+	}
+
+	if minimum > balance {
+		minimum = balance
+	}
+
+	return minimum
+}
+
+// withoutPayments removes the payments from the history, they are not analyzed by the business rules
+func withoutPayments(transactions []model.Transaction) []model.Transaction {
+	purchases := make([]model.Transaction, 0, len(transactions))
+
+	for _, t := range transactions {
+		if t.Merchant != model.PaymentMerchant {
+			purchases = append(purchases, t)
+		}
+	}
+
+	return purchases
+}
@@ -0,0 +1,331 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/model"
+)
+
+// creditStorage keeps a single account and its history, the writes change them as the storage does
+type creditStorage struct {
+	historyStorage
+	account model.Account
+}
+
+func (c *creditStorage) Begin() (UnitOfWork, error) {
+	return nopUnitOfWork{c}, nil
+}
+
+func (c *creditStorage) CreateAccount(a model.Account) error {
+	a.Version = 1
+	a.CreditLine = a.CreditLine.Copy()
+	c.account = a
+
+	return nil
+}
+
+func (c *creditStorage) GetAccount(aID int) model.Account {
+	if aID != c.account.Id {
+		return model.Account{}
+	}
+
+	account := c.account
+	account.CreditLine = c.account.CreditLine.Copy()
+
+	return account
+}
+
+func (c *creditStorage) UpdateAccount(a model.Account) error {
+	a.CreditLine = a.CreditLine.Copy()
+	c.account = a
+
+	return nil
+}
+
+func (c *creditStorage) ExecuteTransaction(a model.Account, t model.Transaction) (model.Account, error) {
+	a.AvailableLimit -= t.Amount
+	a.Version++
+	c.transactions = append(c.transactions, t)
+
+	return a, c.CreateAccount(a)
+}
+
+func (c *creditStorage) ExecutePayment(a model.Account, p model.Payment) (model.Account, error) {
+	return c.ExecuteTransaction(a, model.Transaction{Merchant: model.PaymentMerchant, Amount: -p.Amount, Time: p.Time})
+}
+
+func newCreditService(t *testing.T) (*Service, *creditStorage) {
+	c := &creditStorage{}
+	s := New(c)
+
+	response, err := s.CreateAccount(CreateAccount{Account: model.Account{
+		Id:             1,
+		ActiveCard:     true,
+		AvailableLimit: 1000,
+		CreditLine:     &model.CreditLine{ClosingDay: 10, MinimumPaymentPercent: 10, MinimumPayment: 50},
+	}})
+	assert.NoError(t, err)
+	assert.Empty(t, response.Violations)
+
+	return s, c
+}
+
+func TestService_CreateAccount_creditLine(t *testing.T) {
+	nextClose := time.Date(2019, 2, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		creditLine     *model.CreditLine
+		wantCreditLine *model.CreditLine
+		wantViolations []string
+	}{
+		{"withoutCreditLine", nil, nil, []string{}},
+		{"defaults",
+			&model.CreditLine{ClosingDay: 10},
+			&model.CreditLine{Limit: 1000, ClosingDay: 10, DueDays: 20},
+			[]string{},
+		},
+		{"stateIsIgnored",
+			&model.CreditLine{Limit: 5, ClosingDay: 10, DueDays: 5, NextClose: &nextClose, LatePayments: 3},
+			&model.CreditLine{Limit: 1000, ClosingDay: 10, DueDays: 5},
+			[]string{},
+		},
+		{"invalidClosingDay", &model.CreditLine{ClosingDay: 31}, nil, []string{"invalid-credit-line"}},
+		{"invalidDueDays", &model.CreditLine{ClosingDay: 1, DueDays: 40}, nil, []string{"invalid-credit-line"}},
+		{"invalidPercent",
+			&model.CreditLine{ClosingDay: 1, MinimumPaymentPercent: 101},
+			nil,
+			[]string{"invalid-credit-line"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := &creditStorage{}
+			s := New(c)
+
+			response, err := s.CreateAccount(CreateAccount{Account: model.Account{
+				Id:             1,
+				ActiveCard:     true,
+				AvailableLimit: 1000,
+				CreditLine:     tt.creditLine,
+			}})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantViolations, response.Violations)
+			assert.Equal(t, tt.wantCreditLine, c.account.CreditLine)
+
+			if len(tt.wantViolations) == 0 {
+				assert.Equal(t, tt.wantCreditLine, response.Account.CreditLine)
+			}
+		})
+	}
+}
+
+func TestService_ProcessPayment(t *testing.T) {
+	at := time.Date(2019, 2, 13, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		payment        ProcessPayment
+		wantViolations []string
+		wantLimit      int
+	}{
+		{"paid", ProcessPayment{Payment: model.Payment{Amount: 150, Time: at}, AccountID: 1}, []string{}, 950},
+		{"wholeBalance", ProcessPayment{Payment: model.Payment{Amount: 200, Time: at}, AccountID: 1}, []string{}, 1000},
+		{"exceedsBalance",
+			ProcessPayment{Payment: model.Payment{Amount: 201, Time: at}, AccountID: 1},
+			[]string{"payment-exceeds-balance"},
+			800,
+		},
+		{"invalidAmount",
+			ProcessPayment{Payment: model.Payment{Amount: 0, Time: at}, AccountID: 1},
+			[]string{"invalid-payment-amount"},
+			800,
+		},
+		{"accountNotFound",
+			ProcessPayment{Payment: model.Payment{Amount: 10, Time: at}, AccountID: 2},
+			[]string{"account-not-initialized"},
+			0,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newCreditService(t)
+
+			response, err := s.ProcessTransaction(ProcessTransaction{
+				Transaction: model.Transaction{Merchant: "Oxxo", Amount: 200, Time: at.Add(-time.Hour)},
+				AccountID:   1,
+			})
+			assert.NoError(t, err)
+			assert.Empty(t, response.Violations)
+
+			response, err = s.ProcessPayment(tt.payment)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantViolations, response.Violations)
+			assert.Equal(t, tt.wantLimit, response.Account.AvailableLimit)
+
+			if tt.payment.AccountID == 1 {
+				assert.Equal(t, tt.wantLimit, c.account.AvailableLimit)
+			}
+		})
+	}
+
+	t.Run("withoutCreditLine", func(t *testing.T) {
+		s := New(&creditStorage{})
+
+		_, err := s.CreateAccount(CreateAccount{Account: model.Account{Id: 1, ActiveCard: true, AvailableLimit: 100}})
+		assert.NoError(t, err)
+
+		response, err := s.ProcessPayment(ProcessPayment{Payment: model.Payment{Amount: 10, Time: at}, AccountID: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"credit-line-not-enabled"}, response.Violations)
+	})
+}
+
+func TestService_billingCycles(t *testing.T) {
+	s, c := newCreditService(t)
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2019, month, d, 12, 0, 0, 0, time.UTC)
+	}
+	closeOf := func(month time.Month) time.Time {
+		return time.Date(2019, month, 10, 0, 0, 0, 0, time.UTC)
+	}
+
+	purchase := func(amount int, at time.Time) TransactionResponse {
+		response, err := s.ProcessTransaction(ProcessTransaction{
+			Transaction: model.Transaction{Merchant: "Oxxo", Amount: amount, Time: at},
+			AccountID:   1,
+		})
+		assert.NoError(t, err)
+		assert.Empty(t, response.Violations)
+
+		return response
+	}
+
+	pay := func(amount int, at time.Time) TransactionResponse {
+		response, err := s.ProcessPayment(ProcessPayment{Payment: model.Payment{Amount: amount, Time: at}, AccountID: 1})
+		assert.NoError(t, err)
+		assert.Empty(t, response.Violations)
+
+		return response
+	}
+
+	// the first transaction starts the cycle that closes on the next closing day
+	credit := purchase(300, day(time.January, 5)).Account.CreditLine
+	assert.Equal(t, closeOf(time.January), *credit.NextClose)
+	assert.Nil(t, credit.Statement)
+
+	credit = purchase(200, day(time.January, 12)).Account.CreditLine
+	assert.Equal(t, &model.BillingStatement{
+		ClosedAt:       closeOf(time.January),
+		Balance:        300,
+		MinimumPayment: 50,
+		DueDate:        time.Date(2019, 1, 30, 0, 0, 0, 0, time.UTC),
+	}, credit.Statement)
+	assert.Equal(t, closeOf(time.February), *credit.NextClose)
+
+	credit = pay(100, day(time.January, 20)).Account.CreditLine
+	assert.Equal(t, 100, credit.Statement.Paid)
+
+	// the minimum payment of January was paid
+	credit = purchase(100, day(time.February, 11)).Account.CreditLine
+	assert.Equal(t, 400, credit.Statement.Balance)
+	assert.Equal(t, 0, credit.LatePayments)
+
+	// the payment arrives after the due date of February
+	response := pay(10, day(time.March, 5))
+	assert.True(t, response.Account.CreditLine.Statement.Late)
+	assert.Equal(t, 1, response.Account.CreditLine.LatePayments)
+	assert.Equal(t, 510, response.Account.AvailableLimit)
+
+	// March closes without payments and April is still open
+	credit = purchase(10, day(time.April, 15)).Account.CreditLine
+	assert.Equal(t, 2, credit.LatePayments)
+	assert.Equal(t, closeOf(time.April), credit.Statement.ClosedAt)
+	assert.Equal(t, 490, credit.Statement.Balance)
+	assert.False(t, credit.Statement.Late)
+	assert.Equal(t, closeOf(time.May), *credit.NextClose)
+
+	assert.Equal(t, credit, c.account.CreditLine)
+	assert.Equal(t, 500, c.account.AvailableLimit)
+}
+
+func TestService_billingCycles_rejected(t *testing.T) {
+	s, c := newCreditService(t)
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2019, month, d, 12, 0, 0, 0, time.UTC)
+	}
+
+	response, err := s.ProcessTransaction(ProcessTransaction{
+		Transaction: model.Transaction{Merchant: "Oxxo", Amount: 300, Time: day(time.January, 5)},
+		AccountID:   1,
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, response.Violations)
+
+	// the declined transaction closes January anyway
+	response, err = s.ProcessTransaction(ProcessTransaction{
+		Transaction: model.Transaction{Merchant: "Apple", Amount: 5000, Time: day(time.January, 12)},
+		AccountID:   1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"insufficient-limit"}, response.Violations)
+	assert.Equal(t, 300, c.account.CreditLine.Statement.Balance)
+
+	// the rejected payment arrives after the due date, the statement is late anyway
+	response, err = s.ProcessPayment(ProcessPayment{Payment: model.Payment{Amount: 1000, Time: day(time.February, 1)},
+		AccountID: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"payment-exceeds-balance"}, response.Violations)
+	assert.True(t, c.account.CreditLine.Statement.Late)
+	assert.Equal(t, 1, c.account.CreditLine.LatePayments)
+	assert.Equal(t, response.Account, c.account)
+}
+
+func TestService_ProcessTransaction_reservedMerchant(t *testing.T) {
+	s, c := newCreditService(t)
+	at := time.Date(2019, 2, 13, 10, 0, 0, 0, time.UTC)
+
+	for _, merchant := range []string{model.PaymentMerchant, model.InitialMerchant} {
+		response, err := s.ProcessTransaction(ProcessTransaction{
+			Transaction: model.Transaction{Merchant: merchant, Amount: 10, Time: at},
+			AccountID:   1,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"reserved-merchant"}, response.Violations)
+	}
+
+	assert.Equal(t, 1000, c.account.AvailableLimit)
+	assert.Empty(t, c.transactions)
+}
+
+func TestService_ProcessTransaction_paymentsAreNotAnalyzed(t *testing.T) {
+	s, _ := newCreditService(t)
+	at := time.Date(2019, 2, 13, 10, 0, 0, 0, time.UTC)
+
+	_, err := s.ProcessTransaction(ProcessTransaction{
+		Transaction: model.Transaction{Merchant: "Oxxo", Amount: 100, Time: at},
+		AccountID:   1,
+	})
+	assert.NoError(t, err)
+
+	_, err = s.ProcessPayment(ProcessPayment{
+		Payment:   model.Payment{Amount: 100, Time: at.Add(30 * time.Second)},
+		AccountID: 1,
+	})
+	assert.NoError(t, err)
+
+	// the payment would be the third transaction in 2 minutes
+	response, err := s.ProcessTransaction(ProcessTransaction{
+		Transaction: model.Transaction{Merchant: "Walmart", Amount: 100, Time: at.Add(time.Minute)},
+		AccountID:   1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, response.Violations)
+}
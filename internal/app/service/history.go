@@ -0,0 +1,323 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"authorizer/internal/app/model"
+)
+
+// Outcomes of the transactions of the history
+const (
+	OutcomeApproved = "approved"
+	OutcomeDeclined = "declined"
+)
+
+// Periods of the statements
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 1000
+	// maxStatements is the number of periods of a statement query
+	maxStatements = 1000
+)
+
+// ErrInvalidQuery is returned when the filters of a history query or a statement can't be applied
+var ErrInvalidQuery = errors.New("invalid query")
+
+// DailyTotalsStorage is implemented by the storages that compact the old transactions of the history
+// into daily totals
+type DailyTotalsStorage interface {
+	GetDailyTotals(accountID int) []model.DailyTotal
+}
+
+// HistoryQuery selects the transactions of an account, the zero value of every filter selects all of them
+type HistoryQuery struct {
+	AccountID int
+	// From and To are the range of the transaction time, From is included and To is not
+	From time.Time
+	To   time.Time
+	// Merchant must be equal to the merchant of the transaction
+	Merchant string
+	// Outcome is OutcomeApproved or OutcomeDeclined
+	Outcome string
+	// Offset is the number of transactions skipped, the NextOffset of the previous page
+	Offset int
+	// Limit is the size of the page, 50 by default
+	Limit int
+}
+
+// HistoryEntry is a transaction of the history with its decision
+type HistoryEntry struct {
+	model.Transaction
+	Outcome    string   `json:"outcome"`
+	Violations []string `json:"violations"`
+}
+
+// HistoryPage is a page of the transactions selected by a HistoryQuery in time order
+type HistoryPage struct {
+	Transactions []HistoryEntry `json:"transactions"`
+	// Total is the number of transactions selected by the filters in every page
+	Total int `json:"total"`
+	// NextOffset is the Offset of the next page, 0 when this is the last one
+	NextOffset int `json:"nextOffset,omitempty"`
+}
+
+// StatementQuery selects the periods of the statements of an account
+type StatementQuery struct {
+	AccountID int
+	// From and To are the range of the statements, From is included and To is not
+	From time.Time
+	To   time.Time
+	// Period splits the range in a statement per PeriodDay, PeriodWeek or PeriodMonth in UTC,
+	// the range is a single statement when it is empty
+	Period string
+}
+
+// Statement is the summary of the approved transactions of an account in a period
+type Statement struct {
+	AccountID    int            `json:"accountId"`
+	From         time.Time      `json:"from"`
+	To           time.Time      `json:"to"`
+	OpeningLimit int            `json:"openingLimit"`
+	Transactions []HistoryEntry `json:"transactions"`
+	// Purchases is the amount of the transactions that reduced the limit
+	Purchases int `json:"purchases"`
+	// Refunds is the amount of the transactions with a negative amount, they restored the limit
+	Refunds int `json:"refunds"`
+	// Payments is the amount paid to the credit line, the payments restored the limit as well
+	Payments     int `json:"payments"`
+	ClosingLimit int `json:"closingLimit"`
+}
+
+// QueryHistory returns a page of the transactions of the account selected by the query.
+// It fails with model.ErrAccountNotFound when the account doesn't exist and ErrInvalidQuery when the filters
+// can't be applied
+func (s *Service) QueryHistory(q HistoryQuery) (HistoryPage, error) {
+	if err := q.validate(); err != nil {
+		return HistoryPage{}, err
+	}
+
+	_, history, err := s.history(q.AccountID)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+
+	selected := make([]HistoryEntry, 0)
+
+	for _, e := range history {
+		if q.matches(e) {
+			selected = append(selected, e)
+		}
+	}
+
+	limit := q.Limit
+	if limit == 0 {
+		limit = defaultHistoryLimit
+	}
+
+	page := HistoryPage{Transactions: []HistoryEntry{}, Total: len(selected)}
+
+	if q.Offset < len(selected) {
+		end := len(selected)
+		if q.Offset+limit < end {
+			end = q.Offset + limit
+			page.NextOffset = end
+		}
+
+		page.Transactions = selected[q.Offset:end]
+	}
+
+	return page, nil
+}
+
+// Statements returns a statement for every period of the query. The limits are computed from the current limit
+// of the account and the transactions after the period, so it fails with ErrInvalidQuery when From is before
+// the oldest transaction kept by the compaction of the history
+func (s *Service) Statements(q StatementQuery) ([]Statement, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+
+	account, history, err := s.history(q.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if since := s.retainedSince(q.AccountID, history); q.From.Before(since) {
+		return nil, fmt.Errorf("%w: the history before %s was compacted, from must not be before it",
+			ErrInvalidQuery, since.Format(time.RFC3339))
+	}
+
+	statements := make([]Statement, 0)
+
+	for from := q.From; from.Before(q.To); {
+		if len(statements) == maxStatements {
+			return nil, fmt.Errorf("%w: the range has more than %d periods", ErrInvalidQuery, maxStatements)
+		}
+
+		to := nextPeriod(from, q.Period)
+		if q.Period == "" || to.After(q.To) {
+			to = q.To
+		}
+
+		st := Statement{AccountID: q.AccountID, From: from, To: to, Transactions: []HistoryEntry{}}
+		st.OpeningLimit = limitAt(account.AvailableLimit, history, from)
+		st.ClosingLimit = limitAt(account.AvailableLimit, history, to)
+
+		for _, e := range history {
+			if e.Outcome != OutcomeApproved || e.Time.Before(from) || !e.Time.Before(to) {
+				continue
+			}
+
+			st.Transactions = append(st.Transactions, e)
+
+			switch {
+			case e.Merchant == model.PaymentMerchant:
+				st.Payments -= e.Amount
+			case e.Amount < 0:
+				st.Refunds -= e.Amount
+			default:
+				st.Purchases += e.Amount
+			}
+		}
+
+		statements = append(statements, st)
+		from = to
+	}
+
+	return statements, nil
+}
+
+// history reads the account, its transactions and its declined attempts in time order, the transaction added when
+// the account was created is not part of them
+func (s *Service) history(accountID int) (model.Account, []HistoryEntry, error) {
+	logger := requestLogger(accountID, "")
+
+	uow, err := s.storage.Begin()
+	if err != nil {
+		logger.Errorf("error:%s", err)
+
+		return model.Account{}, nil, err
+	}
+	defer rollback(uow, logger)
+
+	account := uow.GetAccount(accountID)
+	if account.Version == 0 {
+		return account, nil, fmt.Errorf("account %d: %w", accountID, model.ErrAccountNotFound)
+	}
+
+	transactions := uow.GetTransactions(accountID)
+	history := make([]HistoryEntry, 0, len(transactions))
+
+	for i, t := range transactions {
+		if i == 0 && t.Merchant == model.InitialMerchant {
+			continue
+		}
+
+		history = append(history, HistoryEntry{Transaction: t, Outcome: OutcomeApproved, Violations: []string{}})
+	}
+
+	for _, d := range uow.GetDeclined(accountID) {
+		history = append(history, HistoryEntry{
+			Transaction: d.Transaction,
+			Outcome:     OutcomeDeclined,
+			Violations:  d.Violations,
+		})
+	}
+
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Time.Before(history[j].Time)
+	})
+
+	return account, history, nil
+}
+
+// retainedSince returns the time since which the history of the account is complete, the transactions before it
+// may have been moved to the daily totals. It is zero when the history was never compacted
+func (s *Service) retainedSince(accountID int, history []HistoryEntry) time.Time {
+	if s.totals == nil {
+		return time.Time{}
+	}
+
+	totals := s.totals.GetDailyTotals(accountID)
+	if len(totals) == 0 {
+		return time.Time{}
+	}
+
+	if len(history) > 0 {
+		return history[0].Time
+	}
+
+	// every transaction was compacted, the totals end with the day of the last one
+	return totals[len(totals)-1].Day.AddDate(0, 0, 1)
+}
+
+// limitAt is the available limit before the transactions executed at t or after it
+func limitAt(availableLimit int, history []HistoryEntry, t time.Time) int {
+	for _, e := range history {
+		if e.Outcome == OutcomeApproved && !e.Time.Before(t) {
+			availableLimit += e.Amount
+		}
+	}
+
+	return availableLimit
+}
+
+func nextPeriod(t time.Time, period string) time.Time {
+	switch period {
+	case PeriodDay:
+		return t.AddDate(0, 0, 1)
+	case PeriodWeek:
+		return t.AddDate(0, 0, 7)
+	default:
+		return t.AddDate(0, 1, 0)
+	}
+}
+
+func (q HistoryQuery) validate() error {
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+
+	if q.Outcome != "" && q.Outcome != OutcomeApproved && q.Outcome != OutcomeDeclined {
+		return fmt.Errorf("%w: outcome must be %s or %s", ErrInvalidQuery, OutcomeApproved, OutcomeDeclined)
+	}
+
+	if q.Offset < 0 {
+		return fmt.Errorf("%w: offset must not be negative", ErrInvalidQuery)
+	}
+
+	if q.Limit < 0 || q.Limit > maxHistoryLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, maxHistoryLimit)
+	}
+
+	return nil
+}
+
+func (q HistoryQuery) matches(e HistoryEntry) bool {
+	return (q.From.IsZero() || !e.Time.Before(q.From)) &&
+		(q.To.IsZero() || e.Time.Before(q.To)) &&
+		(q.Merchant == "" || e.Merchant == q.Merchant) &&
+		(q.Outcome == "" || e.Outcome == q.Outcome)
+}
+
+func (q StatementQuery) validate() error {
+	if q.From.IsZero() || q.To.IsZero() || !q.From.Before(q.To) {
+		return fmt.Errorf("%w: the statement needs a range, from must be before to", ErrInvalidQuery)
+	}
+
+	switch q.Period {
+	case "", PeriodDay, PeriodWeek, PeriodMonth:
+		return nil
+	default:
+		return fmt.Errorf("%w: period must be %s, %s or %s", ErrInvalidQuery, PeriodDay, PeriodWeek, PeriodMonth)
+	}
+}
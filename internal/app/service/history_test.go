@@ -0,0 +1,241 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/app/service/rules"
+)
+
+// ledgerStorage is a historyStorage with an account whose limit is the result of its history
+type ledgerStorage struct {
+	historyStorage
+	account model.Account
+	totals  []model.DailyTotal
+}
+
+func (l *ledgerStorage) GetDailyTotals(accountID int) []model.DailyTotal {
+	return l.totals
+}
+
+func (l *ledgerStorage) GetAccount(aID int) model.Account {
+	if aID == l.account.Id {
+		return l.account
+	}
+
+	return model.Account{}
+}
+
+func (l *ledgerStorage) Begin() (UnitOfWork, error) {
+	return nopUnitOfWork{l}, nil
+}
+
+func newLedger() *ledgerStorage {
+	at := func(day, hour int) time.Time {
+		return time.Date(2019, 2, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	return &ledgerStorage{
+		historyStorage: historyStorage{transactions: []model.Transaction{
+			{Merchant: model.InitialMerchant, Amount: 1000, Time: time.Now()},
+			{Merchant: "Oxxo", Amount: 100, Time: at(1, 10)},
+			{Merchant: "Walmart", Amount: 200, Time: at(1, 12)},
+			// processed late, the history is sorted by time
+			{Merchant: "Oxxo", Amount: 50, Time: at(1, 11)},
+			{Merchant: "Walmart", Amount: -30, Time: at(2, 9)},
+			{Merchant: "Oxxo", Amount: 80, Time: at(3, 9)},
+		}},
+		account: model.Account{Id: 1, ActiveCard: true, AvailableLimit: 600, Version: 6},
+	}
+}
+
+func merchants(entries []HistoryEntry) []string {
+	got := make([]string, 0, len(entries))
+	for _, e := range entries {
+		got = append(got, e.Merchant)
+	}
+
+	return got
+}
+
+func TestService_QueryHistory(t *testing.T) {
+	s := New(newLedger())
+	day2 := time.Date(2019, 2, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		query         HistoryQuery
+		wantMerchants []string
+		wantTotal     int
+		wantNext      int
+		wantErr       error
+	}{
+		{"all", HistoryQuery{AccountID: 1}, []string{"Oxxo", "Oxxo", "Walmart", "Walmart", "Oxxo"}, 5, 0, nil},
+		{"from", HistoryQuery{AccountID: 1, From: day2}, []string{"Walmart", "Oxxo"}, 2, 0, nil},
+		{"to", HistoryQuery{AccountID: 1, To: day2}, []string{"Oxxo", "Oxxo", "Walmart"}, 3, 0, nil},
+		{"merchant", HistoryQuery{AccountID: 1, Merchant: "Walmart"}, []string{"Walmart", "Walmart"}, 2, 0, nil},
+		{"approved", HistoryQuery{AccountID: 1, Outcome: OutcomeApproved, Limit: 1}, []string{"Oxxo"}, 5, 1, nil},
+		{"declined", HistoryQuery{AccountID: 1, Outcome: OutcomeDeclined}, []string{}, 0, 0, nil},
+		{"firstPage", HistoryQuery{AccountID: 1, Limit: 2}, []string{"Oxxo", "Oxxo"}, 5, 2, nil},
+		{"lastPage", HistoryQuery{AccountID: 1, Offset: 4, Limit: 2}, []string{"Oxxo"}, 5, 0, nil},
+		{"afterLastPage", HistoryQuery{AccountID: 1, Offset: 9}, []string{}, 5, 0, nil},
+		{"notFound", HistoryQuery{AccountID: 2}, nil, 0, 0, model.ErrAccountNotFound},
+		{"invalidRange", HistoryQuery{AccountID: 1, From: day2, To: day2}, nil, 0, 0, ErrInvalidQuery},
+		{"invalidOutcome", HistoryQuery{AccountID: 1, Outcome: "maybe"}, nil, 0, 0, ErrInvalidQuery},
+		{"invalidLimit", HistoryQuery{AccountID: 1, Limit: 1001}, nil, 0, 0, ErrInvalidQuery},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.QueryHistory(tt.query)
+			assert.True(t, errors.Is(err, tt.wantErr), "error %v", err)
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			assert.Equal(t, tt.wantMerchants, merchants(got.Transactions))
+			assert.Equal(t, tt.wantTotal, got.Total)
+			assert.Equal(t, tt.wantNext, got.NextOffset)
+		})
+	}
+}
+
+func TestService_Statements(t *testing.T) {
+	s := New(newLedger())
+	day := func(d int) time.Time {
+		return time.Date(2019, 2, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	statements, err := s.Statements(StatementQuery{AccountID: 1, From: day(1), To: day(4), Period: PeriodDay})
+	assert.NoError(t, err)
+	assert.Len(t, statements, 3)
+
+	type summary struct {
+		opening, purchases, refunds, closing int
+		merchants                            []string
+	}
+
+	got := make([]summary, 0, len(statements))
+	for _, st := range statements {
+		got = append(got, summary{st.OpeningLimit, st.Purchases, st.Refunds, st.ClosingLimit, merchants(st.Transactions)})
+	}
+
+	assert.Equal(t, []summary{
+		{1000, 350, 0, 650, []string{"Oxxo", "Oxxo", "Walmart"}},
+		{650, 0, 30, 680, []string{"Walmart"}},
+		{680, 80, 0, 600, []string{"Oxxo"}},
+	}, got)
+	assert.Equal(t, day(2), statements[1].From)
+	assert.Equal(t, day(3), statements[1].To)
+
+	statements, err = s.Statements(StatementQuery{AccountID: 1, From: day(1), To: day(10), Period: PeriodMonth})
+	assert.NoError(t, err)
+	assert.Len(t, statements, 1)
+	assert.Equal(t, day(10), statements[0].To, "the last period ends with the range")
+
+	t.Run("payments", func(t *testing.T) {
+		ledger := newLedger()
+		ledger.transactions = append(ledger.transactions,
+			model.Transaction{Merchant: model.PaymentMerchant, Amount: -100, Time: day(3).Add(12 * time.Hour)})
+		ledger.account.AvailableLimit = 700
+
+		statements, err := New(ledger).Statements(StatementQuery{AccountID: 1, From: day(3), To: day(4), Period: PeriodDay})
+		assert.NoError(t, err)
+		assert.Len(t, statements, 1)
+		assert.Equal(t, 80, statements[0].Purchases)
+		assert.Equal(t, 0, statements[0].Refunds)
+		assert.Equal(t, 100, statements[0].Payments)
+		assert.Equal(t, 680, statements[0].OpeningLimit)
+		assert.Equal(t, 700, statements[0].ClosingLimit)
+	})
+	assert.Equal(t, 600, statements[0].ClosingLimit)
+
+	t.Run("compacted", func(t *testing.T) {
+		ledger := newLedger()
+		ledger.transactions = ledger.transactions[4:]
+		ledger.totals = []model.DailyTotal{{Day: day(1), Transactions: 3, Amount: 350}}
+		s := New(ledger)
+
+		_, err := s.Statements(StatementQuery{AccountID: 1, From: day(1), To: day(4), Period: PeriodDay})
+		assert.True(t, errors.Is(err, ErrInvalidQuery))
+		assert.Contains(t, err.Error(), "the history before 2019-02-02T09:00:00Z was compacted")
+
+		statements, err := s.Statements(StatementQuery{AccountID: 1, From: day(2).Add(9 * time.Hour), To: day(4)})
+		assert.NoError(t, err)
+		assert.Len(t, statements, 1)
+		assert.Equal(t, 650, statements[0].OpeningLimit)
+
+		// without transactions the totals tell until when the history was compacted
+		ledger.transactions = nil
+
+		_, err = s.Statements(StatementQuery{AccountID: 1, From: day(1), To: day(4)})
+		assert.True(t, errors.Is(err, ErrInvalidQuery))
+
+		_, err = s.Statements(StatementQuery{AccountID: 1, From: day(2), To: day(4)})
+		assert.NoError(t, err)
+	})
+
+	_, err = s.Statements(StatementQuery{AccountID: 1, From: day(1)})
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+
+	_, err = s.Statements(StatementQuery{AccountID: 1, From: day(1), To: day(2), Period: "year"})
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+
+	_, err = s.Statements(StatementQuery{AccountID: 1, From: day(1), To: day(1).AddDate(5, 0, 0), Period: PeriodDay})
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+
+	_, err = s.Statements(StatementQuery{AccountID: 3, From: day(1), To: day(2)})
+	assert.True(t, errors.Is(err, model.ErrAccountNotFound))
+}
+
+func TestService_ProcessTransaction_declinedAttempts(t *testing.T) {
+	config := rules.DefaultConfig()
+	config.DeclinedAttempts.Enabled = true
+	config.DeclinedAttempts.MaxAttempts = 2
+
+	l := newLedger()
+	s := New(l, WithRulesConfig(config))
+	at := func(hour, minute int) time.Time {
+		return time.Date(2019, 2, 3, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		tx             model.Transaction
+		wantViolations []string
+	}{
+		{model.Transaction{Merchant: "Apple", Amount: 5000, Time: at(10, 0)}, []string{"insufficient-limit"}},
+		{model.Transaction{Merchant: "Apple", Amount: 4000, Time: at(10, 1)}, []string{"insufficient-limit"}},
+		// the attempts declined by the rule are counted too, the card is locked until the window is quiet
+		{model.Transaction{Merchant: "Apple", Amount: 10, Time: at(10, 2)}, []string{"too-many-declined-attempts"}},
+		{model.Transaction{Merchant: "Apple", Amount: 10, Time: at(10, 30)}, []string{}},
+	}
+
+	for _, tt := range tests {
+		got, err := s.ProcessTransaction(ProcessTransaction{Transaction: tt.tx, AccountID: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, tt.wantViolations, got.Violations, tt.tx.Time)
+	}
+
+	page, err := s.QueryHistory(HistoryQuery{AccountID: 1, Outcome: OutcomeDeclined})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, page.Total)
+
+	violations := make([]string, 0, len(page.Transactions))
+	for _, e := range page.Transactions {
+		assert.Equal(t, OutcomeDeclined, e.Outcome)
+		violations = append(violations, e.Violations...)
+	}
+
+	assert.Equal(t, []string{"insufficient-limit", "insufficient-limit", "too-many-declined-attempts"}, violations)
+
+	// the statements only contain the approved transactions
+	statements, err := s.Statements(StatementQuery{AccountID: 1, From: at(0, 0), To: at(23, 0)})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Oxxo"}, merchants(statements[0].Transactions))
+}
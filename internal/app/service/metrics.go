@@ -0,0 +1,235 @@
+package service
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/common/metrics"
+)
+
+// Metrics contains the instruments updated by the service, the zero value of *Metrics (nil) doesn't record anything
+type Metrics struct {
+	registry        prometheus.Registerer
+	operations      *prometheus.CounterVec
+	violations      *prometheus.CounterVec
+	processDuration prometheus.Histogram
+	storageDuration *prometheus.HistogramVec
+}
+
+// StatsStorage is implemented by the storages that can report their size
+type StatsStorage interface {
+	Stats() (accounts int, transactions int)
+}
+
+// NewMetrics registers the metrics of the service in the registry
+func NewMetrics(registry prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		registry: registry,
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "authorizer_operations_total",
+			Help: "Operations processed by type and outcome (approved, declined or error).",
+		}, []string{"operation", "outcome"}),
+		violations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "authorizer_rule_violations_total",
+			Help: "Violations raised by the business rules.",
+		}, []string{"rule", "violation"}),
+		processDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "authorizer_process_transaction_duration_seconds",
+			Help:    "Time spent processing a transaction.",
+			Buckets: metrics.DefaultBuckets(),
+		}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "authorizer_storage_duration_seconds",
+			Help:    "Time spent in each storage call.",
+			Buckets: metrics.DefaultBuckets(),
+		}, []string{"method"}),
+	}
+
+	registry.MustRegister(m.operations, m.violations, m.processDuration, m.storageDuration)
+
+	return m
+}
+
+// WithMetrics records the operations, violations and latencies of the service, and the size of the storage
+// when it implements StatsStorage. The storage is instrumented by New after every option, so the order of the
+// options doesn't matter
+func WithMetrics(m *Metrics) Option {
+	return func(s *Service) {
+		s.metrics = m
+	}
+}
+
+// instrument registers the size of the storage and returns the storage that measures the latency of its calls
+func (m *Metrics) instrument(storage Storage) Storage {
+	if stats, ok := storage.(StatsStorage); ok {
+		m.registry.MustRegister(
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "authorizer_accounts",
+				Help: "Accounts stored.",
+			}, func() float64 {
+				accounts, _ := stats.Stats()
+
+				return float64(accounts)
+			}),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "authorizer_history_transactions",
+				Help: "Transactions stored in the history.",
+			}, func() float64 {
+				_, transactions := stats.Stats()
+
+				return float64(transactions)
+			}))
+	}
+
+	return &instrumentedStorage{
+		instrumentedRepository: instrumentedRepository{repository: storage, metrics: m},
+		storage:                storage,
+	}
+}
+
+// Violation counts a violation raised by a rule, it implements rules.Recorder
+func (m *Metrics) Violation(rule, violation string) {
+	m.violations.WithLabelValues(rule, violation).Inc()
+}
+
+// operation counts an operation by its outcome
+func (m *Metrics) operation(operation string, response TransactionResponse, err error) {
+	if m == nil {
+		return
+	}
+
+	outcome := "approved"
+
+	switch {
+	case err != nil:
+		outcome = "error"
+	case len(response.Violations) > 0:
+		outcome = "declined"
+	}
+
+	m.operations.WithLabelValues(operation, outcome).Inc()
+}
+
+func (m *Metrics) observeProcess(start time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.processDuration.Observe(time.Since(start).Seconds())
+}
+
+// instrumentedStorage measures the latency of every call to the storage and to its units of work
+type instrumentedStorage struct {
+	instrumentedRepository
+	storage Storage
+}
+
+// instrumentedUnitOfWork measures the latency of every call to a unit of work
+type instrumentedUnitOfWork struct {
+	instrumentedRepository
+	unit UnitOfWork
+	// committed skips the latency of the Rollback deferred after a Commit
+	committed bool
+}
+
+type instrumentedRepository struct {
+	repository Repository
+	metrics    *Metrics
+}
+
+func (ir *instrumentedRepository) observe(method string, start time.Time) {
+	ir.metrics.storageDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+func (ir *instrumentedRepository) CreateAccount(a model.Account) error {
+	defer ir.observe("CreateAccount", time.Now())
+
+	return ir.repository.CreateAccount(a)
+}
+
+func (ir *instrumentedRepository) GetAccount(aID int) model.Account {
+	defer ir.observe("GetAccount", time.Now())
+
+	return ir.repository.GetAccount(aID)
+}
+
+func (ir *instrumentedRepository) ExecuteTransaction(a model.Account, t model.Transaction) (model.Account, error) {
+	defer ir.observe("ExecuteTransaction", time.Now())
+
+	return ir.repository.ExecuteTransaction(a, t)
+}
+
+func (ir *instrumentedRepository) ExecutePayment(a model.Account, p model.Payment) (model.Account, error) {
+	defer ir.observe("ExecutePayment", time.Now())
+
+	return ir.repository.ExecutePayment(a, p)
+}
+
+func (ir *instrumentedRepository) UpdateAccount(a model.Account) error {
+	defer ir.observe("UpdateAccount", time.Now())
+
+	return ir.repository.UpdateAccount(a)
+}
+
+func (ir *instrumentedRepository) GetTransactions(accountID int) []model.Transaction {
+	defer ir.observe("GetTransactions", time.Now())
+
+	return ir.repository.GetTransactions(accountID)
+}
+
+func (ir *instrumentedRepository) RecordDeclined(accountID int, d model.DeclinedTransaction) error {
+	defer ir.observe("RecordDeclined", time.Now())
+
+	return ir.repository.RecordDeclined(accountID, d)
+}
+
+func (ir *instrumentedRepository) GetDeclined(accountID int) []model.DeclinedTransaction {
+	defer ir.observe("GetDeclined", time.Now())
+
+	return ir.repository.GetDeclined(accountID)
+}
+
+func (is *instrumentedStorage) Begin() (UnitOfWork, error) {
+	defer is.observe("Begin", time.Now())
+
+	unit, err := is.storage.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	return &instrumentedUnitOfWork{
+		instrumentedRepository: instrumentedRepository{repository: unit, metrics: is.metrics},
+		unit:                   unit,
+	}, nil
+}
+
+func (is *instrumentedStorage) Close() error {
+	return is.storage.Close()
+}
+
+func (iu *instrumentedUnitOfWork) AppendEvent(e model.AuthorizationEvent) error {
+	defer iu.observe("AppendEvent", time.Now())
+
+	return iu.unit.AppendEvent(e)
+}
+
+func (iu *instrumentedUnitOfWork) Commit() error {
+	defer iu.observe("Commit", time.Now())
+
+	err := iu.unit.Commit()
+	iu.committed = err == nil
+
+	return err
+}
+
+func (iu *instrumentedUnitOfWork) Rollback() error {
+	if iu.committed {
+		return iu.unit.Rollback()
+	}
+
+	defer iu.observe("Rollback", time.Now())
+
+	return iu.unit.Rollback()
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/common/metrics"
+)
+
+// sampleCount returns the number of values observed by a histogram
+func sampleCount(t *testing.T, o prometheus.Observer) uint64 {
+	m := &dto.Metric{}
+	assert.NoError(t, o.(prometheus.Metric).Write(m))
+
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestMetrics_operation(t *testing.T) {
+	m := NewMetrics(metrics.NewRegistry())
+
+	m.operation("transaction", TransactionResponse{Violations: []string{}}, nil)
+	m.operation("transaction", TransactionResponse{Violations: []string{"insufficient-limit"}}, nil)
+	m.operation("account", TransactionResponse{}, errors.New("storage error"))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.operations.WithLabelValues("transaction", "approved")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.operations.WithLabelValues("transaction", "declined")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.operations.WithLabelValues("account", "error")))
+
+	var nilMetrics *Metrics
+
+	assert.NotPanics(t, func() { nilMetrics.operation("transaction", TransactionResponse{}, nil) })
+}
+
+func TestService_WithMetrics(t *testing.T) {
+	m := NewMetrics(metrics.NewRegistry())
+	s := New(&mockStorage{}, WithMetrics(m))
+
+	_, err := s.ProcessTransaction(ProcessTransaction{
+		Transaction: model.Transaction{Merchant: "uno", Amount: 10, Time: time.Now()},
+		AccountID:   1,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.operations.WithLabelValues("transaction", "declined")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.violations.WithLabelValues("isActive", "card-not-active")))
+	assert.Equal(t, uint64(1), sampleCount(t, m.processDuration))
+	assert.Equal(t, uint64(1), sampleCount(t, m.storageDuration.WithLabelValues("GetAccount")))
+	assert.Equal(t, uint64(1), sampleCount(t, m.storageDuration.WithLabelValues("GetTransactions")))
+}
+
+// statsStorage reports the size of the storage
+type statsStorage struct {
+	mockStorage
+}
+
+func (statsStorage) Stats() (int, int) {
+	return 2, 5
+}
+
+func TestService_WithMetrics_anyOrder(t *testing.T) {
+	want := `# HELP authorizer_accounts Accounts stored.
+# TYPE authorizer_accounts gauge
+authorizer_accounts 2
+# HELP authorizer_history_transactions Transactions stored in the history.
+# TYPE authorizer_history_transactions gauge
+authorizer_history_transactions 5
+`
+
+	for _, withMetricsFirst := range []bool{true, false} {
+		registry := metrics.NewRegistry()
+		m := NewMetrics(registry)
+
+		opts := []Option{WithMetrics(m), WithExplain(false)}
+		if !withMetricsFirst {
+			opts = []Option{WithExplain(false), WithMetrics(m)}
+		}
+
+		s := New(&statsStorage{}, opts...)
+
+		_, err := s.ProcessTransaction(ProcessTransaction{
+			Transaction: model.Transaction{Merchant: "uno", Amount: 10, Time: time.Now()},
+			AccountID:   1,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), sampleCount(t, m.storageDuration.WithLabelValues("GetAccount")))
+		assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(want),
+			"authorizer_accounts", "authorizer_history_transactions"))
+	}
+}
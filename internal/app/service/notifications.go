@@ -0,0 +1,71 @@
+package service
+
+import "authorizer/internal/app/model"
+
+// Types of the notifications of the authorization events
+const (
+	// EventCardDeclined is sent when a transaction is declined with one of Notifications.Violations
+	EventCardDeclined = "card-declined"
+	// EventLowLimit is sent when an approved transaction leaves the available limit below Notifications.LowLimit
+	EventLowLimit = "low-limit"
+)
+
+// Event is a decision that the cardholder or the fraud team must know about
+type Event struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	AccountID int    `json:"accountId"`
+	RequestID string `json:"requestId,omitempty"`
+	// Transaction is the one that caused the event, its time is the time of the event
+	Transaction    model.Transaction `json:"transaction"`
+	Violation      string            `json:"violation,omitempty"`
+	AvailableLimit int               `json:"availableLimit"`
+}
+
+// Notifications selects the authorization events that are notified
+type Notifications struct {
+	// Violations are the violations of the declined transactions that are notified
+	Violations []string `json:"violations"`
+	// LowLimit notifies the transaction that leaves the available limit below it, only once until the limit
+	// is above it again. 0 disables the event
+	LowLimit int `json:"lowLimit"`
+}
+
+// Event returns the notification of the authorization event, it is false when the event is not notified.
+// The notification has the id of the authorization event, so a webhook can discard the ones delivered twice
+func (n Notifications) Event(ae model.AuthorizationEvent) (Event, bool) {
+	e := Event{
+		ID:             ae.ID,
+		AccountID:      ae.AccountID,
+		RequestID:      ae.RequestID,
+		Transaction:    ae.Transaction,
+		AvailableLimit: ae.AvailableLimit,
+	}
+
+	switch {
+	case !ae.Approved && len(ae.Violations) > 0 && n.notifies(ae.Violations[0]):
+		e.Type = EventCardDeclined
+		e.Violation = ae.Violations[0]
+	case ae.Approved && n.crossesLowLimit(ae.AvailableLimit, ae.Transaction.Amount):
+		e.Type = EventLowLimit
+	default:
+		return e, false
+	}
+
+	return e, true
+}
+
+func (n Notifications) notifies(violation string) bool {
+	for _, v := range n.Violations {
+		if v == violation {
+			return true
+		}
+	}
+
+	return false
+}
+
+// crossesLowLimit reports if the transaction approved left the limit below LowLimit when it was not before it
+func (n Notifications) crossesLowLimit(availableLimit, amount int) bool {
+	return n.LowLimit > 0 && availableLimit < n.LowLimit && availableLimit+amount >= n.LowLimit
+}
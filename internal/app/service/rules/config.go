@@ -0,0 +1,173 @@
+package rules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"authorizer/internal/app/model"
+)
+
+// Config contains the parameters of the configurable business rules,
+// the fixed rules (isActive, sufficientLimit, doubleTransaction and highFrequency) don't need any
+type Config struct {
+	// Version identifies the rule set that took a decision, when the file doesn't set it
+	// LoadConfig uses the beginning of the sha256 of the file
+	Version          string                 `json:"version,omitempty"`
+	CardTesting      CardTestingConfig      `json:"cardTesting"`
+	ImpossibleTravel ImpossibleTravelConfig `json:"impossibleTravel"`
+	DeclinedAttempts DeclinedAttemptsConfig `json:"declinedAttempts"`
+}
+
+// CardTestingConfig contains the thresholds used to detect card-testing attacks,
+// a burst of low-value transactions across many distinct merchants within a window
+type CardTestingConfig struct {
+	Enabled bool `json:"enabled"`
+	// MaxAmount is the highest amount considered a low-value transaction
+	MaxAmount int `json:"maxAmount"`
+	// MinTransactions is the number of low-value transactions (current one included) needed to raise the violation
+	MinTransactions int `json:"minTransactions"`
+	// MinMerchants is the number of distinct merchants those transactions must be spread across
+	MinMerchants int            `json:"minMerchants"`
+	Window       model.Duration `json:"window"`
+	// BlockCard deactivates the card in storage when the violation is raised
+	BlockCard bool `json:"blockCard"`
+}
+
+// ImpossibleTravelConfig contains the maximum speed a person can travel between two transactions
+type ImpossibleTravelConfig struct {
+	Enabled     bool    `json:"enabled"`
+	MaxSpeedKmh float64 `json:"maxSpeedKmh"`
+}
+
+// DeclinedAttemptsConfig contains the number of declined attempts within a window that declines every following
+// transaction, the attempts declined by this rule are counted too so the card stays blocked until the window is quiet
+type DeclinedAttemptsConfig struct {
+	Enabled bool `json:"enabled"`
+	// MaxAttempts is the number of past declined attempts within the window that raises the violation
+	MaxAttempts int            `json:"maxAttempts"`
+	Window      model.Duration `json:"window"`
+}
+
+// versionLength is the number of hex characters of the hash used as version
+const versionLength = 12
+
+// DefaultVersion is the version of DefaultConfig, so the decisions taken without a rules file are stamped too
+const DefaultVersion = "default"
+
+// DefaultConfig returns the configuration used when no other configuration is provided
+func DefaultConfig() Config {
+	return Config{
+		Version: DefaultVersion,
+		CardTesting: CardTestingConfig{
+			Enabled:         true,
+			MaxAmount:       5,
+			MinTransactions: 5,
+			MinMerchants:    3,
+			Window:          model.Duration{Duration: 10 * time.Minute},
+			BlockCard:       false,
+		},
+		ImpossibleTravel: ImpossibleTravelConfig{
+			Enabled:     true,
+			MaxSpeedKmh: 1000,
+		},
+		DeclinedAttempts: DeclinedAttemptsConfig{
+			Enabled:     false,
+			MaxAttempts: 3,
+			Window:      model.Duration{Duration: 10 * time.Minute},
+		},
+	}
+}
+
+// LoadConfig reads a json configuration file, the fields missing in the file keep their default value
+func LoadConfig(path string) (Config, error) {
+	// the version of a file is its own, the one of the defaults is not kept
+	config := DefaultConfig()
+	config.Version = ""
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("error reading rules config: %w", err)
+	}
+
+	if err = json.Unmarshal(b, &config); err != nil {
+		return config, fmt.Errorf("error parsing rules config: %w", err)
+	}
+
+	if err = config.Validate(); err != nil {
+		return config, err
+	}
+
+	if config.Version == "" {
+		sum := sha256.Sum256(b)
+		config.Version = hex.EncodeToString(sum[:])[:versionLength]
+	}
+
+	return config, nil
+}
+
+// Validate verifies that the thresholds of the enabled rules make sense
+func (c Config) Validate() error {
+	if err := c.CardTesting.validate(); err != nil {
+		return err
+	}
+
+	if c.ImpossibleTravel.Enabled && c.ImpossibleTravel.MaxSpeedKmh <= 0 {
+		return fmt.Errorf("impossibleTravel.maxSpeedKmh must be greater than 0")
+	}
+
+	return c.DeclinedAttempts.validate()
+}
+
+// MaxWindow returns the longest period of history analyzed by the enabled rules, without the overrides of the
+// accounts. A history horizon shorter than it would remove transactions the rules still need
+func (c Config) MaxWindow() time.Duration {
+	window := defaultWindow
+
+	if c.CardTesting.Enabled && c.CardTesting.Window.Duration > window {
+		window = c.CardTesting.Window.Duration
+	}
+
+	if c.DeclinedAttempts.Enabled && c.DeclinedAttempts.Window.Duration > window {
+		window = c.DeclinedAttempts.Window.Duration
+	}
+
+	return window
+}
+
+func (ct CardTestingConfig) validate() error {
+	if !ct.Enabled {
+		return nil
+	}
+
+	switch {
+	case ct.MaxAmount <= 0:
+		return fmt.Errorf("cardTesting.maxAmount must be greater than 0")
+	case ct.MinTransactions < 2:
+		return fmt.Errorf("cardTesting.minTransactions must be at least 2")
+	case ct.MinMerchants < 2 || ct.MinMerchants > ct.MinTransactions:
+		return fmt.Errorf("cardTesting.minMerchants must be between 2 and minTransactions")
+	case ct.Window.Duration <= 0:
+		return fmt.Errorf("cardTesting.window must be greater than 0")
+	}
+
+	return nil
+}
+
+func (da DeclinedAttemptsConfig) validate() error {
+	if !da.Enabled {
+		return nil
+	}
+
+	switch {
+	case da.MaxAttempts <= 0:
+		return fmt.Errorf("declinedAttempts.maxAttempts must be greater than 0")
+	case da.Window.Duration <= 0:
+		return fmt.Errorf("declinedAttempts.window must be greater than 0")
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/model"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    func() Config
+		wantErr bool
+	}{
+		{"defaults",
+			`{}`,
+			func() Config {
+				c := DefaultConfig()
+				c.Version = "44136fa355b3"
+
+				return c
+			},
+			false,
+		},
+		{"override",
+			`{"version": "v2", "cardTesting": {"maxAmount": 2, "window": "5m", "blockCard": true}}`,
+			func() Config {
+				c := DefaultConfig()
+				c.Version = "v2"
+				c.CardTesting.MaxAmount = 2
+				c.CardTesting.Window.Duration = 5 * time.Minute
+				c.CardTesting.BlockCard = true
+
+				return c
+			},
+			false,
+		},
+		{"invalidThreshold",
+			`{"cardTesting": {"minMerchants": 10}}`,
+			nil,
+			true,
+		},
+		{"invalidSpeed",
+			`{"impossibleTravel": {"maxSpeedKmh": 0}}`,
+			nil,
+			true,
+		},
+		{"invalidAttempts",
+			`{"declinedAttempts": {"enabled": true, "maxAttempts": 0}}`,
+			nil,
+			true,
+		},
+		{"invalidJson",
+			`{"cardTesting": `,
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			assert.NoError(t, os.WriteFile(path, []byte(tt.content), 0600))
+
+			got, err := LoadConfig(path)
+			if tt.wantErr {
+				assert.Error(t, err)
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want(), got)
+		})
+	}
+}
+
+func TestLoadConfig_missingFile(t *testing.T) {
+	_, err := LoadConfig(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestDefaultConfig(t *testing.T) {
+	config := DefaultConfig()
+	assert.Equal(t, DefaultVersion, config.Version)
+	assert.NoError(t, config.Validate())
+}
+
+func TestConfig_MaxWindow(t *testing.T) {
+	config := DefaultConfig()
+	assert.Equal(t, 10*time.Minute, config.MaxWindow())
+
+	config.DeclinedAttempts.Enabled = true
+	config.DeclinedAttempts.Window = model.Duration{Duration: time.Hour}
+	assert.Equal(t, time.Hour, config.MaxWindow())
+
+	config.CardTesting.Enabled = false
+	config.DeclinedAttempts.Enabled = false
+	assert.Equal(t, defaultWindow, config.MaxWindow())
+}
@@ -2,6 +2,8 @@ package rules
 
 import (
 	"math"
+	"strconv"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 
@@ -13,92 +15,303 @@ import (
 type BusinessRule struct {
 	Transaction      model.Transaction
 	PastTransactions []model.Transaction
-	Account          model.Account
+	// DeclinedTransactions are the past attempts of the account that were declined, only declinedAttempts uses them
+	DeclinedTransactions []model.Transaction
+	Account              model.Account
+	Config               Config
+	// Explain executes every rule, even after a violation, and records a Trace for each one of them in Traces
+	Explain bool
+	Traces  []Trace
+	// Logger contains the fields of the request, the standard logger is used when it is not set
+	Logger *log.Entry
+	// Recorder is optional, it receives every violation found
+	Recorder Recorder
 }
 
-// ExecuteRules lists and executes all the business rules
+// ExecuteRules lists and executes all the business rules, the first violation found is the one returned
 // new Business Rules must be added in here in order to be executed
 func (br *BusinessRule) ExecuteRules() (bool, string) {
-	response, violation := br.isActive()
-	if !response {
-		return response, violation
+	businessRules := []func() (bool, string){
+		br.isActive,
+		br.declinedAttempts,
+		br.sufficientLimit,
+		br.homeCountry,
+		br.doubleTransaction,
+		br.highFrequency,
+		br.cardTesting,
+		br.impossibleTravel,
 	}
 
-	response, violation = br.sufficientLimit()
-	if !response {
-		return response, violation
+	for _, rule := range businessRules {
+		response, violation := rule()
+		if !response && !br.Explain {
+			return response, violation
+		}
 	}
 
-	response, violation = br.doubleTransaction()
-	if !response {
-		return response, violation
+	for _, trace := range br.Traces {
+		if !trace.Passed {
+			return false, trace.Violation
+		}
 	}
 
-	response, violation = br.highFrequency()
-	if !response {
-		return response, violation
+	return true, ""
+}
+
+func (br *BusinessRule) logger() *log.Entry {
+	if br.Logger == nil {
+		return log.WithField("accountId", br.Account.Id)
 	}
 
-	return true, ""
+	return br.Logger
 }
 
 // isActive verifies that your account has an active card
 func (br *BusinessRule) isActive() (bool, string) {
+	params := map[string]string{"activeCard": strconv.FormatBool(br.Account.ActiveCard)}
+
 	if !br.Account.ActiveCard {
-		log.Errorf("violation:%s id:%d", violations.ViolationCardNotActive, br.Account.Id)
-		return false, violations.ViolationCardNotActive
+		br.logger().Errorf("violation:%s", violations.ViolationCardNotActive)
+		return br.fail(RuleIsActive, violations.ViolationCardNotActive, params, nil)
 	}
 
-	return true, ""
+	return br.pass(RuleIsActive, params)
+}
+
+// declinedAttempts counts the declined attempts of the account within the window of the transaction, when there are
+// maxAttempts (or the threshold of the account) of them the transaction is declined too
+func (br *BusinessRule) declinedAttempts() (bool, string) {
+	config := br.Config.DeclinedAttempts
+	if !config.Enabled || !br.enabled(RuleDeclinedAttempts) {
+		return br.skip(RuleDeclinedAttempts)
+	}
+
+	window := br.window(RuleDeclinedAttempts, config.Window.Duration)
+	maxAttempts := br.threshold(RuleDeclinedAttempts, config.MaxAttempts)
+	params := map[string]string{"window": window.String(), "maxAttempts": strconv.Itoa(maxAttempts)}
+
+	var conflicts []model.Transaction
+
+	for _, declinedTx := range br.DeclinedTransactions {
+		if math.Abs(br.Transaction.Time.Sub(declinedTx.Time).Minutes()) < window.Minutes() {
+			conflicts = append(conflicts, declinedTx)
+		}
+	}
+
+	if len(conflicts) >= maxAttempts {
+		br.logger().Errorf("violation:%s", violations.ViolationTooManyDeclinedAttempts)
+
+		return br.fail(RuleDeclinedAttempts, violations.ViolationTooManyDeclinedAttempts, params, conflicts)
+	}
+
+	return br.pass(RuleDeclinedAttempts, params)
 }
 
 // sufficientLimit verifies that your account has enough available limit
 // to execute the transaction
 func (br *BusinessRule) sufficientLimit() (bool, string) {
+	params := map[string]string{
+		"availableLimit": strconv.Itoa(br.Account.AvailableLimit),
+		"amount":         strconv.Itoa(br.Transaction.Amount),
+	}
+
 	if (br.Account.AvailableLimit - br.Transaction.Amount) < 0 {
-		log.Errorf("violation:%s id:%d", violations.ViolationInsufficientLimit, br.Account.Id)
+		br.logger().Errorf("violation:%s", violations.ViolationInsufficientLimit)
 
-		return false, violations.ViolationInsufficientLimit
+		return br.fail(RuleSufficientLimit, violations.ViolationInsufficientLimit, params, nil)
 	}
 
-	return true, ""
+	return br.pass(RuleSufficientLimit, params)
+}
+
+// homeCountry verifies that the transaction was executed in the home country of the account,
+// accounts without a home country and transactions without a country are not restricted
+func (br *BusinessRule) homeCountry() (bool, string) {
+	if !br.enabled(RuleHomeCountry) {
+		return br.skip(RuleHomeCountry)
+	}
+
+	params := map[string]string{"homeCountry": br.Account.HomeCountry, "country": br.Transaction.Country}
+
+	if br.Account.HomeCountry == "" || br.Transaction.Country == "" {
+		return br.pass(RuleHomeCountry, params)
+	}
+
+	if !strings.EqualFold(br.Account.HomeCountry, br.Transaction.Country) {
+		br.logger().Errorf("violation:%s", violations.ViolationOutsideHomeCountry)
+
+		return br.fail(RuleHomeCountry, violations.ViolationOutsideHomeCountry, params, nil)
+	}
+
+	return br.pass(RuleHomeCountry, params)
 }
 
 // doubleTransaction compares current transaction time against every other transaction trying to find one transactions
-// within 2 minutes and with the same amount and merchant
+// within 2 minutes (or the window of the account) and with the same amount and merchant
 func (br *BusinessRule) doubleTransaction() (bool, string) {
-	if len(br.PastTransactions) > 0 {
-		for _, pastTx := range br.PastTransactions {
-			if br.Transaction.Amount == pastTx.Amount &&
-				br.Transaction.Merchant == pastTx.Merchant &&
-				math.Abs(br.Transaction.Time.Sub(pastTx.Time).Minutes()) < 2 {
-				log.Errorf("violation:%s id:%d", violations.ViolationDoubledTransaction, br.Account.Id)
-
-				return false, violations.ViolationDoubledTransaction
-			}
+	if !br.enabled(RuleDoubleTransaction) {
+		return br.skip(RuleDoubleTransaction)
+	}
+
+	window := br.window(RuleDoubleTransaction, defaultWindow)
+	params := map[string]string{"window": window.String()}
+
+	var conflicts []model.Transaction
+
+	for _, pastTx := range br.PastTransactions {
+		if br.Transaction.Amount == pastTx.Amount &&
+			br.Transaction.Merchant == pastTx.Merchant &&
+			math.Abs(br.Transaction.Time.Sub(pastTx.Time).Minutes()) < window.Minutes() {
+			conflicts = append(conflicts, pastTx)
 		}
 	}
 
-	return true, ""
+	if len(conflicts) > 0 {
+		br.logger().Errorf("violation:%s", violations.ViolationDoubledTransaction)
+
+		return br.fail(RuleDoubleTransaction, violations.ViolationDoubledTransaction, params, conflicts)
+	}
+
+	return br.pass(RuleDoubleTransaction, params)
 }
 
 // highFrequency compares current transaction time against every other transaction trying to find
-// two other transactions within 2 minutes
+// two other transactions within 2 minutes, the account can override both the window and the number of transactions
 func (br *BusinessRule) highFrequency() (bool, string) {
-	countInPeriod := 0
-
-	if len(br.PastTransactions) > 0 {
-		for _, pastTx := range br.PastTransactions {
-			if math.Abs(br.Transaction.Time.Sub(pastTx.Time).Minutes()) < 2 {
-				countInPeriod++
-				if countInPeriod == 2 {
-					log.Errorf("violation:%s id:%d", violations.ViolationHighFrequencySmallInterval, br.Account.Id)
-
-					return false, violations.ViolationHighFrequencySmallInterval
-				}
-			}
+	if !br.enabled(RuleHighFrequency) {
+		return br.skip(RuleHighFrequency)
+	}
+
+	window := br.window(RuleHighFrequency, defaultWindow)
+	threshold := br.threshold(RuleHighFrequency, defaultHighFrequencyThreshold)
+	params := map[string]string{"window": window.String(), "threshold": strconv.Itoa(threshold)}
+
+	var conflicts []model.Transaction
+
+	for _, pastTx := range br.PastTransactions {
+		if math.Abs(br.Transaction.Time.Sub(pastTx.Time).Minutes()) < window.Minutes() {
+			conflicts = append(conflicts, pastTx)
 		}
 	}
 
-	return true, ""
+	if len(conflicts) >= threshold-1 {
+		br.logger().Errorf("violation:%s", violations.ViolationHighFrequencySmallInterval)
+
+		return br.fail(RuleHighFrequency, violations.ViolationHighFrequencySmallInterval, params, conflicts)
+	}
+
+	return br.pass(RuleHighFrequency, params)
+}
+
+// cardTesting looks for a burst of low-value transactions spread across several distinct merchants
+// within the configured window, the current transaction is counted as part of the burst.
+// The initial transaction of the account is not a probe, a low limit doesn't bring a new account closer to a decline
+func (br *BusinessRule) cardTesting() (bool, string) {
+	config := br.Config.CardTesting
+	if !config.Enabled || !br.enabled(RuleCardTesting) {
+		return br.skip(RuleCardTesting)
+	}
+
+	window := br.window(RuleCardTesting, config.Window.Duration)
+	minTransactions := br.threshold(RuleCardTesting, config.MinTransactions)
+	params := map[string]string{
+		"window":          window.String(),
+		"maxAmount":       strconv.Itoa(config.MaxAmount),
+		"minTransactions": strconv.Itoa(minTransactions),
+		"minMerchants":    strconv.Itoa(config.MinMerchants),
+	}
+
+	if br.Transaction.Amount > config.MaxAmount {
+		return br.pass(RuleCardTesting, params)
+	}
+
+	var conflicts []model.Transaction
+
+	merchants := map[string]bool{br.Transaction.Merchant: true}
+
+	for _, pastTx := range br.PastTransactions {
+		if pastTx.Merchant != model.InitialMerchant && pastTx.Amount <= config.MaxAmount &&
+			math.Abs(br.Transaction.Time.Sub(pastTx.Time).Minutes()) < window.Minutes() {
+			conflicts = append(conflicts, pastTx)
+			merchants[pastTx.Merchant] = true
+		}
+	}
+
+	if len(conflicts)+1 >= minTransactions && len(merchants) >= config.MinMerchants {
+		br.logger().Errorf("violation:%s", violations.ViolationCardTestingSuspected)
+
+		return br.fail(RuleCardTesting, violations.ViolationCardTestingSuspected, params, conflicts)
+	}
+
+	return br.pass(RuleCardTesting, params)
+}
+
+// impossibleTravel takes the latest previous transaction with coordinates and computes the speed needed to travel
+// between both places, if it exceeds the configured speed the card is being used in two places at the same time.
+// Places closer than minTravelKm are the same place, so the jitter of the GPS doesn't decline two swipes at once
+func (br *BusinessRule) impossibleTravel() (bool, string) {
+	config := br.Config.ImpossibleTravel
+	if !config.Enabled || !br.enabled(RuleImpossibleTravel) {
+		return br.skip(RuleImpossibleTravel)
+	}
+
+	maxSpeed := config.MaxSpeedKmh
+	if threshold := br.threshold(RuleImpossibleTravel, 0); threshold > 0 {
+		maxSpeed = float64(threshold)
+	}
+
+	params := map[string]string{"maxSpeedKmh": strconv.FormatFloat(maxSpeed, 'f', -1, 64)}
+
+	if br.Transaction.Coordinates == nil {
+		return br.pass(RuleImpossibleTravel, params)
+	}
+
+	var previous *model.Transaction
+
+	for i, pastTx := range br.PastTransactions {
+		if pastTx.Coordinates == nil || pastTx.Time.After(br.Transaction.Time) {
+			continue
+		}
+
+		if previous == nil || pastTx.Time.After(previous.Time) {
+			previous = &br.PastTransactions[i]
+		}
+	}
+
+	if previous == nil {
+		return br.pass(RuleImpossibleTravel, params)
+	}
+
+	distance := distanceKm(*br.Transaction.Coordinates, *previous.Coordinates)
+	hours := br.Transaction.Time.Sub(previous.Time).Hours()
+	params["distanceKm"] = strconv.FormatFloat(distance, 'f', 1, 64)
+
+	if distance >= minTravelKm && (hours == 0 || distance/hours > maxSpeed) {
+		br.logger().Errorf("violation:%s", violations.ViolationImpossibleTravel)
+
+		return br.fail(RuleImpossibleTravel, violations.ViolationImpossibleTravel, params,
+			[]model.Transaction{*previous})
+	}
+
+	return br.pass(RuleImpossibleTravel, params)
+}
+
+// minTravelKm is the shortest distance considered a travel by impossibleTravel, the coordinates of the same place
+// can differ by some metres
+const minTravelKm = 1
+
+// earthRadiusKm is the mean radius of the earth used by distanceKm
+const earthRadiusKm = 6371
+
+// distanceKm returns the great-circle distance between two points using the haversine formula
+func distanceKm(from, to model.Coordinates) float64 {
+	lat1 := from.Latitude * math.Pi / 180
+	lat2 := to.Latitude * math.Pi / 180
+	deltaLat := lat2 - lat1
+	deltaLong := (to.Longitude - from.Longitude) * math.Pi / 180
+
+	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(deltaLong/2)*math.Sin(deltaLong/2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
 }
@@ -401,3 +401,301 @@ func TestBusinessRule_ExecuteRules(t *testing.T) {
 		})
 	}
 }
+
+func TestBusinessRule_cardTesting(t *testing.T) {
+	currentTime := time.Now()
+	tx := model.Transaction{
+		Merchant: "uno",
+		Amount:   1,
+		Time:     currentTime,
+	}
+
+	probes := []model.Transaction{
+		{Merchant: "dos", Amount: 2, Time: currentTime.Add(-3 * time.Minute)},
+		{Merchant: "tres", Amount: 1, Time: currentTime.Add(-5 * time.Minute)},
+		{Merchant: "cuatro", Amount: 3, Time: currentTime.Add(-7 * time.Minute)},
+		{Merchant: "cuatro", Amount: 1, Time: currentTime.Add(-9 * time.Minute)},
+	}
+
+	tests := []struct {
+		name             string
+		transaction      model.Transaction
+		pastTransactions []model.Transaction
+		config           Config
+		want             bool
+		want1            string
+	}{
+		{"disabled",
+			tx,
+			probes,
+			Config{},
+			true,
+			"",
+		},
+		{"cardTesting",
+			tx,
+			probes,
+			DefaultConfig(),
+			false,
+			"card-testing-suspected",
+		},
+		{"highAmount",
+			model.Transaction{Merchant: "uno", Amount: 100, Time: currentTime},
+			probes,
+			DefaultConfig(),
+			true,
+			"",
+		},
+		{"sameMerchant",
+			tx,
+			[]model.Transaction{
+				{Merchant: "uno", Amount: 1, Time: currentTime.Add(-3 * time.Minute)},
+				{Merchant: "uno", Amount: 1, Time: currentTime.Add(-4 * time.Minute)},
+				{Merchant: "dos", Amount: 1, Time: currentTime.Add(-5 * time.Minute)},
+				{Merchant: "dos", Amount: 1, Time: currentTime.Add(-6 * time.Minute)},
+			},
+			DefaultConfig(),
+			true,
+			"",
+		},
+		{"outsideWindow",
+			tx,
+			[]model.Transaction{
+				{Merchant: "dos", Amount: 1, Time: currentTime.Add(-3 * time.Minute)},
+				{Merchant: "tres", Amount: 1, Time: currentTime.Add(-5 * time.Minute)},
+				{Merchant: "cuatro", Amount: 1, Time: currentTime.Add(-7 * time.Minute)},
+				{Merchant: "cinco", Amount: 1, Time: currentTime.Add(-15 * time.Minute)},
+			},
+			DefaultConfig(),
+			true,
+			"",
+		},
+		{"initialTransaction",
+			tx,
+			[]model.Transaction{
+				{Merchant: model.InitialMerchant, Amount: 5, Time: currentTime.Add(-1 * time.Minute)},
+				{Merchant: "dos", Amount: 1, Time: currentTime.Add(-3 * time.Minute)},
+				{Merchant: "tres", Amount: 1, Time: currentTime.Add(-5 * time.Minute)},
+				{Merchant: "cuatro", Amount: 1, Time: currentTime.Add(-7 * time.Minute)},
+			},
+			DefaultConfig(),
+			true,
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			br := &BusinessRule{
+				Transaction:      tt.transaction,
+				PastTransactions: tt.pastTransactions,
+				Account:          model.Account{Id: 1, ActiveCard: true, AvailableLimit: 100},
+				Config:           tt.config,
+			}
+
+			got, got1 := br.cardTesting()
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.want1, got1)
+		})
+	}
+}
+
+func TestBusinessRule_homeCountry(t *testing.T) {
+	tests := []struct {
+		name        string
+		homeCountry string
+		country     string
+		want        bool
+		want1       string
+	}{
+		{"notRestricted", "", "US", true, ""},
+		{"unknownCountry", "MX", "", true, ""},
+		{"sameCountry", "MX", "mx", true, ""},
+		{"otherCountry", "MX", "US", false, "outside-home-country"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			br := &BusinessRule{
+				Transaction: model.Transaction{Merchant: "uno", Amount: 10, Time: time.Now(), Country: tt.country},
+				Account:     model.Account{Id: 1, ActiveCard: true, AvailableLimit: 100, HomeCountry: tt.homeCountry},
+			}
+
+			got, got1 := br.homeCountry()
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.want1, got1)
+		})
+	}
+}
+
+func TestBusinessRule_impossibleTravel(t *testing.T) {
+	currentTime := time.Now()
+	mexicoCity := &model.Coordinates{Latitude: 19.4326, Longitude: -99.1332}
+	madrid := &model.Coordinates{Latitude: 40.4168, Longitude: -3.7038}
+	tx := model.Transaction{Merchant: "uno", Amount: 10, Time: currentTime, Coordinates: madrid}
+
+	tests := []struct {
+		name             string
+		transaction      model.Transaction
+		pastTransactions []model.Transaction
+		config           Config
+		want             bool
+		want1            string
+	}{
+		{"disabled",
+			tx,
+			[]model.Transaction{{Merchant: "dos", Amount: 10, Time: currentTime.Add(-time.Hour), Coordinates: mexicoCity}},
+			Config{},
+			true,
+			"",
+		},
+		{"noCoordinates",
+			model.Transaction{Merchant: "uno", Amount: 10, Time: currentTime},
+			[]model.Transaction{{Merchant: "dos", Amount: 10, Time: currentTime.Add(-time.Hour), Coordinates: mexicoCity}},
+			DefaultConfig(),
+			true,
+			"",
+		},
+		{"noPastCoordinates",
+			tx,
+			[]model.Transaction{{Merchant: "dos", Amount: 10, Time: currentTime.Add(-time.Hour)}},
+			DefaultConfig(),
+			true,
+			"",
+		},
+		{"possible",
+			tx,
+			[]model.Transaction{{Merchant: "dos", Amount: 10, Time: currentTime.Add(-24 * time.Hour), Coordinates: mexicoCity}},
+			DefaultConfig(),
+			true,
+			"",
+		},
+		{"samePlace",
+			tx,
+			[]model.Transaction{{Merchant: "dos", Amount: 10, Time: currentTime, Coordinates: madrid}},
+			DefaultConfig(),
+			true,
+			"",
+		},
+		{"impossible",
+			tx,
+			[]model.Transaction{
+				{Merchant: "dos", Amount: 10, Time: currentTime.Add(-48 * time.Hour), Coordinates: madrid},
+				{Merchant: "tres", Amount: 10, Time: currentTime.Add(-time.Hour), Coordinates: mexicoCity},
+			},
+			DefaultConfig(),
+			false,
+			"impossible-travel",
+		},
+		{"gpsJitter",
+			tx,
+			[]model.Transaction{{Merchant: "dos", Amount: 10, Time: currentTime,
+				Coordinates: &model.Coordinates{Latitude: 40.4171, Longitude: -3.7042}}},
+			DefaultConfig(),
+			true,
+			"",
+		},
+		{"sameTimeOtherCity",
+			tx,
+			[]model.Transaction{{Merchant: "dos", Amount: 10, Time: currentTime, Coordinates: mexicoCity}},
+			DefaultConfig(),
+			false,
+			"impossible-travel",
+		},
+		{"latestPrevious",
+			tx,
+			[]model.Transaction{
+				{Merchant: "dos", Amount: 10, Time: currentTime.Add(-time.Hour), Coordinates: madrid},
+				{Merchant: "tres", Amount: 10, Time: currentTime.Add(-48 * time.Hour), Coordinates: mexicoCity},
+				{Merchant: "cuatro", Amount: 10, Time: currentTime.Add(30 * time.Minute), Coordinates: mexicoCity},
+			},
+			DefaultConfig(),
+			true,
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			br := &BusinessRule{
+				Transaction:      tt.transaction,
+				PastTransactions: tt.pastTransactions,
+				Account:          model.Account{Id: 1, ActiveCard: true, AvailableLimit: 100},
+				Config:           tt.config,
+			}
+
+			got, got1 := br.impossibleTravel()
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.want1, got1)
+		})
+	}
+}
+
+func TestBusinessRule_declinedAttempts(t *testing.T) {
+	currentTime := time.Now()
+	tx := model.Transaction{Merchant: "uno", Amount: 10, Time: currentTime}
+	enabled := DefaultConfig()
+	enabled.DeclinedAttempts.Enabled = true
+
+	declined := []model.Transaction{
+		{Merchant: "uno", Amount: 500, Time: currentTime.Add(-time.Minute)},
+		{Merchant: "dos", Amount: 500, Time: currentTime.Add(-2 * time.Minute)},
+		{Merchant: "tres", Amount: 500, Time: currentTime.Add(-3 * time.Minute)},
+	}
+
+	tests := []struct {
+		name     string
+		declined []model.Transaction
+		config   Config
+		settings model.RuleSettings
+		want     bool
+		want1    string
+	}{
+		{"disabled", declined, DefaultConfig(), nil, true, ""},
+		{"noDeclined", nil, enabled, nil, true, ""},
+		{"belowMaxAttempts", declined[:2], enabled, nil, true, ""},
+		{"tooMany", declined, enabled, nil, false, "too-many-declined-attempts"},
+		{"outsideWindow",
+			declined,
+			enabled,
+			model.RuleSettings{RuleDeclinedAttempts: {Window: &model.Duration{Duration: 150 * time.Second}}},
+			true,
+			"",
+		},
+		{"accountThreshold",
+			declined[:1],
+			enabled,
+			model.RuleSettings{RuleDeclinedAttempts: {Threshold: 1}},
+			false,
+			"too-many-declined-attempts",
+		},
+		{"disabledForAccount", declined, enabled, model.RuleSettings{RuleDeclinedAttempts: {Disabled: true}}, true, ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			br := &BusinessRule{
+				Transaction:          tx,
+				DeclinedTransactions: tt.declined,
+				Account:              model.Account{Id: 1, ActiveCard: true, AvailableLimit: 100, RuleSettings: tt.settings},
+				Config:               tt.config,
+			}
+
+			got, got1 := br.declinedAttempts()
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.want1, got1)
+		})
+	}
+}
+
+func Test_distanceKm(t *testing.T) {
+	mexicoCity := model.Coordinates{Latitude: 19.4326, Longitude: -99.1332}
+	madrid := model.Coordinates{Latitude: 40.4168, Longitude: -3.7038}
+
+	assert.InDelta(t, 9070, distanceKm(mexicoCity, madrid), 20)
+	assert.Equal(t, float64(0), distanceKm(madrid, madrid))
+}
@@ -0,0 +1,85 @@
+package rules
+
+import (
+	"fmt"
+	"time"
+
+	"authorizer/internal/app/model"
+)
+
+// Names of the rules that accept per-account overrides (model.RuleSettings),
+// isActive and sufficientLimit are always applied
+const (
+	RuleHomeCountry       = "homeCountry"
+	RuleDoubleTransaction = "doubleTransaction"
+	RuleHighFrequency     = "highFrequency"
+	RuleCardTesting       = "cardTesting"
+	RuleImpossibleTravel  = "impossibleTravel"
+	RuleDeclinedAttempts  = "declinedAttempts"
+)
+
+// defaultWindow is the period used by doubleTransaction and highFrequency
+const defaultWindow = 2 * time.Minute
+
+// defaultHighFrequencyThreshold is the number of transactions within the window (current one included)
+// that raises high-frequency-small-interval
+const defaultHighFrequencyThreshold = 3
+
+// ValidateSettings verifies that the overrides refer to existing rules and that the values make sense
+func ValidateSettings(settings model.RuleSettings) error {
+	for rule, override := range settings {
+		switch rule {
+		case RuleHomeCountry, RuleDoubleTransaction, RuleHighFrequency, RuleCardTesting, RuleImpossibleTravel,
+			RuleDeclinedAttempts:
+		default:
+			return fmt.Errorf("unknown rule %q", rule)
+		}
+
+		if override.Window != nil && override.Window.Duration <= 0 {
+			return fmt.Errorf("%s.window must be greater than 0", rule)
+		}
+
+		if override.Threshold < 0 {
+			return fmt.Errorf("%s.threshold must not be negative", rule)
+		}
+
+		if (rule == RuleHighFrequency || rule == RuleCardTesting) && override.Threshold == 1 {
+			return fmt.Errorf("%s.threshold must be at least 2", rule)
+		}
+	}
+
+	return nil
+}
+
+// enabled reports if the rule must be applied to the transaction, a rule can be disabled for the account
+// or the account can be exempted of it until a moment in time
+func (br *BusinessRule) enabled(rule string) bool {
+	override, ok := br.Account.RuleSettings[rule]
+	if !ok {
+		return true
+	}
+
+	if override.Disabled {
+		return false
+	}
+
+	return override.ExemptUntil == nil || !br.Transaction.Time.Before(*override.ExemptUntil)
+}
+
+// window returns the period analyzed by the rule for this account
+func (br *BusinessRule) window(rule string, defaultValue time.Duration) time.Duration {
+	if override := br.Account.RuleSettings[rule]; override.Window != nil {
+		return override.Window.Duration
+	}
+
+	return defaultValue
+}
+
+// threshold returns the threshold of the rule for this account
+func (br *BusinessRule) threshold(rule string, defaultValue int) int {
+	if override := br.Account.RuleSettings[rule]; override.Threshold > 0 {
+		return override.Threshold
+	}
+
+	return defaultValue
+}
@@ -0,0 +1,79 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/model"
+)
+
+func TestValidateSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings model.RuleSettings
+		wantErr  bool
+	}{
+		{"empty", nil, false},
+		{"valid", model.RuleSettings{RuleHighFrequency: {Threshold: 10}, RuleHomeCountry: {Disabled: true}}, false},
+		{"unknownRule", model.RuleSettings{"isActive": {Disabled: true}}, true},
+		{"invalidWindow", model.RuleSettings{RuleDoubleTransaction: {Window: &model.Duration{}}}, true},
+		{"negativeThreshold", model.RuleSettings{RuleImpossibleTravel: {Threshold: -1}}, true},
+		{"singleTransaction", model.RuleSettings{RuleCardTesting: {Threshold: 1}}, true},
+		{"declinedAttempts", model.RuleSettings{RuleDeclinedAttempts: {Threshold: 1}}, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSettings(tt.settings)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestBusinessRule_overrides(t *testing.T) {
+	currentTime := time.Now()
+	exemptUntil := currentTime.Add(time.Hour)
+	expired := currentTime.Add(-time.Hour)
+	window := model.Duration{Duration: 10 * time.Minute}
+
+	burst := []model.Transaction{
+		{Merchant: "dos", Amount: 10, Time: currentTime.Add(-3 * time.Minute)},
+		{Merchant: "tres", Amount: 20, Time: currentTime.Add(-4 * time.Minute)},
+		{Merchant: "cuatro", Amount: 30, Time: currentTime.Add(-30 * time.Second)},
+		{Merchant: "cinco", Amount: 40, Time: currentTime.Add(-20 * time.Second)},
+	}
+
+	tests := []struct {
+		name     string
+		settings model.RuleSettings
+		want     bool
+		want1    string
+	}{
+		{"defaults", nil, false, "high-frequency-small-interval"},
+		{"disabled", model.RuleSettings{RuleHighFrequency: {Disabled: true}}, true, ""},
+		{"exempt", model.RuleSettings{RuleHighFrequency: {ExemptUntil: &exemptUntil}}, true, ""},
+		{"exemptionExpired", model.RuleSettings{RuleHighFrequency: {ExemptUntil: &expired}}, false,
+			"high-frequency-small-interval"},
+		{"higherThreshold", model.RuleSettings{RuleHighFrequency: {Threshold: 4}}, true, ""},
+		{"widerWindow", model.RuleSettings{RuleHighFrequency: {Threshold: 4, Window: &window}}, false,
+			"high-frequency-small-interval"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			br := &BusinessRule{
+				Transaction:      model.Transaction{Merchant: "uno", Amount: 10, Time: currentTime},
+				PastTransactions: burst,
+				Account:          model.Account{Id: 1, ActiveCard: true, AvailableLimit: 100, RuleSettings: tt.settings},
+			}
+
+			got, got1 := br.ExecuteRules()
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.want1, got1)
+		})
+	}
+}
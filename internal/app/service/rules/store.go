@@ -0,0 +1,103 @@
+package rules
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Store holds the configuration in use, it can be replaced atomically while transactions are being processed,
+// every transaction uses the configuration loaded when it started
+type Store struct {
+	value atomic.Value
+}
+
+// NewStore creates a store that starts with the given configuration
+func NewStore(config Config) *Store {
+	s := &Store{}
+	s.value.Store(config)
+
+	return s
+}
+
+// Load returns the configuration in use, a nil or empty store uses DefaultConfig
+func (s *Store) Load() Config {
+	if s == nil {
+		return DefaultConfig()
+	}
+
+	config, ok := s.value.Load().(Config)
+	if !ok {
+		return DefaultConfig()
+	}
+
+	return config
+}
+
+// Reload reads and validates the configuration file and swaps it with the one in use,
+// if the file is not valid the current configuration is kept and the error is returned
+func (s *Store) Reload(path string) error {
+	config, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+
+	previous := s.Load()
+	s.value.Store(config)
+
+	log.Infof("rules config reloaded path:%s version:%s previous:%s", path, config.Version, previous.Version)
+
+	return nil
+}
+
+// Watch reloads the configuration file when the process receives SIGHUP or when the file changes,
+// the file is checked every interval, Watch blocks until the context is done
+func (s *Store) Watch(ctx context.Context, path string, interval time.Duration) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastChange := modTime(path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-hangup:
+			lastChange = modTime(path)
+			s.reload(path)
+
+		case <-ticker.C:
+			if change := modTime(path); !change.Equal(lastChange) {
+				lastChange = change
+				s.reload(path)
+			}
+		}
+	}
+}
+
+// reload keeps serving with the configuration in use when the new one is not valid
+func (s *Store) reload(path string) {
+	if err := s.Reload(path); err != nil {
+		log.Errorf("error reloading rules config, keeping version %q: %+v", s.Load().Version, err)
+	}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
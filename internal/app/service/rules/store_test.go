@@ -0,0 +1,63 @@
+package rules
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	store := NewStore(DefaultConfig())
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"version": "v2", "cardTesting": {"maxAmount": 2}}`), 0600))
+	assert.NoError(t, store.Reload(path))
+	assert.Equal(t, "v2", store.Load().Version)
+	assert.Equal(t, 2, store.Load().CardTesting.MaxAmount)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"version": "v3", "cardTesting": {"maxAmount": -1}}`), 0600))
+	assert.Error(t, store.Reload(path))
+	assert.Equal(t, "v2", store.Load().Version)
+}
+
+func TestStore_Load_empty(t *testing.T) {
+	var nilStore *Store
+
+	assert.Equal(t, DefaultConfig(), nilStore.Load())
+	assert.Equal(t, DefaultConfig(), (&Store{}).Load())
+}
+
+func TestStore_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	base := time.Now().Add(-time.Hour)
+
+	writeConfig(t, path, `{"version": "v1"}`, base)
+
+	store := NewStore(DefaultConfig())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go store.Watch(ctx, path, 10*time.Millisecond)
+
+	time.Sleep(30 * time.Millisecond)
+
+	writeConfig(t, path, `{"version": "v2"}`, base.Add(time.Second))
+	assert.Eventually(t, func() bool { return store.Load().Version == "v2" }, time.Second, 10*time.Millisecond)
+
+	writeConfig(t, path, `{"version": `, base.Add(2*time.Second))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, "v2", store.Load().Version)
+}
+
+// writeConfig writes the file and sets its modification time, so the tests don't depend on the clock resolution
+func writeConfig(t *testing.T, path, content string, modified time.Time) {
+	t.Helper()
+
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	assert.NoError(t, os.Chtimes(path, modified, modified))
+}
@@ -0,0 +1,35 @@
+//go:build !windows
+// +build !windows
+
+package rules
+
+import (
+	"context"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_Watch_sighup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	modified := time.Now().Add(-time.Hour)
+
+	writeConfig(t, path, `{"version": "v1"}`, modified)
+
+	store := NewStore(DefaultConfig())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go store.Watch(ctx, path, time.Hour)
+
+	time.Sleep(30 * time.Millisecond)
+
+	// same modification time, only the signal can trigger the reload
+	writeConfig(t, path, `{"version": "v2"}`, modified)
+	assert.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGHUP))
+	assert.Eventually(t, func() bool { return store.Load().Version == "v2" }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,84 @@
+package rules
+
+import (
+	"time"
+
+	"authorizer/internal/app/model"
+)
+
+// Names of the rules that can't be overridden, they are only used to explain the decision
+const (
+	RuleIsActive        = "isActive"
+	RuleSufficientLimit = "sufficientLimit"
+)
+
+// Trace explains the result of a single rule, it is only recorded when BusinessRule.Explain is set
+type Trace struct {
+	Rule      string `json:"rule"`
+	Passed    bool   `json:"passed"`
+	Violation string `json:"violation,omitempty"`
+	// Skipped is set when the rule is disabled by the configuration or by the settings of the account
+	Skipped    bool              `json:"skipped,omitempty"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	// Conflicts are the past transactions that caused the violation
+	Conflicts []Conflict `json:"conflicts,omitempty"`
+}
+
+// Conflict is a past transaction that was taken into account to raise a violation
+type Conflict struct {
+	Id       string    `json:"id,omitempty"`
+	Merchant string    `json:"merchant"`
+	Amount   int       `json:"amount"`
+	Time     time.Time `json:"time"`
+}
+
+// Recorder receives every violation found by the rules, it is used to count them
+type Recorder interface {
+	Violation(rule, violation string)
+}
+
+// pass records that the rule didn't find any violation
+func (br *BusinessRule) pass(rule string, params map[string]string) (bool, string) {
+	if br.Explain {
+		br.Traces = append(br.Traces, Trace{Rule: rule, Passed: true, Parameters: params})
+	}
+
+	return true, ""
+}
+
+// skip records that the rule was not executed
+func (br *BusinessRule) skip(rule string) (bool, string) {
+	if br.Explain {
+		br.Traces = append(br.Traces, Trace{Rule: rule, Passed: true, Skipped: true})
+	}
+
+	return true, ""
+}
+
+// fail records the violation and the past transactions that caused it
+func (br *BusinessRule) fail(
+	rule, violation string,
+	params map[string]string,
+	conflicts []model.Transaction,
+) (bool, string) {
+	if br.Recorder != nil {
+		br.Recorder.Violation(rule, violation)
+	}
+
+	if br.Explain {
+		trace := Trace{Rule: rule, Violation: violation, Parameters: params}
+
+		for _, tx := range conflicts {
+			trace.Conflicts = append(trace.Conflicts, Conflict{
+				Id:       tx.Id,
+				Merchant: tx.Merchant,
+				Amount:   tx.Amount,
+				Time:     tx.Time,
+			})
+		}
+
+		br.Traces = append(br.Traces, trace)
+	}
+
+	return false, violation
+}
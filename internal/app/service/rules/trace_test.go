@@ -0,0 +1,77 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/model"
+)
+
+func TestBusinessRule_ExecuteRules_explain(t *testing.T) {
+	currentTime := time.Date(2019, 2, 13, 11, 0, 0, 0, time.UTC)
+	double := model.Transaction{Id: "1", Merchant: "uno", Amount: 10, Time: currentTime.Add(-time.Minute)}
+	other := model.Transaction{Id: "2", Merchant: "dos", Amount: 20, Time: currentTime.Add(-30 * time.Second)}
+
+	br := &BusinessRule{
+		Transaction:      model.Transaction{Merchant: "uno", Amount: 10, Time: currentTime},
+		PastTransactions: []model.Transaction{double, other},
+		Account: model.Account{
+			Id:             1,
+			ActiveCard:     true,
+			AvailableLimit: 100,
+			RuleSettings:   model.RuleSettings{RuleHomeCountry: {Disabled: true}},
+		},
+		Config:  DefaultConfig(),
+		Explain: true,
+	}
+
+	got, got1 := br.ExecuteRules()
+	assert.False(t, got)
+	assert.Equal(t, "doubled-transaction", got1)
+
+	want := []Trace{
+		{Rule: RuleIsActive, Passed: true, Parameters: map[string]string{"activeCard": "true"}},
+		{Rule: RuleDeclinedAttempts, Passed: true, Skipped: true},
+		{Rule: RuleSufficientLimit, Passed: true, Parameters: map[string]string{"availableLimit": "100", "amount": "10"}},
+		{Rule: RuleHomeCountry, Passed: true, Skipped: true},
+		{Rule: RuleDoubleTransaction,
+			Violation:  "doubled-transaction",
+			Parameters: map[string]string{"window": "2m0s"},
+			Conflicts: []Conflict{
+				{Id: "1", Merchant: "uno", Amount: 10, Time: double.Time},
+			},
+		},
+		{Rule: RuleHighFrequency,
+			Violation:  "high-frequency-small-interval",
+			Parameters: map[string]string{"window": "2m0s", "threshold": "3"},
+			Conflicts: []Conflict{
+				{Id: "1", Merchant: "uno", Amount: 10, Time: double.Time},
+				{Id: "2", Merchant: "dos", Amount: 20, Time: other.Time},
+			},
+		},
+		{Rule: RuleCardTesting,
+			Passed: true,
+			Parameters: map[string]string{
+				"window": "10m0s", "maxAmount": "5", "minTransactions": "5", "minMerchants": "3",
+			},
+		},
+		{Rule: RuleImpossibleTravel, Passed: true, Parameters: map[string]string{"maxSpeedKmh": "1000"}},
+	}
+
+	assert.Equal(t, want, br.Traces)
+}
+
+func TestBusinessRule_ExecuteRules_withoutExplain(t *testing.T) {
+	br := &BusinessRule{
+		Transaction: model.Transaction{Merchant: "uno", Amount: 10, Time: time.Now()},
+		Account:     model.Account{Id: 1, ActiveCard: true, AvailableLimit: 100},
+		Config:      DefaultConfig(),
+	}
+
+	got, got1 := br.ExecuteRules()
+	assert.True(t, got)
+	assert.Equal(t, "", got1)
+	assert.Nil(t, br.Traces)
+}
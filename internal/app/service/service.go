@@ -1,49 +1,156 @@
 package service
 
 import (
+	"errors"
+	"time"
+
 	"authorizer/internal/app/service/rules"
 
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 
 	"authorizer/internal/app/model"
 	"authorizer/internal/app/violations"
 )
 
+// defaultMaxAttempts is how many times an operation is evaluated when the account is modified concurrently
+const defaultMaxAttempts = 3
+
 // Service contains the logic to execute the commands
 type Service struct {
-	storage Storage
+	storage     Storage
+	rules       *rules.Store
+	explain     bool
+	metrics     *Metrics
+	maxAttempts int
+	// totals is the storage when it implements DailyTotalsStorage, it is kept before the storage is instrumented
+	totals DailyTotalsStorage
 }
 
+// Option modifies the default configuration of the service
+type Option func(*Service)
+
 // Storage interface used in service to execute or simulate an storage
 type Storage interface {
+	Repository
+	// Begin starts a unit of work, no other unit of work can change the accounts it reads until it ends
+	Begin() (UnitOfWork, error)
+	Close() error
+}
+
+// Repository are the reads and writes of the accounts and their history.
+// ExecuteTransaction, ExecutePayment and UpdateAccount fail with *model.ConflictError when the version of the account
+// is not the stored one, every write increases the version
+type Repository interface {
 	CreateAccount(a model.Account) error
 	GetAccount(aID int) model.Account
 	ExecuteTransaction(a model.Account, t model.Transaction) (model.Account, error)
+	// ExecutePayment restores the limit of the account and registers the payment in its history
+	ExecutePayment(a model.Account, p model.Payment) (model.Account, error)
+	UpdateAccount(a model.Account) error
 	GetTransactions(accountID int) []model.Transaction
-	Close() error
+	// RecordDeclined adds a declined attempt of the account, it doesn't change the account nor its version
+	RecordDeclined(accountID int, d model.DeclinedTransaction) error
+	// GetDeclined returns the declined attempts of the account in the order they were recorded
+	GetDeclined(accountID int) []model.DeclinedTransaction
+}
+
+// UnitOfWork groups reads and writes of the storage, the writes are applied together with Commit
+// or none of them with Rollback. Rollback after Commit does nothing, so it can always be deferred
+type UnitOfWork interface {
+	Repository
+	// AppendEvent adds the event to the outbox of the storage with the next offset, it is committed or rolled back
+	// with the other writes
+	AppendEvent(e model.AuthorizationEvent) error
+	Commit() error
+	Rollback() error
+}
+
+// EventLog reads the events appended by the units of work in the order they were committed
+type EventLog interface {
+	// Events returns up to limit events with an offset greater than after and a channel that is closed when
+	// another event is committed. It fails with a *model.CompactedError when the next event was removed
+	Events(after, limit int) ([]model.AuthorizationEvent, <-chan struct{}, error)
 }
 
 // CreateAccount is the input of the createAccount operation
 type CreateAccount struct {
 	Account model.Account `json:"account"`
+	// RequestID identifies the operation in the logs
+	RequestID string `json:"requestId,omitempty"`
 }
 
 // TransactionResponse is the response for any operation
 type TransactionResponse struct {
 	Account    model.Account `json:"account"`
 	Violations []string      `json:"violations"`
+	// RuleSetVersion is the version of the rules configuration that took the decision
+	RuleSetVersion string `json:"ruleSetVersion,omitempty"`
+	// Explanation contains the result of every business rule when the transaction is explained
+	Explanation []rules.Trace `json:"explanation,omitempty"`
 }
 
 // ProcessTransaction is the input of the transaction operation
 type ProcessTransaction struct {
 	Transaction model.Transaction `json:"transaction"`
 	AccountID   int               `json:"-"`
+	RequestID   string            `json:"requestId,omitempty"`
+	// Explain adds the result of every business rule to the response
+	Explain bool `json:"explain,omitempty"`
+}
+
+// WithExplain explains the decision of every transaction, not only the ones that ask for it
+func WithExplain(explain bool) Option {
+	return func(s *Service) {
+		s.explain = explain
+	}
+}
+
+// WithMaxAttempts sets how many times an operation is evaluated when the account is modified by another operation
+// between the read and the write, 3 by default
+func WithMaxAttempts(attempts int) Option {
+	return func(s *Service) {
+		s.maxAttempts = attempts
+	}
 }
 
-// New creates a new service instance
-func New(storage Storage) *Service {
-	return &Service{
+// SetRuleSettings is the input of the ruleSettings operation
+type SetRuleSettings struct {
+	RuleSettings model.RuleSettings `json:"ruleSettings"`
+	AccountID    int                `json:"-"`
+	RequestID    string             `json:"requestId,omitempty"`
+}
+
+// New creates a new service instance, by default it uses rules.DefaultConfig
+func New(storage Storage, opts ...Option) *Service {
+	s := &Service{
 		storage: storage,
+		rules:   rules.NewStore(rules.DefaultConfig()),
+	}
+	s.totals, _ = storage.(DailyTotalsStorage)
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.metrics != nil {
+		s.storage = s.metrics.instrument(s.storage)
+	}
+
+	return s
+}
+
+// WithRulesConfig sets the configuration used by the configurable business rules
+func WithRulesConfig(config rules.Config) Option {
+	return func(s *Service) {
+		s.rules = rules.NewStore(config)
+	}
+}
+
+// WithRulesStore shares a rules.Store with the service, so the configuration can be reloaded while the service runs
+func WithRulesStore(store *rules.Store) Option {
+	return func(s *Service) {
+		s.rules = store
 	}
 }
 
@@ -51,12 +158,25 @@ func New(storage Storage) *Service {
 // 1.- Verify if the account was already created,
 //	if it was already created return the violation ViolationAccountAlreadyExists
 // 2.- If it wasn't created before, create a new account in storage
+//	the terms of the credit line are validated, its limit is the available limit (see ProcessPayment)
 func (s *Service) CreateAccount(ca CreateAccount) (response TransactionResponse, err error) {
+	defer func() { s.metrics.operation("account", response, err) }()
+
 	response.Account = ca.Account
+	logger := requestLogger(ca.Account.Id, ca.RequestID)
+
+	uow, err := s.storage.Begin()
+	if err != nil {
+		logger.Errorf("error:%s", err)
+
+		return response, err
+	}
+	defer rollback(uow, logger)
 
-	account := s.storage.GetAccount(ca.Account.Id)
-	if account.ActiveCard {
-		log.Errorf("error:%s id:%d", violations.ViolationAccountAlreadyExists, ca.Account.Id)
+	// a blocked card is inactive, so the account still exists while it has its initial transaction
+	account := uow.GetAccount(ca.Account.Id)
+	if account.ActiveCard || len(uow.GetTransactions(ca.Account.Id)) > 0 {
+		logger.Errorf("error:%s", violations.ViolationAccountAlreadyExists)
 
 		response.Account = account
 		response.Violations = append(response.Violations, violations.ViolationAccountAlreadyExists)
@@ -64,12 +184,36 @@ func (s *Service) CreateAccount(ca CreateAccount) (response TransactionResponse,
 		return response, nil
 	}
 
-	if err = s.storage.CreateAccount(ca.Account); err != nil {
+	if err = rules.ValidateSettings(ca.Account.RuleSettings); err != nil {
+		logger.Errorf("error:%s", err)
+
+		response.Violations = []string{violations.ViolationInvalidRuleSettings}
+
+		return response, nil
+	}
+
+	if ca.Account.CreditLine, err = newCreditLine(ca.Account.CreditLine, ca.Account.AvailableLimit); err != nil {
+		logger.Errorf("error:%s", err)
+
+		response.Violations = []string{violations.ViolationInvalidCreditLine}
+
+		return response, nil
+	}
+
+	response.Account.CreditLine = ca.Account.CreditLine
+
+	if err = uow.CreateAccount(ca.Account); err != nil {
 		response.Violations = append(response.Violations, err.Error())
 
 		return response, err
 	}
 
+	if err = uow.Commit(); err != nil {
+		logger.Errorf("error:%s", err)
+
+		return response, err
+	}
+
 	response.Violations = []string{}
 
 	return response, nil
@@ -78,31 +222,250 @@ func (s *Service) CreateAccount(ca CreateAccount) (response TransactionResponse,
 // ProcessTransaction processes the transaction received in the input json
 // 1.- Get account information based on the accountID (always 1 in this example)
 // 2.- Get all the transactions executed by this account (info used by the business rules)
+//      The billing cycles of the credit line that ended before the transaction are closed (see bill)
 // 3.- Execute all the business rules, the rules are functions with the same input and outputs
 //      If one of them fail, the response contains the violation
+//      If the violation is a suspected card-testing attack the card can be blocked (see rules.CardTestingConfig)
+//      The configuration is loaded once, so the whole transaction is evaluated with the same rule set version
+//      When the transaction is explained the response contains the result of every rule
 // 4.- If transaction passed all the business rules, then we execute the transaction on the storage
 //      updating the availableLimit and registering the new transaction in the history
+// 5.- If the account was modified after it was read, the steps are repeated up to maxAttempts times,
+//      then the response contains the violation ViolationConcurrentModification
+//      A declined transaction is kept with its violations apart from the history (see rules.DeclinedAttemptsConfig)
+//      The decision is appended to the outbox of the storage as an event in the same unit of work,
+//      so every committed decision has exactly one event
 func (s *Service) ProcessTransaction(tx ProcessTransaction) (response TransactionResponse, err error) {
-	accountFound := s.storage.GetAccount(tx.AccountID)
+	defer s.metrics.observeProcess(time.Now())
+	defer func() { s.metrics.operation("transaction", response, err) }()
+
+	config := s.rules.Load()
+	logger := requestLogger(tx.AccountID, tx.RequestID).WithField("ruleSetVersion", config.Version)
+
+	return s.retry(logger, func() (TransactionResponse, error) {
+		return s.processTransaction(tx, config, logger)
+	})
+}
+
+// processTransaction is a single attempt of ProcessTransaction
+func (s *Service) processTransaction(tx ProcessTransaction, config rules.Config, logger *log.Entry) (
+	response TransactionResponse,
+	err error,
+) {
+	response.RuleSetVersion = config.Version
+
+	// the account is read, checked and debited in the same unit of work, so no other operation can change it
+	// between the rules and the debit
+	uow, err := s.storage.Begin()
+	if err != nil {
+		logger.Errorf("error:%s", err)
+
+		return response, err
+	}
+	defer rollback(uow, logger)
+
+	accountFound := uow.GetAccount(tx.AccountID)
+	if bill(&accountFound, tx.Transaction.Time) {
+		if accountFound, err = saveBilled(uow, accountFound, logger); err != nil {
+			return response, err
+		}
+	}
+
 	response.Account = accountFound
 
-	pastTransactions := s.storage.GetTransactions(tx.AccountID)
+	// the payments and the initial limit are told apart from the purchases by their merchant, the attempt is
+	// declined as the ones that fail a rule
+	if model.IsReservedMerchant(tx.Transaction.Merchant) {
+		logger.Errorf("violation:%s", violations.ViolationReservedMerchant)
+
+		response.Violations = []string{violations.ViolationReservedMerchant}
+
+		if err = recordDeclined(uow, tx, response, logger); err != nil {
+			return response, err
+		}
+
+		return response, commitDecision(uow, tx, response, logger)
+	}
+
+	pastTransactions := withoutPayments(uow.GetTransactions(tx.AccountID))
 
 	br := rules.BusinessRule{
 		Transaction:      tx.Transaction,
 		PastTransactions: pastTransactions,
 		Account:          accountFound,
+		Config:           config,
+		Explain:          s.explain || tx.Explain,
+		Logger:           logger,
+	}
+
+	for _, d := range uow.GetDeclined(tx.AccountID) {
+		br.DeclinedTransactions = append(br.DeclinedTransactions, d.Transaction)
+	}
+
+	if s.metrics != nil {
+		br.Recorder = s.metrics
 	}
 
 	isValid, violation := br.ExecuteRules()
+	response.Explanation = br.Traces
+
+	logger.Debugf("decision valid:%t violation:%s", isValid, violation)
+
 	if !isValid {
+		if violation == violations.ViolationCardTestingSuspected && config.CardTesting.BlockCard {
+			accountFound.ActiveCard = false
+
+			if err = uow.UpdateAccount(accountFound); err != nil {
+				logger.Errorf("error blocking card:%s", err)
+
+				return response, err
+			}
+		}
+
+		response.Account = accountFound
 		response.Violations = []string{violation}
-		return response, nil
+
+		if err = recordDeclined(uow, tx, response, logger); err != nil {
+			return response, err
+		}
+
+		return response, commitDecision(uow, tx, response, logger)
 	}
 
-	account, err := s.storage.ExecuteTransaction(accountFound, tx.Transaction)
+	account, err := uow.ExecuteTransaction(accountFound, tx.Transaction)
 	if err != nil {
-		log.Errorf("error:%s id:%d", err, tx.AccountID)
+		logger.Errorf("error:%s", err)
+
+		return response, err
+	}
+
+	response.Account = account
+	response.Violations = []string{}
+
+	return response, commitDecision(uow, tx, response, logger)
+}
+
+// recordDeclined keeps the declined attempt with its violations, the attempts of accounts that don't exist
+// are not kept as there is no account to investigate
+func recordDeclined(uow UnitOfWork, tx ProcessTransaction, decision TransactionResponse, logger *log.Entry) error {
+	if decision.Account.Version == 0 {
+		return nil
+	}
+
+	err := uow.RecordDeclined(tx.AccountID, model.DeclinedTransaction{
+		Transaction: tx.Transaction,
+		Violations:  decision.Violations,
+	})
+	if err != nil {
+		logger.Errorf("error recording declined attempt:%s", err)
+
+		return err
+	}
+
+	return nil
+}
+
+// commitDecision appends the event of the decision to the outbox and commits it with the writes of the transaction
+func commitDecision(uow UnitOfWork, tx ProcessTransaction, decision TransactionResponse, logger *log.Entry) error {
+	err := uow.AppendEvent(model.AuthorizationEvent{
+		ID:             uuid.New().String(),
+		AccountID:      tx.AccountID,
+		RequestID:      tx.RequestID,
+		Transaction:    tx.Transaction,
+		Approved:       len(decision.Violations) == 0,
+		Violations:     decision.Violations,
+		AvailableLimit: decision.Account.AvailableLimit,
+		RuleSetVersion: decision.RuleSetVersion,
+	})
+	if err != nil {
+		logger.Errorf("error appending event:%s", err)
+
+		return err
+	}
+
+	if err = uow.Commit(); err != nil {
+		logger.Errorf("error:%s", err)
+
+		return err
+	}
+
+	return nil
+}
+
+// SetRuleSettings changes how the business rules are applied to an account
+// 1.- Validate that the overrides refer to existing rules
+// 2.- Merge them with the overrides stored in the account, an empty override removes the override of that rule
+// 3.- Store the account with the new settings, if the account doesn't exist
+//      the response contains the violation ViolationAccountNotInitialized
+//      if it was modified after it was read the steps are repeated as in ProcessTransaction
+func (s *Service) SetRuleSettings(rs SetRuleSettings) (response TransactionResponse, err error) {
+	defer func() { s.metrics.operation("ruleSettings", response, err) }()
+
+	logger := requestLogger(rs.AccountID, rs.RequestID)
+
+	return s.retry(logger, func() (TransactionResponse, error) {
+		return s.setRuleSettings(rs, logger)
+	})
+}
+
+// setRuleSettings is a single attempt of SetRuleSettings
+func (s *Service) setRuleSettings(rs SetRuleSettings, logger *log.Entry) (response TransactionResponse, err error) {
+	uow, err := s.storage.Begin()
+	if err != nil {
+		logger.Errorf("error:%s", err)
+
+		return response, err
+	}
+	defer rollback(uow, logger)
+
+	account := uow.GetAccount(rs.AccountID)
+	response.Account = account
+
+	if err = rules.ValidateSettings(rs.RuleSettings); err != nil {
+		logger.Errorf("error:%s", err)
+
+		response.Violations = []string{violations.ViolationInvalidRuleSettings}
+
+		return response, nil
+	}
+
+	settings := account.RuleSettings.Copy()
+	if settings == nil {
+		settings = model.RuleSettings{}
+	}
+
+	for rule, override := range rs.RuleSettings {
+		if override.IsZero() {
+			delete(settings, rule)
+
+			continue
+		}
+
+		settings[rule] = override
+	}
+
+	if len(settings) == 0 {
+		settings = nil
+	}
+
+	account.RuleSettings = settings
+
+	if err = uow.UpdateAccount(account); err != nil {
+		if errors.Is(err, model.ErrAccountNotFound) {
+			logger.Errorf("error:%s", violations.ViolationAccountNotInitialized)
+
+			response.Violations = []string{violations.ViolationAccountNotInitialized}
+
+			return response, nil
+		}
+
+		logger.Errorf("error:%s", err)
+
+		return response, err
+	}
+
+	if err = uow.Commit(); err != nil {
+		logger.Errorf("error:%s", err)
 
 		return response, err
 	}
@@ -112,3 +475,60 @@ func (s *Service) ProcessTransaction(tx ProcessTransaction) (response Transactio
 
 	return response, nil
 }
+
+// retry executes the operation again when the account was modified by another operation after it was read,
+// after the last attempt the response contains the violation ViolationConcurrentModification
+func (s *Service) retry(logger *log.Entry, operation func() (TransactionResponse, error)) (
+	TransactionResponse,
+	error,
+) {
+	maxAttempts := s.maxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		response, err := operation()
+
+		var conflict *model.ConflictError
+		if !errors.As(err, &conflict) {
+			return response, err
+		}
+
+		if attempt >= maxAttempts {
+			logger.Errorf("error:%s after %d attempts: %s", violations.ViolationConcurrentModification, attempt, err)
+
+			response.Violations = []string{violations.ViolationConcurrentModification}
+
+			return response, nil
+		}
+
+		logger.Warnf("retrying after conflict: %s", err)
+	}
+}
+
+// commit ends the unit of work of an operation that was rejected but wrote the account, e.g. a billed credit line
+func commit(uow UnitOfWork, logger *log.Entry) error {
+	if err := uow.Commit(); err != nil {
+		logger.Errorf("error:%s", err)
+
+		return err
+	}
+
+	return nil
+}
+
+// rollback discards the writes of a unit of work that wasn't committed
+func rollback(uow UnitOfWork, logger *log.Entry) {
+	if err := uow.Rollback(); err != nil {
+		logger.Errorf("error rolling back:%s", err)
+	}
+}
+
+// requestLogger adds the fields that identify the operation to every log line, the same fields are used by the rules
+func requestLogger(accountID int, requestID string) *log.Entry {
+	return log.WithFields(log.Fields{
+		"accountId": accountID,
+		"requestId": requestID,
+	})
+}
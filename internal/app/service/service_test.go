@@ -1,12 +1,17 @@
 package service
 
 import (
+	"errors"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 
 	"authorizer/internal/app/model"
+	"authorizer/internal/app/service/rules"
+	"authorizer/internal/app/violations"
 )
 
 func TestNew(t *testing.T) {
@@ -25,6 +30,7 @@ func TestNew(t *testing.T) {
 			},
 			&Service{
 				storage: &mockStorage{},
+				rules:   rules.NewStore(rules.DefaultConfig()),
 			},
 		},
 	}
@@ -151,7 +157,8 @@ func TestService_ProcessTransaction(t *testing.T) {
 					ActiveCard:     true,
 					AvailableLimit: 110,
 				},
-				Violations: []string{},
+				Violations:     []string{},
+				RuleSetVersion: rules.DefaultVersion,
 			},
 			nil,
 		},
@@ -169,8 +176,9 @@ func TestService_ProcessTransaction(t *testing.T) {
 				},
 			},
 			TransactionResponse{
-				Account:    model.Account{},
-				Violations: []string{"card-not-active"},
+				Account:        model.Account{},
+				Violations:     []string{"card-not-active"},
+				RuleSetVersion: rules.DefaultVersion,
 			},
 			nil,
 		},
@@ -195,6 +203,14 @@ func (m *mockStorage) GetTransactions(accountID int) []model.Transaction {
 	return []model.Transaction{}
 }
 
+func (m *mockStorage) RecordDeclined(accountID int, d model.DeclinedTransaction) error {
+	return nil
+}
+
+func (m *mockStorage) GetDeclined(accountID int) []model.DeclinedTransaction {
+	return []model.DeclinedTransaction{}
+}
+
 func (m *mockStorage) CreateAccount(a model.Account) error {
 	return nil
 }
@@ -211,10 +227,41 @@ func (m *mockStorage) GetAccount(aID int) model.Account {
 	return model.Account{}
 }
 
+func (m *mockStorage) ExecutePayment(a model.Account, p model.Payment) (model.Account, error) {
+	a.AvailableLimit += p.Amount
+
+	return a, nil
+}
+
+func (m *mockStorage) UpdateAccount(a model.Account) error {
+	return nil
+}
+
 func (m *mockStorage) Close() error {
 	return nil
 }
 
+func (m *mockStorage) Begin() (UnitOfWork, error) {
+	return nopUnitOfWork{m}, nil
+}
+
+// nopUnitOfWork executes the operations directly on the mocks, they don't need to roll back
+type nopUnitOfWork struct {
+	Repository
+}
+
+func (nopUnitOfWork) AppendEvent(e model.AuthorizationEvent) error {
+	return nil
+}
+
+func (nopUnitOfWork) Commit() error {
+	return nil
+}
+
+func (nopUnitOfWork) Rollback() error {
+	return nil
+}
+
 func (m *mockStorage) ExecuteTransaction(a model.Account, t model.Transaction) (model.Account, error) {
 	if a.Id == 2 {
 		account := model.Account{
@@ -228,3 +275,550 @@ func (m *mockStorage) ExecuteTransaction(a model.Account, t model.Transaction) (
 
 	return model.Account{}, nil
 }
+
+// failingStorage fails every debit and records how its units of work ended
+type failingStorage struct {
+	mockStorage
+	committed  int
+	rolledBack int
+}
+
+func (f *failingStorage) ExecuteTransaction(a model.Account, t model.Transaction) (model.Account, error) {
+	return a, errors.New("connection lost")
+}
+
+func (f *failingStorage) Begin() (UnitOfWork, error) {
+	return &recordingUnitOfWork{Repository: f, storage: f}, nil
+}
+
+type recordingUnitOfWork struct {
+	Repository
+	storage *failingStorage
+	done    bool
+}
+
+func (r *recordingUnitOfWork) AppendEvent(e model.AuthorizationEvent) error {
+	return nil
+}
+
+func (r *recordingUnitOfWork) Commit() error {
+	r.storage.committed++
+	r.done = true
+
+	return nil
+}
+
+func (r *recordingUnitOfWork) Rollback() error {
+	if !r.done {
+		r.storage.rolledBack++
+	}
+
+	return nil
+}
+
+func TestService_ProcessTransaction_rollback(t *testing.T) {
+	storage := &failingStorage{}
+	s := New(storage)
+
+	_, err := s.ProcessTransaction(ProcessTransaction{
+		Transaction: model.Transaction{Merchant: "uno", Amount: 10, Time: time.Now()},
+		AccountID:   2,
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 0, storage.committed)
+	assert.Equal(t, 1, storage.rolledBack)
+
+	_, err = s.ProcessTransaction(ProcessTransaction{
+		Transaction: model.Transaction{Merchant: "uno", Amount: 10, Time: time.Now()},
+		AccountID:   1,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, storage.committed, "a declined transaction only commits its event")
+	assert.Equal(t, 1, storage.rolledBack)
+}
+
+// conflictStorage simulates other processes writing the account, the first conflicts writes fail
+type conflictStorage struct {
+	mockStorage
+	conflicts int
+	writes    int
+}
+
+func (c *conflictStorage) Begin() (UnitOfWork, error) {
+	return nopUnitOfWork{c}, nil
+}
+
+func (c *conflictStorage) write(a model.Account) error {
+	c.writes++
+	if c.writes <= c.conflicts {
+		return &model.ConflictError{AccountID: a.Id, Version: a.Version, Stored: a.Version + 1}
+	}
+
+	return nil
+}
+
+func (c *conflictStorage) ExecuteTransaction(a model.Account, t model.Transaction) (model.Account, error) {
+	if err := c.write(a); err != nil {
+		return a, err
+	}
+
+	return c.mockStorage.ExecuteTransaction(a, t)
+}
+
+func (c *conflictStorage) UpdateAccount(a model.Account) error {
+	return c.write(a)
+}
+
+func TestService_concurrentModification(t *testing.T) {
+	tx := ProcessTransaction{
+		Transaction: model.Transaction{Merchant: "uno", Amount: 10, Time: time.Now()},
+		AccountID:   2,
+	}
+	rs := SetRuleSettings{RuleSettings: model.RuleSettings{rules.RuleHighFrequency: {Disabled: true}}, AccountID: 2}
+
+	tests := []struct {
+		name           string
+		conflicts      int
+		opts           []Option
+		wantWrites     int
+		wantViolations []string
+	}{
+		{"noConflict", 0, nil, 1, []string{}},
+		{"retried", 2, nil, 3, []string{}},
+		{"attemptsExhausted", 3, nil, 3, []string{violations.ViolationConcurrentModification}},
+		{"maxAttempts", 3, []Option{WithMaxAttempts(4)}, 4, []string{}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &conflictStorage{conflicts: tt.conflicts}
+
+			response, err := New(storage, tt.opts...).ProcessTransaction(tx)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantViolations, response.Violations)
+			assert.Equal(t, tt.wantWrites, storage.writes)
+
+			storage = &conflictStorage{conflicts: tt.conflicts}
+
+			response, err = New(storage, tt.opts...).SetRuleSettings(rs)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantViolations, response.Violations)
+			assert.Equal(t, tt.wantWrites, storage.writes)
+		})
+	}
+}
+
+func TestService_ProcessTransaction_cardTesting(t *testing.T) {
+	currentTime := time.Now()
+
+	probes := make([]model.Transaction, 0, 4)
+	for i, merchant := range []string{"a", "b", "c", "d"} {
+		probes = append(probes, model.Transaction{
+			Merchant: merchant,
+			Amount:   1,
+			Time:     currentTime.Add(-time.Duration(i+1) * 2 * time.Minute),
+		})
+	}
+
+	tx := ProcessTransaction{
+		Transaction: model.Transaction{Merchant: "e", Amount: 1, Time: currentTime},
+		AccountID:   2,
+	}
+
+	tests := []struct {
+		name        string
+		blockCard   bool
+		wantActive  bool
+		wantUpdated bool
+	}{
+		{"onlyViolation", false, true, false},
+		{"blockCard", true, false, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			config := rules.DefaultConfig()
+			config.CardTesting.BlockCard = tt.blockCard
+
+			storage := &historyStorage{transactions: probes}
+			s := New(storage, WithRulesConfig(config))
+
+			gotResponse, err := s.ProcessTransaction(tx)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"card-testing-suspected"}, gotResponse.Violations)
+			assert.Equal(t, tt.wantActive, gotResponse.Account.ActiveCard)
+			assert.Equal(t, tt.wantUpdated, storage.updated != nil)
+		})
+	}
+}
+
+func TestService_CreateAccount_blockedCard(t *testing.T) {
+	currentTime := time.Now()
+
+	config := rules.DefaultConfig()
+	config.CardTesting.BlockCard = true
+
+	storage := &historyStorage{}
+	for i, merchant := range []string{"a", "b", "c", "d"} {
+		storage.transactions = append(storage.transactions, model.Transaction{
+			Merchant: merchant,
+			Amount:   1,
+			Time:     currentTime.Add(-time.Duration(i+1) * 2 * time.Minute),
+		})
+	}
+
+	s := New(storage, WithRulesConfig(config))
+
+	response, err := s.ProcessTransaction(ProcessTransaction{
+		Transaction: model.Transaction{Merchant: "e", Amount: 1, Time: currentTime},
+		AccountID:   2,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"card-testing-suspected"}, response.Violations)
+	assert.False(t, storage.updated.ActiveCard)
+
+	// the blocked account still exists, it can't be replaced by a new active one
+	response, err = s.CreateAccount(CreateAccount{Account: model.Account{Id: 2, ActiveCard: true, AvailableLimit: 500}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"account-already-initialized"}, response.Violations)
+	assert.False(t, response.Account.ActiveCard)
+	assert.Equal(t, 110, response.Account.AvailableLimit)
+}
+
+// historyStorage is a mockStorage that returns a fixed history and records account updates and declined attempts
+type historyStorage struct {
+	mockStorage
+	transactions []model.Transaction
+	declined     []model.DeclinedTransaction
+	updated      *model.Account
+}
+
+func (h *historyStorage) Begin() (UnitOfWork, error) {
+	return nopUnitOfWork{h}, nil
+}
+
+func (h *historyStorage) GetTransactions(accountID int) []model.Transaction {
+	return h.transactions
+}
+
+func (h *historyStorage) GetAccount(aID int) model.Account {
+	if h.updated != nil {
+		return *h.updated
+	}
+
+	return h.mockStorage.GetAccount(aID)
+}
+
+func (h *historyStorage) RecordDeclined(accountID int, d model.DeclinedTransaction) error {
+	h.declined = append(h.declined, d)
+
+	return nil
+}
+
+func (h *historyStorage) GetDeclined(accountID int) []model.DeclinedTransaction {
+	return h.declined
+}
+
+func (h *historyStorage) UpdateAccount(a model.Account) error {
+	h.updated = &a
+
+	return nil
+}
+
+func TestService_SetRuleSettings(t *testing.T) {
+	window := model.Duration{Duration: 10 * time.Minute}
+
+	tests := []struct {
+		name         string
+		stored       model.RuleSettings
+		args         SetRuleSettings
+		wantResponse TransactionResponse
+		wantErr      error
+	}{
+		{"success",
+			nil,
+			SetRuleSettings{
+				RuleSettings: model.RuleSettings{"highFrequency": {Disabled: true}},
+				AccountID:    2,
+			},
+			TransactionResponse{
+				Account: model.Account{
+					Id:             2,
+					ActiveCard:     true,
+					AvailableLimit: 110,
+					RuleSettings:   model.RuleSettings{"highFrequency": {Disabled: true}},
+				},
+				Violations: []string{},
+			},
+			nil,
+		},
+		{"merge",
+			model.RuleSettings{"highFrequency": {Disabled: true}, "cardTesting": {Threshold: 10}},
+			SetRuleSettings{
+				RuleSettings: model.RuleSettings{"highFrequency": {}, "doubleTransaction": {Window: &window}},
+				AccountID:    2,
+			},
+			TransactionResponse{
+				Account: model.Account{
+					Id:             2,
+					ActiveCard:     true,
+					AvailableLimit: 110,
+					RuleSettings: model.RuleSettings{
+						"cardTesting":       {Threshold: 10},
+						"doubleTransaction": {Window: &window},
+					},
+				},
+				Violations: []string{},
+			},
+			nil,
+		},
+		{"unknownRule",
+			nil,
+			SetRuleSettings{
+				RuleSettings: model.RuleSettings{"isActive": {Disabled: true}},
+				AccountID:    2,
+			},
+			TransactionResponse{
+				Account: model.Account{
+					Id:             2,
+					ActiveCard:     true,
+					AvailableLimit: 110,
+				},
+				Violations: []string{"invalid-rule-settings"},
+			},
+			nil,
+		},
+		{"accountNotInitialized",
+			nil,
+			SetRuleSettings{
+				RuleSettings: model.RuleSettings{"highFrequency": {Disabled: true}},
+				AccountID:    1,
+			},
+			TransactionResponse{
+				Account:    model.Account{},
+				Violations: []string{"account-not-initialized"},
+			},
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(&settingsStorage{settings: tt.stored})
+
+			gotResponse, err := s.SetRuleSettings(tt.args)
+			assert.Equal(t, tt.wantResponse, gotResponse)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+// settingsStorage is a mockStorage where only the account 2 exists, with the given rule settings
+type settingsStorage struct {
+	mockStorage
+	settings model.RuleSettings
+}
+
+func (s *settingsStorage) Begin() (UnitOfWork, error) {
+	return nopUnitOfWork{s}, nil
+}
+
+func (s *settingsStorage) GetAccount(aID int) model.Account {
+	account := s.mockStorage.GetAccount(aID)
+	if aID == 2 {
+		account.RuleSettings = s.settings
+	}
+
+	return account
+}
+
+func (s *settingsStorage) UpdateAccount(a model.Account) error {
+	if a.Id != 2 {
+		return model.ErrAccountNotFound
+	}
+
+	s.settings = a.RuleSettings
+
+	return nil
+}
+
+func TestService_ProcessTransaction_ruleSetVersion(t *testing.T) {
+	config := rules.DefaultConfig()
+	config.Version = "v1"
+
+	store := rules.NewStore(config)
+	s := New(&mockStorage{}, WithRulesStore(store))
+
+	tx := ProcessTransaction{
+		Transaction: model.Transaction{Merchant: "uno", Amount: 10, Time: time.Now()},
+		AccountID:   2,
+	}
+
+	gotResponse, err := s.ProcessTransaction(tx)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", gotResponse.RuleSetVersion)
+
+	tx.AccountID = 1
+	gotResponse, err = s.ProcessTransaction(tx)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", gotResponse.RuleSetVersion)
+	assert.Equal(t, []string{"card-not-active"}, gotResponse.Violations)
+}
+
+func TestService_ProcessTransaction_explain(t *testing.T) {
+	tx := ProcessTransaction{
+		Transaction: model.Transaction{Merchant: "uno", Amount: 10, Time: time.Now()},
+		AccountID:   1,
+	}
+
+	tests := []struct {
+		name        string
+		service     *Service
+		explain     bool
+		wantExplain bool
+	}{
+		{"notExplained", New(&mockStorage{}), false, false},
+		{"explainRequest", New(&mockStorage{}), true, true},
+		{"explainService", New(&mockStorage{}, WithExplain(true)), false, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tx.Explain = tt.explain
+
+			gotResponse, err := tt.service.ProcessTransaction(tx)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"card-not-active"}, gotResponse.Violations)
+			assert.Equal(t, tt.wantExplain, len(gotResponse.Explanation) > 0)
+
+			if tt.wantExplain {
+				assert.Equal(t, rules.RuleIsActive, gotResponse.Explanation[0].Rule)
+				assert.False(t, gotResponse.Explanation[0].Passed)
+			}
+		})
+	}
+}
+
+func TestService_ProcessTransaction_logFields(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	s := New(&mockStorage{})
+
+	_, err := s.ProcessTransaction(ProcessTransaction{
+		Transaction: model.Transaction{Merchant: "uno", Amount: 10, Time: time.Now()},
+		AccountID:   1,
+		RequestID:   "request-1",
+	})
+	assert.NoError(t, err)
+
+	violation := hook.AllEntries()[0]
+	assert.Equal(t, "violation:card-not-active", violation.Message)
+	assert.Equal(t, 1, violation.Data["accountId"])
+	assert.Equal(t, "request-1", violation.Data["requestId"])
+}
+
+func TestService_ProcessTransaction_events(t *testing.T) {
+	currentTime := time.Now()
+	storage := &eventStorage{}
+	s := New(storage, WithRulesConfig(rules.Config{Version: "v1"}))
+
+	for _, accountID := range []int{2, 1} {
+		_, err := s.ProcessTransaction(ProcessTransaction{
+			Transaction: model.Transaction{Merchant: "uno", Amount: 10, Time: currentTime},
+			AccountID:   accountID,
+			RequestID:   "request-" + strconv.Itoa(accountID),
+		})
+		assert.NoError(t, err)
+	}
+
+	assert.Len(t, storage.events, 2)
+
+	for i := range storage.events {
+		assert.NotEmpty(t, storage.events[i].ID)
+		storage.events[i].ID = ""
+	}
+
+	tx := model.Transaction{Merchant: "uno", Amount: 10, Time: currentTime}
+	assert.Equal(t, []model.AuthorizationEvent{
+		{AccountID: 2, RequestID: "request-2", Transaction: tx, Approved: true, Violations: []string{},
+			AvailableLimit: 110, RuleSetVersion: "v1"},
+		{AccountID: 1, RequestID: "request-1", Transaction: tx, Violations: []string{"card-not-active"},
+			RuleSetVersion: "v1"},
+	}, storage.events)
+}
+
+// eventStorage is a mockStorage that records the events of its units of work
+type eventStorage struct {
+	mockStorage
+	events []model.AuthorizationEvent
+}
+
+func (e *eventStorage) Begin() (UnitOfWork, error) {
+	return eventUnitOfWork{nopUnitOfWork{e}, e}, nil
+}
+
+type eventUnitOfWork struct {
+	nopUnitOfWork
+	storage *eventStorage
+}
+
+func (u eventUnitOfWork) AppendEvent(e model.AuthorizationEvent) error {
+	u.storage.events = append(u.storage.events, e)
+
+	return nil
+}
+
+func TestNotifications_Event(t *testing.T) {
+	tx := model.Transaction{Merchant: "uno", Amount: 20, Time: time.Now()}
+	declined := model.AuthorizationEvent{ID: "e1", AccountID: 1, RequestID: "r1", Transaction: tx,
+		Violations: []string{"card-not-active"}}
+	approved := model.AuthorizationEvent{ID: "e2", AccountID: 2, Transaction: tx, Approved: true,
+		Violations: []string{}, AvailableLimit: 110}
+
+	tests := []struct {
+		name          string
+		event         model.AuthorizationEvent
+		notifications Notifications
+		want          Event
+		wantOK        bool
+	}{
+		{"declinedNotified", declined, Notifications{Violations: []string{"card-not-active"}}, Event{
+			ID:          "e1",
+			Type:        EventCardDeclined,
+			AccountID:   1,
+			RequestID:   "r1",
+			Violation:   "card-not-active",
+			Transaction: tx,
+		}, true},
+		{"declinedNotSelected", declined, Notifications{Violations: []string{"insufficient-limit"}}, Event{}, false},
+		{"lowLimitCrossed", approved, Notifications{LowLimit: 120}, Event{
+			ID:             "e2",
+			Type:           EventLowLimit,
+			AccountID:      2,
+			AvailableLimit: 110,
+			Transaction:    tx,
+		}, true},
+		{"lowLimitAlreadyBelow", approved, Notifications{LowLimit: 200}, Event{}, false},
+		{"lowLimitNotReached", approved, Notifications{LowLimit: 50}, Event{}, false},
+		{"declinedBelowLowLimit", declined, Notifications{LowLimit: 50}, Event{}, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.notifications.Event(tt.event)
+			assert.Equal(t, tt.wantOK, ok)
+
+			if tt.wantOK {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/app/service"
+)
+
+// Version is the version of the snapshot format written by Export,
+// Import rejects the files of other versions
+const Version = 1
+
+// ErrChecksum is returned when the content of a snapshot doesn't match its checksum
+var ErrChecksum = errors.New("snapshot checksum doesn't match")
+
+// Storage is a service.Storage that can list its accounts and restore them with their history
+type Storage interface {
+	service.Storage
+	Accounts() []int
+	GetDailyTotals(accountID int) []model.DailyTotal
+	RestoreAccount(a model.Account, history []model.Transaction, totals []model.DailyTotal) error
+	RestoreDeclined(accountID int, declined []model.DeclinedTransaction) error
+	GetOutbox() ([]model.AuthorizationEvent, int)
+	RestoreOutbox(events []model.AuthorizationEvent, lastOffset int) error
+}
+
+// Snapshot is the full state of the authorizer
+type Snapshot struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Checksum is the sha256 of the accounts serialized as json, followed by the events when there are
+	Checksum string    `json:"checksum"`
+	Accounts []Account `json:"accounts"`
+	// Events is omitted when no event was appended, so older snapshots keep their checksum
+	Events *Events `json:"events,omitempty"`
+}
+
+// Events is the outbox of the authorization events, the events appended after a restore continue after LastOffset
+// so the consumers can keep reading with the offset they stored
+type Events struct {
+	LastOffset int                        `json:"lastOffset"`
+	Outbox     []model.AuthorizationEvent `json:"outbox"`
+}
+
+// Account is an account with its settings and its transaction history
+type Account struct {
+	Id             int                `json:"id"`
+	ActiveCard     bool               `json:"activeCard"`
+	AvailableLimit int                `json:"availableLimit"`
+	HomeCountry    string             `json:"homeCountry,omitempty"`
+	RuleSettings   model.RuleSettings `json:"ruleSettings,omitempty"`
+	Version        int                `json:"version,omitempty"`
+	History        []Transaction      `json:"history"`
+	// DailyTotals are the aggregates of the transactions that were removed from the history
+	DailyTotals []model.DailyTotal `json:"dailyTotals,omitempty"`
+	// Declined are the declined attempts, they are omitted when there are none so older snapshots keep their checksum
+	Declined []DeclinedTransaction `json:"declined,omitempty"`
+	// CreditLine is omitted for the accounts without one, as Declined
+	CreditLine *model.CreditLine `json:"creditLine,omitempty"`
+}
+
+// Transaction is a transaction of the history, unlike model.Transaction its id is serialized
+type Transaction struct {
+	Id          string             `json:"id"`
+	Merchant    string             `json:"merchant"`
+	Amount      int                `json:"amount"`
+	Time        time.Time          `json:"time"`
+	Country     string             `json:"country,omitempty"`
+	Coordinates *model.Coordinates `json:"coordinates,omitempty"`
+}
+
+// DeclinedTransaction is a declined attempt with the violations that declined it
+type DeclinedTransaction struct {
+	Transaction
+	Violations []string `json:"violations"`
+}
+
+// Take reads every account of the storage and the outbox of the events
+func Take(s Storage, now time.Time) (Snapshot, error) {
+	snap := Snapshot{Version: Version, CreatedAt: now, Accounts: []Account{}}
+
+	for _, id := range s.Accounts() {
+		a := s.GetAccount(id)
+		account := Account{
+			Id:             a.Id,
+			ActiveCard:     a.ActiveCard,
+			AvailableLimit: a.AvailableLimit,
+			HomeCountry:    a.HomeCountry,
+			RuleSettings:   a.RuleSettings,
+			CreditLine:     a.CreditLine,
+			Version:        a.Version,
+			History:        []Transaction{},
+			DailyTotals:    s.GetDailyTotals(id),
+		}
+
+		for _, t := range s.GetTransactions(id) {
+			account.History = append(account.History, Transaction(t))
+		}
+
+		for _, d := range s.GetDeclined(id) {
+			account.Declined = append(account.Declined, DeclinedTransaction{Transaction(d.Transaction), d.Violations})
+		}
+
+		snap.Accounts = append(snap.Accounts, account)
+	}
+
+	if outbox, lastOffset := s.GetOutbox(); lastOffset > 0 {
+		snap.Events = &Events{LastOffset: lastOffset, Outbox: outbox}
+	}
+
+	checksum, err := checksum(snap.Accounts, snap.Events)
+	if err != nil {
+		return snap, err
+	}
+
+	snap.Checksum = checksum
+
+	return snap, nil
+}
+
+// Restore writes every account of the snapshot in an empty storage
+func Restore(s Storage, snap Snapshot) error {
+	if err := snap.Verify(); err != nil {
+		return err
+	}
+
+	if len(s.Accounts()) > 0 {
+		return errors.New("a snapshot can only be restored in an empty storage")
+	}
+
+	for _, a := range snap.Accounts {
+		history := make([]model.Transaction, 0, len(a.History))
+		for _, t := range a.History {
+			history = append(history, model.Transaction(t))
+		}
+
+		account := model.Account{
+			Id:             a.Id,
+			ActiveCard:     a.ActiveCard,
+			AvailableLimit: a.AvailableLimit,
+			HomeCountry:    a.HomeCountry,
+			RuleSettings:   a.RuleSettings,
+			CreditLine:     a.CreditLine.Copy(),
+			Version:        a.Version,
+		}
+
+		if err := s.RestoreAccount(account, history, a.DailyTotals); err != nil {
+			return fmt.Errorf("error restoring account %d: %w", a.Id, err)
+		}
+
+		if len(a.Declined) == 0 {
+			continue
+		}
+
+		declined := make([]model.DeclinedTransaction, 0, len(a.Declined))
+		for _, d := range a.Declined {
+			declined = append(declined, model.DeclinedTransaction{
+				Transaction: model.Transaction(d.Transaction),
+				Violations:  d.Violations,
+			})
+		}
+
+		if err := s.RestoreDeclined(a.Id, declined); err != nil {
+			return fmt.Errorf("error restoring declined attempts of account %d: %w", a.Id, err)
+		}
+	}
+
+	if snap.Events != nil {
+		if err := s.RestoreOutbox(snap.Events.Outbox, snap.Events.LastOffset); err != nil {
+			return fmt.Errorf("error restoring events: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Verify checks the version and the checksum of the snapshot
+func (snap Snapshot) Verify() error {
+	if snap.Version != Version {
+		return fmt.Errorf("unsupported snapshot version %d, it must be %d", snap.Version, Version)
+	}
+
+	checksum, err := checksum(snap.Accounts, snap.Events)
+	if err != nil {
+		return err
+	}
+
+	if checksum != snap.Checksum {
+		return ErrChecksum
+	}
+
+	return nil
+}
+
+// Export writes the snapshot of the storage in path
+func Export(s Storage, path string) error {
+	snap, err := Take(s, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling snapshot: %w", err)
+	}
+
+	// the snapshot is written to a temporary file and renamed so it is never half written
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+
+	if err = os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// Import restores the snapshot in path into the storage, that must be empty
+func Import(s Storage, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading snapshot: %w", err)
+	}
+
+	var snap Snapshot
+	if err = json.Unmarshal(b, &snap); err != nil {
+		return fmt.Errorf("invalid snapshot: %w", err)
+	}
+
+	return Restore(s, snap)
+}
+
+func checksum(accounts []Account, events *Events) (string, error) {
+	b, err := json.Marshal(accounts)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling snapshot accounts: %w", err)
+	}
+
+	h := sha256.New()
+	h.Write(b)
+
+	if events != nil {
+		if b, err = json.Marshal(events); err != nil {
+			return "", fmt.Errorf("error marshaling snapshot events: %w", err)
+		}
+
+		h.Write(b)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
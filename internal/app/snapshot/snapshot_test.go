@@ -0,0 +1,146 @@
+package snapshot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/app/storage"
+)
+
+func seededStorage(t *testing.T) *storage.InMemory {
+	db := &storage.InMemory{}
+
+	assert.NoError(t, db.CreateAccount(model.Account{
+		Id:             1,
+		ActiveCard:     true,
+		AvailableLimit: 100,
+		HomeCountry:    "BR",
+		RuleSettings:   model.RuleSettings{"highFrequency": {Disabled: true}},
+	}))
+
+	_, err := db.ExecuteTransaction(db.GetAccount(1), model.Transaction{
+		Merchant:    "Burger King",
+		Amount:      20,
+		Time:        time.Date(2019, 2, 13, 10, 0, 0, 0, time.UTC),
+		Country:     "BR",
+		Coordinates: &model.Coordinates{Latitude: -23.5, Longitude: -46.6},
+	})
+	assert.NoError(t, err)
+
+	return db
+}
+
+func TestExportImport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.snapshot")
+	db := seededStorage(t)
+
+	assert.NoError(t, db.RecordDeclined(1, model.DeclinedTransaction{
+		Transaction: model.Transaction{Merchant: "Oxxo", Amount: 500, Time: time.Now()},
+		Violations:  []string{"insufficient-limit"},
+	}))
+
+	// the transaction of 2019 is older than the horizon before the declined attempt, it is moved to the daily totals
+	_, err := db.Compact(storage.Retention{Horizon: time.Hour})
+	assert.NoError(t, err)
+	assert.Len(t, db.GetDailyTotals(1), 1)
+
+	nextClose := time.Date(2019, 3, 10, 0, 0, 0, 0, time.UTC)
+	credit := &model.CreditLine{
+		Limit:      50,
+		ClosingDay: 10,
+		DueDays:    20,
+		NextClose:  &nextClose,
+		Statement:  &model.BillingStatement{ClosedAt: nextClose.AddDate(0, -1, 0), Balance: 10, MinimumPayment: 10},
+	}
+	assert.NoError(t, db.CreateAccount(model.Account{Id: 2, ActiveCard: true, AvailableLimit: 50, CreditLine: credit}))
+
+	assert.NoError(t, Export(db, path))
+
+	restored := &storage.InMemory{}
+	assert.NoError(t, Import(restored, path))
+
+	assert.Equal(t, db.Accounts(), restored.Accounts())
+	assert.Equal(t, db.GetAccount(1), restored.GetAccount(1))
+	assert.Equal(t, db.GetAccount(2), restored.GetAccount(2))
+	assert.Equal(t, db.GetDailyTotals(1), restored.GetDailyTotals(1))
+
+	wantDeclined := db.GetDeclined(1)
+	gotDeclined := restored.GetDeclined(1)
+	assert.Len(t, gotDeclined, 1)
+	assert.Equal(t, wantDeclined[0].Id, gotDeclined[0].Id)
+	assert.Equal(t, []string{"insufficient-limit"}, gotDeclined[0].Violations)
+	assert.True(t, wantDeclined[0].Time.Equal(gotDeclined[0].Time))
+
+	want := db.GetTransactions(1)
+	got := restored.GetTransactions(1)
+	assert.Len(t, got, len(want))
+
+	for i := range want {
+		assert.Equal(t, want[i].Id, got[i].Id)
+		assert.Equal(t, want[i].Amount, got[i].Amount)
+		assert.True(t, want[i].Time.Equal(got[i].Time))
+		assert.Equal(t, want[i].Coordinates, got[i].Coordinates)
+	}
+
+	t.Run("events continue after the last offset", func(t *testing.T) {
+		db := seededStorage(t)
+
+		uow, err := db.Begin()
+		assert.NoError(t, err)
+		assert.NoError(t, uow.AppendEvent(model.AuthorizationEvent{ID: "a", AccountID: 1, Violations: []string{}}))
+		assert.NoError(t, uow.AppendEvent(model.AuthorizationEvent{ID: "b", AccountID: 1, Violations: []string{}}))
+		assert.NoError(t, uow.Commit())
+
+		path := filepath.Join(t.TempDir(), "events.snapshot")
+		assert.NoError(t, Export(db, path))
+
+		restored := &storage.InMemory{}
+		assert.NoError(t, Import(restored, path))
+
+		uow, err = restored.Begin()
+		assert.NoError(t, err)
+		assert.NoError(t, uow.AppendEvent(model.AuthorizationEvent{ID: "c", AccountID: 1, Violations: []string{}}))
+		assert.NoError(t, uow.Commit())
+
+		events, _, err := restored.Events(1, 10)
+		assert.NoError(t, err)
+		assert.Len(t, events, 2)
+		assert.Equal(t, "b", events[0].ID)
+		assert.Equal(t, 3, events[1].Offset)
+	})
+
+	t.Run("storage is not empty", func(t *testing.T) {
+		assert.Error(t, Import(restored, path))
+	})
+}
+
+func TestImport_invalid(t *testing.T) {
+	snap, err := Take(seededStorage(t), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+
+	tampered := snap
+	tampered.Accounts = []Account{snap.Accounts[0]}
+	tampered.Accounts[0].AvailableLimit = 1000
+	assert.True(t, errors.Is(Restore(&storage.InMemory{}, tampered), ErrChecksum))
+
+	withEvents := snap
+	withEvents.Events = &Events{LastOffset: 7}
+	assert.True(t, errors.Is(Restore(&storage.InMemory{}, withEvents), ErrChecksum))
+
+	otherVersion := snap
+	otherVersion.Version = Version + 1
+	assert.Error(t, Restore(&storage.InMemory{}, otherVersion))
+
+	path := filepath.Join(t.TempDir(), "state.snapshot")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"version": 1, "accounts": [`), 0600))
+
+	err = Import(&storage.InMemory{}, path)
+	assert.True(t, err != nil && strings.Contains(err.Error(), "invalid snapshot"))
+}
@@ -1,22 +1,41 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 
 	"authorizer/internal/app/model"
+	"authorizer/internal/app/service"
 )
 
 // InMemory is my way to simulate a Database,
 // this version of the database has a table account and a table transaction
-// The PK of Account is Id even though it is not needed for this example (we are using always ID 1)
+// The PK of Account is Id, the ndjson input uses ID 1 unless the line has an accountId
 // Id is also the FK in Transaction to relate the transactions to the Account
 
+// Every method locks the database, a unit of work keeps it locked until it is committed or rolled back
 type InMemory struct {
+	mu      sync.Mutex
 	History map[int][]Transaction
 	Account map[int]Account
+	// DailyTotals are the aggregates of the transactions removed from the History by Compact
+	DailyTotals map[int][]model.DailyTotal
+	// Declined are the declined attempts of every account, they are not part of the History
+	Declined map[int][]DeclinedTransaction
+	// Outbox are the events of the decisions in the order they were committed, the oldest are removed by Compact
+	Outbox []model.AuthorizationEvent
+	// lastOffset is the offset of the last event appended, the outbox is empty after it is compacted
+	lastOffset int
+	// committed is closed and replaced when a unit of work that appended events is committed
+	committed chan struct{}
+	// compacting serializes the compactions, the archive is written without holding mu
+	compacting sync.Mutex
 }
 
 // Account in this package represents the table of Accounts in the simulated DB
@@ -24,14 +43,26 @@ type Account struct {
 	Id             int
 	ActiveCard     bool
 	AvailableLimit int
+	HomeCountry    string
+	RuleSettings   model.RuleSettings
+	CreditLine     *model.CreditLine
+	Version        int
 }
 
 // Transaction in this package represents the table of Transactions in the simulated DB
 type Transaction struct {
-	Id       uuid.UUID
-	Merchant string
-	Amount   int
-	Time     time.Time
+	Id          uuid.UUID
+	Merchant    string
+	Amount      int
+	Time        time.Time
+	Country     string
+	Coordinates *model.Coordinates
+}
+
+// DeclinedTransaction in this package represents the table of declined attempts in the simulated DB
+type DeclinedTransaction struct {
+	Transaction
+	Violations []string
 }
 
 // GenerateAccountID is the function to get the sequential ID for the accounts,
@@ -43,11 +74,18 @@ func (im *InMemory) GenerateAccountID() int {
 // CreateAccount is the function needed to create an account,
 // it creates the "initial" transaction on the Transaction Map and adds the new record to Account map
 func (im *InMemory) CreateAccount(a model.Account) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	return im.createAccount(a)
+}
+
+func (im *InMemory) createAccount(a model.Account) error {
 	log.Debugf("creation account: %+v", a)
 
 	t := Transaction{
 		Id:       uuid.New(),
-		Merchant: "initial",
+		Merchant: model.InitialMerchant,
 		Amount:   a.AvailableLimit,
 		Time:     time.Now(),
 	}
@@ -60,35 +98,68 @@ func (im *InMemory) CreateAccount(a model.Account) error {
 		Id:             a.Id,
 		ActiveCard:     a.ActiveCard,
 		AvailableLimit: a.AvailableLimit,
+		HomeCountry:    a.HomeCountry,
+		RuleSettings:   a.RuleSettings.Copy(),
+		CreditLine:     a.CreditLine.Copy(),
+		Version:        1,
 	}
 
-	im.History = make(map[int][]Transaction)
+	if im.Account == nil {
+		im.Account = make(map[int]Account)
+	}
 
-	im.History[a.Id] = transactions
+	if im.History == nil {
+		im.History = make(map[int][]Transaction)
+	}
 
-	im.Account = make(map[int]Account)
+	if im.DailyTotals == nil {
+		im.DailyTotals = make(map[int][]model.DailyTotal)
+	}
 
+	// the other accounts are kept, only the history of this one starts again
+	im.History[a.Id] = transactions
 	im.Account[a.Id] = account
+	delete(im.DailyTotals, a.Id)
+	delete(im.Declined, a.Id)
 
 	return nil
 }
 
 // ExecuteTransaction is the operation in storage that updates the availableLimit
-// and registers a new transaction in the transactionHistory
+// and registers a new transaction in the transactionHistory,
+// it fails with *model.ConflictError when the version of the account is not the stored one
 func (im *InMemory) ExecuteTransaction(a model.Account, t model.Transaction) (model.Account, error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	return im.executeTransaction(a, t)
+}
+
+func (im *InMemory) executeTransaction(a model.Account, t model.Transaction) (model.Account, error) {
+	if err := im.checkVersion(a); err != nil {
+		return a, err
+	}
+
 	transaction := Transaction{
-		Id:       uuid.New(),
-		Merchant: t.Merchant,
-		Amount:   t.Amount,
-		Time:     t.Time,
+		Id:          uuid.New(),
+		Merchant:    t.Merchant,
+		Amount:      t.Amount,
+		Time:        t.Time,
+		Country:     t.Country,
+		Coordinates: t.Coordinates,
 	}
 
 	a.AvailableLimit -= t.Amount
+	a.Version++
 
 	account := Account{
 		Id:             a.Id,
 		ActiveCard:     a.ActiveCard,
 		AvailableLimit: a.AvailableLimit,
+		HomeCountry:    a.HomeCountry,
+		RuleSettings:   a.RuleSettings.Copy(),
+		CreditLine:     a.CreditLine.Copy(),
+		Version:        a.Version,
 	}
 
 	im.Account[a.Id] = account
@@ -98,12 +169,78 @@ func (im *InMemory) ExecuteTransaction(a model.Account, t model.Transaction) (mo
 	return a, nil
 }
 
+// ExecutePayment is the operation in storage that restores the availableLimit with a payment, the payment is
+// registered in the transactionHistory as a transaction of model.PaymentMerchant with a negative amount.
+// It fails with *model.ConflictError when the version of the account is not the stored one
+func (im *InMemory) ExecutePayment(a model.Account, p model.Payment) (model.Account, error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	return im.executePayment(a, p)
+}
+
+func (im *InMemory) executePayment(a model.Account, p model.Payment) (model.Account, error) {
+	return im.executeTransaction(a, model.Transaction{Merchant: model.PaymentMerchant, Amount: -p.Amount, Time: p.Time})
+}
+
+// UpdateAccount overwrites the fields of an existing account without registering a transaction,
+// it is used to change the status of the card.
+// It fails with *model.ConflictError when the version of the account is not the stored one
+func (im *InMemory) UpdateAccount(a model.Account) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	return im.updateAccount(a)
+}
+
+func (im *InMemory) updateAccount(a model.Account) error {
+	if _, ok := im.Account[a.Id]; !ok {
+		return fmt.Errorf("%w: %d", model.ErrAccountNotFound, a.Id)
+	}
+
+	if err := im.checkVersion(a); err != nil {
+		return err
+	}
+
+	im.Account[a.Id] = Account{
+		Id:             a.Id,
+		ActiveCard:     a.ActiveCard,
+		AvailableLimit: a.AvailableLimit,
+		HomeCountry:    a.HomeCountry,
+		RuleSettings:   a.RuleSettings.Copy(),
+		CreditLine:     a.CreditLine.Copy(),
+		Version:        a.Version + 1,
+	}
+
+	return nil
+}
+
+// checkVersion verifies that the account wasn't written after it was read
+func (im *InMemory) checkVersion(a model.Account) error {
+	if stored := im.Account[a.Id].Version; stored != a.Version {
+		return &model.ConflictError{AccountID: a.Id, Version: a.Version, Stored: stored}
+	}
+
+	return nil
+}
+
 // GetAccount gets the info of the account using the account ID
 func (im *InMemory) GetAccount(accountID int) model.Account {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	return im.getAccount(accountID)
+}
+
+func (im *InMemory) getAccount(accountID int) model.Account {
 	account := model.Account{
 		Id:             accountID,
 		ActiveCard:     im.Account[accountID].ActiveCard,
 		AvailableLimit: im.Account[accountID].AvailableLimit,
+		HomeCountry:    im.Account[accountID].HomeCountry,
+		RuleSettings:   im.Account[accountID].RuleSettings.Copy(),
+		CreditLine:     im.Account[accountID].CreditLine.Copy(),
+		Version:        im.Account[accountID].Version,
 	}
 
 	return account
@@ -111,13 +248,23 @@ func (im *InMemory) GetAccount(accountID int) model.Account {
 
 // GetTransactions gets all the transactions related to an account ID
 func (im *InMemory) GetTransactions(accountID int) []model.Transaction {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	return im.getTransactions(accountID)
+}
+
+func (im *InMemory) getTransactions(accountID int) []model.Transaction {
 	response := []model.Transaction{}
 
 	for _, v := range im.History[accountID] {
 		tx := model.Transaction{
-			Merchant: v.Merchant,
-			Amount:   v.Amount,
-			Time:     v.Time,
+			Id:          v.Id.String(),
+			Merchant:    v.Merchant,
+			Amount:      v.Amount,
+			Time:        v.Time,
+			Country:     v.Country,
+			Coordinates: v.Coordinates,
 		}
 
 		response = append(response, tx)
@@ -126,6 +273,429 @@ func (im *InMemory) GetTransactions(accountID int) []model.Transaction {
 	return response
 }
 
+// RecordDeclined adds a declined attempt to the account, the attempts of accounts that don't exist are not kept
+func (im *InMemory) RecordDeclined(accountID int, d model.DeclinedTransaction) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	return im.recordDeclined(accountID, d)
+}
+
+func (im *InMemory) recordDeclined(accountID int, d model.DeclinedTransaction) error {
+	if _, ok := im.Account[accountID]; !ok {
+		return fmt.Errorf("declined attempt of account %d: %w", accountID, model.ErrAccountNotFound)
+	}
+
+	if im.Declined == nil {
+		im.Declined = make(map[int][]DeclinedTransaction)
+	}
+
+	im.Declined[accountID] = append(im.Declined[accountID], DeclinedTransaction{
+		Transaction: Transaction{
+			Id:          uuid.New(),
+			Merchant:    d.Merchant,
+			Amount:      d.Amount,
+			Time:        d.Time,
+			Country:     d.Country,
+			Coordinates: d.Coordinates,
+		},
+		Violations: append([]string{}, d.Violations...),
+	})
+
+	return nil
+}
+
+// GetDeclined gets the declined attempts of an account in the order they were recorded
+func (im *InMemory) GetDeclined(accountID int) []model.DeclinedTransaction {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	return im.getDeclined(accountID)
+}
+
+func (im *InMemory) getDeclined(accountID int) []model.DeclinedTransaction {
+	response := []model.DeclinedTransaction{}
+
+	for _, d := range im.Declined[accountID] {
+		response = append(response, model.DeclinedTransaction{
+			Transaction: model.Transaction{
+				Id:          d.Id.String(),
+				Merchant:    d.Merchant,
+				Amount:      d.Amount,
+				Time:        d.Time,
+				Country:     d.Country,
+				Coordinates: d.Coordinates,
+			},
+			Violations: append([]string{}, d.Violations...),
+		})
+	}
+
+	return response
+}
+
+// RestoreDeclined adds the declined attempts of an account restored by RestoreAccount as they were exported
+func (im *InMemory) RestoreDeclined(accountID int, declined []model.DeclinedTransaction) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	if _, ok := im.Account[accountID]; !ok {
+		return fmt.Errorf("declined attempts of account %d: %w", accountID, model.ErrAccountNotFound)
+	}
+
+	attempts := make([]DeclinedTransaction, 0, len(declined))
+
+	for _, d := range declined {
+		id, err := uuid.Parse(d.Id)
+		if err != nil {
+			return fmt.Errorf("invalid declined attempt id %q of account %d: %w", d.Id, accountID, err)
+		}
+
+		attempts = append(attempts, DeclinedTransaction{
+			Transaction: Transaction{
+				Id:          id,
+				Merchant:    d.Merchant,
+				Amount:      d.Amount,
+				Time:        d.Time,
+				Country:     d.Country,
+				Coordinates: d.Coordinates,
+			},
+			Violations: append([]string{}, d.Violations...),
+		})
+	}
+
+	if im.Declined == nil {
+		im.Declined = make(map[int][]DeclinedTransaction)
+	}
+
+	im.Declined[accountID] = attempts
+
+	return nil
+}
+
+// Accounts returns the IDs of all the accounts in order
+func (im *InMemory) Accounts() []int {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	ids := make([]int, 0, len(im.Account))
+	for id := range im.Account {
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
+
+// RestoreAccount adds an account with its transaction history and daily totals as they were exported,
+// unlike CreateAccount it keeps the other accounts and doesn't register an initial transaction
+func (im *InMemory) RestoreAccount(a model.Account, history []model.Transaction, totals []model.DailyTotal) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	if _, ok := im.Account[a.Id]; ok {
+		return fmt.Errorf("account %d already exists", a.Id)
+	}
+
+	transactions := make([]Transaction, 0, len(history))
+
+	for _, t := range history {
+		id, err := uuid.Parse(t.Id)
+		if err != nil {
+			return fmt.Errorf("invalid transaction id %q of account %d: %w", t.Id, a.Id, err)
+		}
+
+		transactions = append(transactions, Transaction{
+			Id:          id,
+			Merchant:    t.Merchant,
+			Amount:      t.Amount,
+			Time:        t.Time,
+			Country:     t.Country,
+			Coordinates: t.Coordinates,
+		})
+	}
+
+	if im.Account == nil {
+		im.Account = make(map[int]Account)
+	}
+
+	if im.History == nil {
+		im.History = make(map[int][]Transaction)
+	}
+
+	if im.DailyTotals == nil {
+		im.DailyTotals = make(map[int][]model.DailyTotal)
+	}
+
+	version := a.Version
+	if version == 0 {
+		version = 1
+	}
+
+	im.Account[a.Id] = Account{
+		Id:             a.Id,
+		ActiveCard:     a.ActiveCard,
+		AvailableLimit: a.AvailableLimit,
+		HomeCountry:    a.HomeCountry,
+		RuleSettings:   a.RuleSettings.Copy(),
+		CreditLine:     a.CreditLine.Copy(),
+		Version:        version,
+	}
+	im.History[a.Id] = transactions
+
+	if len(totals) > 0 {
+		im.DailyTotals[a.Id] = append([]model.DailyTotal(nil), totals...)
+	}
+
+	return nil
+}
+
+// GetDailyTotals gets the aggregates of the transactions removed from the history of an account, ordered by day
+func (im *InMemory) GetDailyTotals(accountID int) []model.DailyTotal {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	return append([]model.DailyTotal{}, im.DailyTotals[accountID]...)
+}
+
+// Stats returns the number of accounts and the number of transactions stored in the history
+func (im *InMemory) Stats() (accounts int, transactions int) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	for _, history := range im.History {
+		transactions += len(history)
+	}
+
+	return len(im.Account), transactions
+}
+
+// Begin locks the database until the unit of work ends, its writes are applied directly
+// and undone if it is rolled back
+func (im *InMemory) Begin() (service.UnitOfWork, error) {
+	im.mu.Lock()
+
+	return &unitOfWork{im: im}, nil
+}
+
+// unitOfWork records how to undo every write, so Rollback leaves the accounts and their history as they were
+type unitOfWork struct {
+	im   *InMemory
+	undo []func()
+	done bool
+	// appended is true when the unit of work added events to the outbox, Commit wakes up their readers
+	appended bool
+}
+
+// CreateAccount replaces the account, its history and its daily totals, the previous ones are kept to be restored
+func (u *unitOfWork) CreateAccount(a model.Account) error {
+	u.saveAccount(a.Id)
+
+	totals, hasTotals := u.im.DailyTotals[a.Id]
+	u.undo = append(u.undo, func() {
+		if hasTotals {
+			u.im.DailyTotals[a.Id] = totals
+		}
+	})
+
+	return u.im.createAccount(a)
+}
+
+func (u *unitOfWork) GetAccount(accountID int) model.Account {
+	return u.im.getAccount(accountID)
+}
+
+func (u *unitOfWork) ExecuteTransaction(a model.Account, t model.Transaction) (model.Account, error) {
+	u.saveAccount(a.Id)
+
+	return u.im.executeTransaction(a, t)
+}
+
+func (u *unitOfWork) ExecutePayment(a model.Account, p model.Payment) (model.Account, error) {
+	u.saveAccount(a.Id)
+
+	return u.im.executePayment(a, p)
+}
+
+func (u *unitOfWork) UpdateAccount(a model.Account) error {
+	u.saveAccount(a.Id)
+
+	return u.im.updateAccount(a)
+}
+
+func (u *unitOfWork) GetTransactions(accountID int) []model.Transaction {
+	return u.im.getTransactions(accountID)
+}
+
+func (u *unitOfWork) RecordDeclined(accountID int, d model.DeclinedTransaction) error {
+	u.saveAccount(accountID)
+
+	return u.im.recordDeclined(accountID, d)
+}
+
+func (u *unitOfWork) GetDeclined(accountID int) []model.DeclinedTransaction {
+	return u.im.getDeclined(accountID)
+}
+
+// AppendEvent numbers the event and adds it to the outbox, the readers only see it after the commit because
+// the database is locked until then
+func (u *unitOfWork) AppendEvent(e model.AuthorizationEvent) error {
+	outbox, lastOffset := u.im.Outbox, u.im.lastOffset
+	u.undo = append(u.undo, func() {
+		u.im.Outbox, u.im.lastOffset = outbox, lastOffset
+	})
+
+	u.im.lastOffset++
+	e.Offset = u.im.lastOffset
+	e.Violations = append([]string{}, e.Violations...)
+	u.im.Outbox = append(u.im.Outbox, e)
+	u.appended = true
+
+	return nil
+}
+
+// saveAccount keeps the account, its history and its declined attempts before they are written, the transactions
+// are only appended so the slices are enough to restore them
+func (u *unitOfWork) saveAccount(accountID int) {
+	account, found := u.im.Account[accountID]
+	history, hasHistory := u.im.History[accountID]
+	declined, hasDeclined := u.im.Declined[accountID]
+
+	u.undo = append(u.undo, func() {
+		if found {
+			u.im.Account[accountID] = account
+		} else {
+			delete(u.im.Account, accountID)
+		}
+
+		if hasHistory {
+			u.im.History[accountID] = history
+		} else {
+			delete(u.im.History, accountID)
+		}
+
+		if hasDeclined {
+			u.im.Declined[accountID] = declined
+		} else {
+			delete(u.im.Declined, accountID)
+		}
+	})
+}
+
+func (u *unitOfWork) Commit() error {
+	if u.done {
+		return errors.New("unit of work already ended")
+	}
+
+	u.done = true
+
+	if u.appended {
+		u.im.eventsCommitted()
+	}
+
+	u.im.mu.Unlock()
+
+	return nil
+}
+
+func (u *unitOfWork) Rollback() error {
+	if u.done {
+		return nil
+	}
+
+	for i := len(u.undo) - 1; i >= 0; i-- {
+		u.undo[i]()
+	}
+
+	u.done = true
+	u.im.mu.Unlock()
+
+	return nil
+}
+
+// Events returns up to limit events of the outbox with an offset greater than after, they are copies so the caller
+// can keep them. The channel is closed when the next unit of work that appended events is committed
+func (im *InMemory) Events(after, limit int) ([]model.AuthorizationEvent, <-chan struct{}, error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	if im.committed == nil {
+		im.committed = make(chan struct{})
+	}
+
+	if after > im.lastOffset {
+		return nil, nil, fmt.Errorf("%w: the last event is %d", model.ErrOffsetAhead, im.lastOffset)
+	}
+
+	first := im.lastOffset - len(im.Outbox) + 1
+	if after+1 < first {
+		return nil, nil, &model.CompactedError{First: first}
+	}
+
+	start := after + 1 - first
+	if start > len(im.Outbox) {
+		start = len(im.Outbox)
+	}
+
+	end := len(im.Outbox)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	events := make([]model.AuthorizationEvent, end-start)
+	copy(events, im.Outbox[start:end])
+
+	return events, im.committed, nil
+}
+
+// GetOutbox returns a copy of the events of the outbox and the offset of the last event appended,
+// it is greater than the offset of the last event kept only when the outbox is empty
+func (im *InMemory) GetOutbox() ([]model.AuthorizationEvent, int) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	events := make([]model.AuthorizationEvent, len(im.Outbox))
+	copy(events, im.Outbox)
+
+	return events, im.lastOffset
+}
+
+// RestoreOutbox writes the events of an outbox in a storage without events, the next event appended
+// continues after lastOffset. The offsets of the events must be consecutive and end in lastOffset
+func (im *InMemory) RestoreOutbox(events []model.AuthorizationEvent, lastOffset int) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	if im.lastOffset != 0 {
+		return errors.New("the outbox already has events")
+	}
+
+	first := lastOffset - len(events) + 1
+	if first < 1 {
+		return fmt.Errorf("there are %d events before the offset %d", len(events), lastOffset)
+	}
+
+	for i, e := range events {
+		if e.Offset != first+i {
+			return fmt.Errorf("event %s has offset %d, it must be %d", e.ID, e.Offset, first+i)
+		}
+	}
+
+	im.Outbox = append([]model.AuthorizationEvent{}, events...)
+	im.lastOffset = lastOffset
+
+	return nil
+}
+
+// eventsCommitted wakes up the readers waiting for events, the database must be locked
+func (im *InMemory) eventsCommitted() {
+	if im.committed != nil {
+		close(im.committed)
+	}
+
+	im.committed = make(chan struct{})
+}
+
 // Close closes connection to DB (not really needed for this abstraction of a DB)
 func (im *InMemory) Close() error {
 	return nil
@@ -1,6 +1,9 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -70,6 +73,21 @@ func TestInMemory_CreateAccount(t *testing.T) {
 	}
 }
 
+func TestInMemory_CreateAccount_keepsOtherAccounts(t *testing.T) {
+	im := &InMemory{}
+	assert.NoError(t, im.CreateAccount(model.Account{Id: 1, ActiveCard: true, AvailableLimit: 100}))
+
+	_, err := im.ExecuteTransaction(im.GetAccount(1), model.Transaction{Merchant: "Burger King", Amount: 20})
+	assert.NoError(t, err)
+
+	assert.NoError(t, im.CreateAccount(model.Account{Id: 2, ActiveCard: true, AvailableLimit: 50}))
+
+	assert.Equal(t, []int{1, 2}, im.Accounts())
+	assert.Equal(t, 80, im.GetAccount(1).AvailableLimit)
+	assert.Len(t, im.GetTransactions(1), 2)
+	assert.Len(t, im.GetTransactions(2), 1)
+}
+
 func TestInMemory_GetTransactions(t *testing.T) {
 	type fields struct {
 		History map[int][]Transaction
@@ -111,11 +129,13 @@ func TestInMemory_GetTransactions(t *testing.T) {
 			args{accountID: 1},
 			[]model.Transaction{
 				{
+					Id:       "5171e74b-93dc-4198-8d14-f8b4731fa9c0",
 					Merchant: "Uno",
 					Amount:   100,
 					Time:     currentTime,
 				},
 				{
+					Id:       "5171e74b-93dc-4191-8d14-f8b4731fa9c0",
 					Merchant: "dos",
 					Amount:   101,
 					Time:     currentTime.Add(2 * time.Hour),
@@ -208,6 +228,353 @@ func TestInMemory_GetAccount(t *testing.T) {
 	}
 }
 
+func TestInMemory_UpdateAccount(t *testing.T) {
+	tests := []struct {
+		name    string
+		account map[int]Account
+		args    model.Account
+		want    map[int]Account
+		wantErr bool
+	}{
+		{"blockCard",
+			map[int]Account{1: {Id: 1, ActiveCard: true, AvailableLimit: 10}},
+			model.Account{Id: 1, ActiveCard: false, AvailableLimit: 10},
+			map[int]Account{1: {Id: 1, ActiveCard: false, AvailableLimit: 10, Version: 1}},
+			false,
+		},
+		{"ruleSettings",
+			map[int]Account{1: {Id: 1, ActiveCard: true, AvailableLimit: 10}},
+			model.Account{Id: 1, ActiveCard: true, AvailableLimit: 10,
+				RuleSettings: model.RuleSettings{"highFrequency": {Disabled: true}}},
+			map[int]Account{1: {Id: 1, ActiveCard: true, AvailableLimit: 10,
+				RuleSettings: model.RuleSettings{"highFrequency": {Disabled: true}}, Version: 1}},
+			false,
+		},
+		{"conflict",
+			map[int]Account{1: {Id: 1, ActiveCard: true, AvailableLimit: 10, Version: 3}},
+			model.Account{Id: 1, ActiveCard: false, AvailableLimit: 10, Version: 2},
+			map[int]Account{1: {Id: 1, ActiveCard: true, AvailableLimit: 10, Version: 3}},
+			true,
+		},
+		{"notFound",
+			map[int]Account{},
+			model.Account{Id: 1, ActiveCard: false, AvailableLimit: 10},
+			map[int]Account{},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			im := &InMemory{Account: tt.account}
+
+			err := im.UpdateAccount(tt.args)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, im.Account)
+		})
+	}
+}
+
+func TestInMemory_RestoreAccount(t *testing.T) {
+	im := &InMemory{}
+	history := []model.Transaction{
+		{Id: "0b5a1b5e-4b8c-4a54-9b0e-1f6f3c8c2a10", Merchant: "initial", Amount: 100},
+		{Id: "5c1d4a0e-7f3a-4d8e-8b5a-2e9c1d3f4b21", Merchant: "Burger King", Amount: 20, Country: "BR"},
+	}
+
+	assert.NoError(t, im.RestoreAccount(model.Account{Id: 2, ActiveCard: true, AvailableLimit: 80}, history, nil))
+	assert.NoError(t, im.RestoreAccount(model.Account{Id: 1, ActiveCard: true, AvailableLimit: 10}, nil, nil))
+
+	assert.Equal(t, []int{1, 2}, im.Accounts())
+	assert.Equal(t, history, im.GetTransactions(2))
+	assert.Equal(t, 80, im.GetAccount(2).AvailableLimit)
+
+	assert.Error(t, im.RestoreAccount(model.Account{Id: 1}, nil, nil))
+	assert.Error(t, im.RestoreAccount(model.Account{Id: 3}, []model.Transaction{{Id: "invalid"}}, nil))
+}
+
+func TestInMemory_Declined(t *testing.T) {
+	im := &InMemory{}
+	assert.NoError(t, im.CreateAccount(model.Account{Id: 1, ActiveCard: true, AvailableLimit: 100}))
+
+	attempt := model.DeclinedTransaction{
+		Transaction: model.Transaction{Merchant: "Oxxo", Amount: 500, Country: "MX"},
+		Violations:  []string{"insufficient-limit"},
+	}
+
+	assert.NoError(t, im.RecordDeclined(1, attempt))
+	assert.True(t, errors.Is(im.RecordDeclined(2, attempt), model.ErrAccountNotFound))
+
+	declined := im.GetDeclined(1)
+	assert.Len(t, declined, 1)
+	assert.NotEmpty(t, declined[0].Id)
+	assert.Equal(t, "MX", declined[0].Country)
+	assert.Equal(t, attempt.Violations, declined[0].Violations)
+	assert.Empty(t, im.GetDeclined(2))
+
+	// the declined attempts don't change the account nor the history
+	assert.Equal(t, 1, im.GetAccount(1).Version)
+	assert.Len(t, im.GetTransactions(1), 1)
+
+	t.Run("rollback", func(t *testing.T) {
+		uow, err := im.Begin()
+		assert.NoError(t, err)
+		assert.NoError(t, uow.RecordDeclined(1, attempt))
+		assert.Len(t, uow.GetDeclined(1), 2)
+		assert.NoError(t, uow.Rollback())
+
+		assert.Len(t, im.GetDeclined(1), 1)
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		restored := &InMemory{}
+		assert.NoError(t, restored.RestoreAccount(model.Account{Id: 1, ActiveCard: true}, nil, nil))
+		assert.NoError(t, restored.RestoreDeclined(1, declined))
+		assert.Equal(t, declined, restored.GetDeclined(1))
+
+		assert.Error(t, restored.RestoreDeclined(2, declined))
+		assert.Error(t, restored.RestoreDeclined(1, []model.DeclinedTransaction{{Transaction: model.Transaction{Id: "x"}}}))
+	})
+
+	t.Run("account created again", func(t *testing.T) {
+		assert.NoError(t, im.CreateAccount(model.Account{Id: 1, ActiveCard: true, AvailableLimit: 100}))
+		assert.Empty(t, im.GetDeclined(1))
+	})
+}
+
+func TestInMemory_ExecutePayment(t *testing.T) {
+	im := &InMemory{}
+	nextClose := time.Date(2019, 3, 10, 0, 0, 0, 0, time.UTC)
+	credit := &model.CreditLine{Limit: 100, ClosingDay: 10, DueDays: 20, NextClose: &nextClose}
+
+	assert.NoError(t, im.CreateAccount(model.Account{Id: 1, ActiveCard: true, AvailableLimit: 100, CreditLine: credit}))
+
+	// the stored credit line doesn't share the pointers of the account received
+	nextClose = nextClose.AddDate(0, 1, 0)
+	assert.Equal(t, time.Date(2019, 3, 10, 0, 0, 0, 0, time.UTC), *im.GetAccount(1).CreditLine.NextClose)
+
+	account, err := im.ExecuteTransaction(im.GetAccount(1), model.Transaction{Merchant: "Oxxo", Amount: 60})
+	assert.NoError(t, err)
+
+	account.CreditLine.Statement = &model.BillingStatement{Balance: 60, MinimumPayment: 10, Paid: 25}
+	account, err = im.ExecutePayment(account, model.Payment{Amount: 25, Time: nextClose})
+	assert.NoError(t, err)
+	assert.Equal(t, 65, account.AvailableLimit)
+	assert.Equal(t, 3, account.Version)
+
+	stored := im.GetAccount(1)
+	assert.Equal(t, account, stored)
+	assert.Equal(t, 25, stored.CreditLine.Statement.Paid)
+
+	history := im.GetTransactions(1)
+	assert.Len(t, history, 3)
+	assert.Equal(t, model.PaymentMerchant, history[2].Merchant)
+	assert.Equal(t, -25, history[2].Amount)
+	assert.NotEmpty(t, history[2].Id)
+
+	_, err = im.ExecutePayment(account, model.Payment{Amount: 5})
+	assert.NoError(t, err)
+
+	_, err = im.ExecutePayment(account, model.Payment{Amount: 5})
+	assert.True(t, errors.As(err, new(*model.ConflictError)))
+
+	t.Run("rollback", func(t *testing.T) {
+		uow, err := im.Begin()
+		assert.NoError(t, err)
+
+		account := uow.GetAccount(1)
+		account.CreditLine.LatePayments = 1
+		_, err = uow.ExecutePayment(account, model.Payment{Amount: 30})
+		assert.NoError(t, err)
+		assert.NoError(t, uow.Rollback())
+
+		assert.Equal(t, 70, im.GetAccount(1).AvailableLimit)
+		assert.Equal(t, 0, im.GetAccount(1).CreditLine.LatePayments)
+		assert.Len(t, im.GetTransactions(1), 4)
+	})
+}
+
+func TestInMemory_UnitOfWork(t *testing.T) {
+	im := &InMemory{}
+	assert.NoError(t, im.CreateAccount(model.Account{Id: 1, ActiveCard: true, AvailableLimit: 100}))
+
+	t.Run("rollback", func(t *testing.T) {
+		uow, err := im.Begin()
+		assert.NoError(t, err)
+
+		account, err := uow.ExecuteTransaction(uow.GetAccount(1), model.Transaction{Merchant: "Burger King", Amount: 20})
+		assert.NoError(t, err)
+		account.ActiveCard = false
+		assert.NoError(t, uow.UpdateAccount(account))
+		assert.NoError(t, uow.CreateAccount(model.Account{Id: 2, ActiveCard: true, AvailableLimit: 50}))
+		assert.NoError(t, uow.Rollback())
+
+		assert.Equal(t, model.Account{Id: 1, ActiveCard: true, AvailableLimit: 100, Version: 1}, im.GetAccount(1))
+		assert.Len(t, im.GetTransactions(1), 1)
+		assert.Equal(t, []int{1}, im.Accounts())
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		uow, err := im.Begin()
+		assert.NoError(t, err)
+
+		_, err = uow.ExecuteTransaction(uow.GetAccount(1), model.Transaction{Merchant: "Burger King", Amount: 20})
+		assert.NoError(t, err)
+		assert.NoError(t, uow.Commit())
+		assert.NoError(t, uow.Rollback())
+		assert.Error(t, uow.Commit())
+
+		assert.Equal(t, 80, im.GetAccount(1).AvailableLimit)
+		assert.Len(t, im.GetTransactions(1), 2)
+	})
+
+	t.Run("concurrent units of work", func(t *testing.T) {
+		wg := sync.WaitGroup{}
+
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				uow, err := im.Begin()
+				assert.NoError(t, err)
+
+				defer uow.Rollback()
+
+				_, err = uow.ExecuteTransaction(uow.GetAccount(1), model.Transaction{Amount: 1})
+				assert.NoError(t, err)
+				assert.NoError(t, uow.Commit())
+			}()
+		}
+
+		wg.Wait()
+
+		assert.Equal(t, 30, im.GetAccount(1).AvailableLimit)
+		assert.Len(t, im.GetTransactions(1), 52)
+	})
+}
+
+func TestInMemory_Events(t *testing.T) {
+	im := &InMemory{}
+
+	events, committed, err := im.Events(0, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+
+	appendEvents := func(commit bool, ids ...string) {
+		uow, err := im.Begin()
+		assert.NoError(t, err)
+
+		for _, id := range ids {
+			assert.NoError(t, uow.AppendEvent(model.AuthorizationEvent{ID: id, Violations: []string{}}))
+		}
+
+		if commit {
+			assert.NoError(t, uow.Commit())
+		} else {
+			assert.NoError(t, uow.Rollback())
+		}
+	}
+
+	appendEvents(false, "rolled-back")
+
+	select {
+	case <-committed:
+		t.Fatal("a rollback doesn't wake up the readers")
+	default:
+	}
+
+	appendEvents(true, "a", "b")
+	appendEvents(true, "c")
+
+	select {
+	case <-committed:
+	default:
+		t.Fatal("the commit must wake up the readers")
+	}
+
+	offsets := func(events []model.AuthorizationEvent) []string {
+		got := make([]string, 0, len(events))
+		for _, e := range events {
+			got = append(got, fmt.Sprintf("%d:%s", e.Offset, e.ID))
+		}
+
+		return got
+	}
+
+	events, _, err = im.Events(0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1:a", "2:b", "3:c"}, offsets(events))
+
+	events, _, err = im.Events(1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2:b"}, offsets(events))
+
+	events, _, err = im.Events(3, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+
+	_, _, err = im.Events(5, 10)
+	assert.True(t, errors.Is(err, model.ErrOffsetAhead))
+
+	_, err = im.Compact(Retention{MaxEvents: 1})
+	assert.NoError(t, err)
+
+	_, _, err = im.Events(1, 10)
+	assert.True(t, errors.Is(err, model.ErrEventsCompacted))
+
+	var compacted *model.CompactedError
+	assert.True(t, errors.As(err, &compacted))
+	assert.Equal(t, 3, compacted.First)
+
+	appendEvents(true, "d")
+
+	events, _, err = im.Events(2, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3:c", "4:d"}, offsets(events))
+
+	t.Run("restore", func(t *testing.T) {
+		outbox, lastOffset := im.GetOutbox()
+		assert.Equal(t, 4, lastOffset)
+
+		restored := &InMemory{}
+		assert.NoError(t, restored.RestoreOutbox(outbox, lastOffset))
+		assert.Error(t, restored.RestoreOutbox(outbox, lastOffset))
+		assert.Error(t, (&InMemory{}).RestoreOutbox(outbox, 5))
+		assert.Error(t, (&InMemory{}).RestoreOutbox(outbox, 1))
+
+		uow, err := restored.Begin()
+		assert.NoError(t, err)
+		assert.NoError(t, uow.AppendEvent(model.AuthorizationEvent{ID: "e", Violations: []string{}}))
+		assert.NoError(t, uow.Commit())
+
+		events, _, err := restored.Events(3, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"4:d", "5:e"}, offsets(events))
+	})
+}
+
+func TestInMemory_ExecuteTransaction_conflict(t *testing.T) {
+	im := &InMemory{}
+	assert.NoError(t, im.CreateAccount(model.Account{Id: 1, ActiveCard: true, AvailableLimit: 100}))
+
+	read := im.GetAccount(1)
+
+	account, err := im.ExecuteTransaction(read, model.Transaction{Merchant: "Burger King", Amount: 20})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, account.Version)
+
+	_, err = im.ExecuteTransaction(read, model.Transaction{Merchant: "Habbib's", Amount: 20})
+
+	var conflict *model.ConflictError
+	assert.True(t, errors.As(err, &conflict))
+	assert.Equal(t, model.ConflictError{AccountID: 1, Version: 1, Stored: 2}, *conflict)
+	assert.Equal(t, 80, im.GetAccount(1).AvailableLimit)
+	assert.Len(t, im.GetTransactions(1), 2)
+}
+
 func TestInMemory_Close(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -0,0 +1,304 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"authorizer/internal/app/model"
+)
+
+// Retention is the policy applied to the history by Compact
+type Retention struct {
+	// Horizon is how long the transactions are kept in the history before the last event of their account,
+	// the velocity rules only need the last minutes. 0 keeps all of them
+	Horizon time.Duration
+	// MinHorizon returns the longest window of the rules, a shorter Horizon is extended to it so the reload of the
+	// rules can't make them miss transactions. The windows overridden for an account extend its horizon too
+	MinHorizon func() time.Duration
+	// Archive receives the transactions removed from the history as json lines, they are dropped when it is nil
+	Archive io.Writer
+	// MaxEvents is how many events are kept in the outbox, the oldest are removed first. 0 keeps all of them
+	MaxEvents int
+}
+
+// archivedTransaction is a line of the archive
+type archivedTransaction struct {
+	AccountID   int                `json:"accountId"`
+	Id          string             `json:"id"`
+	Merchant    string             `json:"merchant"`
+	Amount      int                `json:"amount"`
+	Time        time.Time          `json:"time"`
+	Country     string             `json:"country,omitempty"`
+	Coordinates *model.Coordinates `json:"coordinates,omitempty"`
+	// Violations are only written for the declined attempts
+	Violations []string `json:"violations,omitempty"`
+}
+
+// Compact removes from the history the transactions older than the horizon before the last transaction or declined
+// attempt of their account, the rules compare the time of the events and not the clock, so a replay of old events
+// is compacted the same way as the live traffic. They are added to the daily totals of their account and written
+// to the archive. The declined attempts older than the horizon are archived and removed too, they are not part of
+// the daily totals. It returns how many of both were removed. The outbox is trimmed to the last MaxEvents events.
+//
+// The expired entries are collected while the database is locked and written after releasing it, so a slow archive
+// doesn't block the operations. Only the entries written to the archive are removed, when it fails the rest are kept
+// and archived by the next compaction, so no entry is lost or written twice
+func (im *InMemory) Compact(r Retention) (int, error) {
+	im.compacting.Lock()
+	defer im.compacting.Unlock()
+
+	expired := im.expired(r)
+	written, err := expired.archive(r.Archive)
+
+	return im.remove(written), err
+}
+
+// expiredEntries are the transactions and declined attempts of every account removed by a compaction
+type expiredEntries struct {
+	history  map[int][]Transaction
+	declined map[int][]DeclinedTransaction
+}
+
+// expired trims the outbox and returns the entries older than the cutoff of their account, the initial transaction
+// is kept, its amount is the starting limit and not a purchase of the daily totals
+func (im *InMemory) expired(r Retention) expiredEntries {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	expired := expiredEntries{history: map[int][]Transaction{}, declined: map[int][]DeclinedTransaction{}}
+
+	if r.MaxEvents > 0 && len(im.Outbox) > r.MaxEvents {
+		// a new slice is allocated so the memory of the old events is released
+		im.Outbox = append([]model.AuthorizationEvent{}, im.Outbox[len(im.Outbox)-r.MaxEvents:]...)
+	}
+
+	if r.Horizon <= 0 {
+		return expired
+	}
+
+	for accountID, cutoff := range im.cutoffs(r) {
+		for _, t := range im.History[accountID] {
+			if t.Merchant != model.InitialMerchant && t.Time.Before(cutoff) {
+				expired.history[accountID] = append(expired.history[accountID], t)
+			}
+		}
+
+		for _, d := range im.Declined[accountID] {
+			if d.Time.Before(cutoff) {
+				expired.declined[accountID] = append(expired.declined[accountID], d)
+			}
+		}
+	}
+
+	return expired
+}
+
+// cutoffs returns for every account the time before which its transactions and declined attempts are removed,
+// the accounts without transactions or declined attempts are not compacted. The initial transaction is not an event,
+// it has the time of the creation of the account, so it is never removed (see expired)
+func (im *InMemory) cutoffs(r Retention) map[int]time.Time {
+	latest := make(map[int]time.Time, len(im.History))
+
+	for accountID, history := range im.History {
+		for _, t := range history {
+			if t.Merchant != model.InitialMerchant && t.Time.After(latest[accountID]) {
+				latest[accountID] = t.Time
+			}
+		}
+	}
+
+	for accountID, declined := range im.Declined {
+		for _, d := range declined {
+			if d.Time.After(latest[accountID]) {
+				latest[accountID] = d.Time
+			}
+		}
+	}
+
+	horizon := r.Horizon
+	if r.MinHorizon != nil && r.MinHorizon() > horizon {
+		horizon = r.MinHorizon()
+	}
+
+	cutoffs := make(map[int]time.Time, len(latest))
+
+	for accountID, t := range latest {
+		accountHorizon := horizon
+
+		for _, override := range im.Account[accountID].RuleSettings {
+			if override.Window != nil && override.Window.Duration > accountHorizon {
+				accountHorizon = override.Window.Duration
+			}
+		}
+
+		cutoffs[accountID] = t.Add(-accountHorizon)
+	}
+
+	return cutoffs
+}
+
+// archive writes the entries as json lines, the transactions of every account before the declined attempts.
+// It returns the entries written, all of them when there is no archive
+func (e expiredEntries) archive(w io.Writer) (expiredEntries, error) {
+	if w == nil {
+		return e, nil
+	}
+
+	written := expiredEntries{history: map[int][]Transaction{}, declined: map[int][]DeclinedTransaction{}}
+	encoder := json.NewEncoder(w)
+
+	for accountID, history := range e.history {
+		for _, t := range history {
+			if err := encoder.Encode(archivedLine(accountID, t, nil)); err != nil {
+				return written, fmt.Errorf("error archiving history of account %d: %w", accountID, err)
+			}
+
+			written.history[accountID] = append(written.history[accountID], t)
+		}
+	}
+
+	for accountID, declined := range e.declined {
+		for _, d := range declined {
+			if err := encoder.Encode(archivedLine(accountID, d.Transaction, d.Violations)); err != nil {
+				return written, fmt.Errorf("error archiving declined attempts of account %d: %w", accountID, err)
+			}
+
+			written.declined[accountID] = append(written.declined[accountID], d)
+		}
+	}
+
+	return written, nil
+}
+
+// remove deletes the entries from the history and the declined attempts and adds the transactions to the daily
+// totals, it returns how many were removed. An entry that is no longer there, e.g. after a snapshot was restored,
+// is skipped
+func (im *InMemory) remove(e expiredEntries) int {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	removed := 0
+
+	if im.DailyTotals == nil {
+		im.DailyTotals = make(map[int][]model.DailyTotal)
+	}
+
+	for accountID, expired := range e.history {
+		ids := make(map[uuid.UUID]bool, len(expired))
+		for _, t := range expired {
+			ids[t.Id] = true
+		}
+
+		// a new slice is allocated so the memory of the old transactions is released
+		history := im.History[accountID]
+		kept := make([]Transaction, 0, len(history))
+		deleted := make([]Transaction, 0, len(expired))
+
+		for _, t := range history {
+			if ids[t.Id] {
+				deleted = append(deleted, t)
+			} else {
+				kept = append(kept, t)
+			}
+		}
+
+		im.History[accountID] = kept
+		im.DailyTotals[accountID] = addDailyTotals(im.DailyTotals[accountID], deleted)
+		removed += len(deleted)
+	}
+
+	for accountID, expired := range e.declined {
+		ids := make(map[uuid.UUID]bool, len(expired))
+		for _, d := range expired {
+			ids[d.Id] = true
+		}
+
+		declined := im.Declined[accountID]
+		kept := make([]DeclinedTransaction, 0, len(declined))
+
+		for _, d := range declined {
+			if !ids[d.Id] {
+				kept = append(kept, d)
+			}
+		}
+
+		im.Declined[accountID] = kept
+		removed += len(declined) - len(kept)
+	}
+
+	return removed
+}
+
+// RunCompaction compacts the history every interval until the context is done
+func (im *InMemory) RunCompaction(ctx context.Context, interval time.Duration, r Retention) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			removed, err := im.Compact(r)
+			if err != nil {
+				log.Errorf("error compacting history: %+v", err)
+			}
+
+			log.Debugf("history compacted, %d transactions removed", removed)
+		}
+	}
+}
+
+// archivedLine returns the line of the archive of a transaction, the violations are set for the declined attempts
+func archivedLine(accountID int, t Transaction, violations []string) archivedTransaction {
+	return archivedTransaction{
+		AccountID:   accountID,
+		Id:          t.Id.String(),
+		Merchant:    t.Merchant,
+		Amount:      t.Amount,
+		Time:        t.Time,
+		Country:     t.Country,
+		Coordinates: t.Coordinates,
+		Violations:  violations,
+	}
+}
+
+// addDailyTotals adds the transactions to the totals of their day, the totals are kept ordered by day.
+// The payments and the initial transaction are not added, the rules that read the totals don't analyze them
+func addDailyTotals(totals []model.DailyTotal, transactions []Transaction) []model.DailyTotal {
+	byDay := make(map[time.Time]int, len(totals))
+	for i, total := range totals {
+		byDay[total.Day] = i
+	}
+
+	for _, t := range transactions {
+		if model.IsReservedMerchant(t.Merchant) {
+			continue
+		}
+
+		utc := t.Time.UTC()
+		day := time.Date(utc.Year(), utc.Month(), utc.Day(), 0, 0, 0, 0, time.UTC)
+
+		i, ok := byDay[day]
+		if !ok {
+			totals = append(totals, model.DailyTotal{Day: day})
+			i = len(totals) - 1
+			byDay[day] = i
+		}
+
+		totals[i].Transactions++
+		totals[i].Amount += t.Amount
+	}
+
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Day.Before(totals[j].Day) })
+
+	return totals
+}
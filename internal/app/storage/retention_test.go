@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/model"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+// limitedWriter fails after writing lines
+type limitedWriter struct {
+	bytes.Buffer
+	lines int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.lines == 0 {
+		return 0, errors.New("disk full")
+	}
+
+	w.lines--
+
+	return w.Buffer.Write(p)
+}
+
+// statsWriter reads the database while the archive is written
+type statsWriter struct {
+	im *InMemory
+}
+
+func (w statsWriter) Write(p []byte) (int, error) {
+	w.im.Stats()
+
+	return len(p), nil
+}
+
+func TestInMemory_Compact(t *testing.T) {
+	now := time.Date(2019, 2, 13, 10, 0, 0, 0, time.UTC)
+	history := func() map[int][]Transaction {
+		return map[int][]Transaction{
+			1: {
+				{Id: uuid.New(), Merchant: "initial", Amount: 100, Time: now.Add(-49 * time.Hour)},
+				{Id: uuid.New(), Merchant: "Burger King", Amount: 20, Time: now.Add(-25 * time.Hour)},
+				{Id: uuid.New(), Merchant: "Habbib's", Amount: 10, Time: now.Add(-24*time.Hour - time.Minute)},
+				{Id: uuid.New(), Merchant: "McDonald's", Amount: 5, Time: now.Add(-time.Minute)},
+			},
+			2: {
+				{Id: uuid.New(), Merchant: "initial", Amount: 50, Time: now.Add(-2 * time.Minute)},
+			},
+		}
+	}
+
+	t.Run("archive", func(t *testing.T) {
+		im := &InMemory{History: history()}
+		out := bytes.Buffer{}
+
+		removed, err := im.Compact(Retention{Horizon: 10 * time.Minute, Archive: &out})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, removed)
+
+		// the initial transaction is kept, its amount is the starting limit and not a purchase of the totals
+		assert.Equal(t, []string{"initial", "McDonald's"}, merchants(im.GetTransactions(1)))
+		assert.Len(t, im.GetTransactions(2), 1)
+		assert.Equal(t, []model.DailyTotal{
+			{Day: time.Date(2019, 2, 12, 0, 0, 0, 0, time.UTC), Transactions: 2, Amount: 30},
+		}, im.GetDailyTotals(1))
+		assert.Empty(t, im.GetDailyTotals(2))
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		assert.Len(t, lines, 2)
+
+		archived := archivedTransaction{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &archived))
+		assert.Equal(t, 1, archived.AccountID)
+		assert.Equal(t, "Burger King", archived.Merchant)
+
+		// the clock doesn't matter, the history is compacted when a later transaction arrives
+		removed, err = im.Compact(Retention{Horizon: 10 * time.Minute})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, removed)
+
+		im.History[1] = append(im.History[1],
+			Transaction{Id: uuid.New(), Merchant: "Oxxo", Amount: 1, Time: now.Add(24 * time.Hour)})
+
+		removed, err = im.Compact(Retention{Horizon: 10 * time.Minute})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, removed)
+		assert.Equal(t, []model.DailyTotal{
+			{Day: time.Date(2019, 2, 12, 0, 0, 0, 0, time.UTC), Transactions: 2, Amount: 30},
+			{Day: time.Date(2019, 2, 13, 0, 0, 0, 0, time.UTC), Transactions: 1, Amount: 5},
+		}, im.GetDailyTotals(1))
+	})
+
+	t.Run("payments are archived without daily totals", func(t *testing.T) {
+		im := &InMemory{History: history()}
+		im.History[1] = append(im.History[1],
+			Transaction{Id: uuid.New(), Merchant: "payment", Amount: -15, Time: now.Add(-time.Hour)})
+		out := bytes.Buffer{}
+
+		removed, err := im.Compact(Retention{Horizon: 10 * time.Minute, Archive: &out})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, removed)
+		assert.Equal(t, []model.DailyTotal{
+			{Day: time.Date(2019, 2, 12, 0, 0, 0, 0, time.UTC), Transactions: 2, Amount: 30},
+		}, im.GetDailyTotals(1))
+		assert.Contains(t, out.String(), `"merchant":"payment","amount":-15`)
+	})
+
+	t.Run("declined", func(t *testing.T) {
+		im := &InMemory{History: history(), Declined: map[int][]DeclinedTransaction{
+			1: {
+				{Transaction: Transaction{Id: uuid.New(), Merchant: "Oxxo", Amount: 500, Time: now.Add(-time.Hour)},
+					Violations: []string{"insufficient-limit"}},
+				{Transaction: Transaction{Id: uuid.New(), Merchant: "Oxxo", Amount: 500, Time: now.Add(-time.Minute)},
+					Violations: []string{"insufficient-limit"}},
+			},
+		}}
+		out := bytes.Buffer{}
+
+		removed, err := im.Compact(Retention{Horizon: 10 * time.Minute, Archive: &out})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, removed)
+		assert.Len(t, im.GetDeclined(1), 1)
+		assert.Len(t, im.GetDailyTotals(1), 1)
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		assert.Len(t, lines, 3)
+
+		archived := archivedTransaction{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[2]), &archived))
+		assert.Equal(t, "Oxxo", archived.Merchant)
+		assert.Equal(t, []string{"insufficient-limit"}, archived.Violations)
+	})
+
+	t.Run("windows of the rules", func(t *testing.T) {
+		im := &InMemory{History: history()}
+
+		removed, err := im.Compact(Retention{Horizon: 10 * time.Minute,
+			MinHorizon: func() time.Duration { return 24 * time.Hour }})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, removed)
+		assert.Len(t, im.GetTransactions(1), 3)
+
+		window := model.Duration{Duration: 24 * time.Hour}
+		im = &InMemory{History: history(), Account: map[int]Account{
+			1: {Id: 1, RuleSettings: model.RuleSettings{"highFrequency": {Window: &window}}},
+		}}
+
+		removed, err = im.Compact(Retention{Horizon: 10 * time.Minute})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, removed)
+		assert.Len(t, im.GetTransactions(1), 3)
+	})
+
+	t.Run("archive fails after a line", func(t *testing.T) {
+		im := &InMemory{History: history()}
+		out := &limitedWriter{lines: 1}
+
+		removed, err := im.Compact(Retention{Horizon: 10 * time.Minute, Archive: out})
+		assert.Error(t, err)
+		assert.Equal(t, 1, removed)
+		assert.Len(t, im.GetTransactions(1), 3)
+
+		// the next compaction archives the rest without writing the first line again
+		out.lines = 10
+
+		removed, err = im.Compact(Retention{Horizon: 10 * time.Minute, Archive: out})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, removed)
+		assert.Len(t, strings.Split(strings.TrimSpace(out.String()), "\n"), 2)
+		assert.Equal(t, []model.DailyTotal{
+			{Day: time.Date(2019, 2, 12, 0, 0, 0, 0, time.UTC), Transactions: 2, Amount: 30},
+		}, im.GetDailyTotals(1))
+	})
+
+	t.Run("the archive is written without locking the database", func(t *testing.T) {
+		im := &InMemory{History: history()}
+		done := make(chan struct{})
+
+		go func() {
+			removed, err := im.Compact(Retention{Horizon: 10 * time.Minute, Archive: statsWriter{im}})
+			assert.NoError(t, err)
+			assert.Equal(t, 2, removed)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the archive was written while the database was locked")
+		}
+	})
+
+	t.Run("archive fails", func(t *testing.T) {
+		im := &InMemory{History: history()}
+
+		_, err := im.Compact(Retention{Horizon: 10 * time.Minute, Archive: failingWriter{}})
+		assert.Error(t, err)
+
+		accounts, transactions := im.Stats()
+		assert.Equal(t, 5, accounts+transactions)
+		assert.Empty(t, im.GetDailyTotals(1))
+	})
+}
+
+func merchants(transactions []model.Transaction) []string {
+	result := make([]string, 0, len(transactions))
+	for _, t := range transactions {
+		result = append(result, t.Merchant)
+	}
+
+	return result
+}
+
+func TestInMemory_RunCompaction(t *testing.T) {
+	im := &InMemory{History: map[int][]Transaction{1: {
+		{Id: uuid.New(), Merchant: "initial", Time: time.Now().Add(-time.Hour)},
+		{Id: uuid.New(), Merchant: "Oxxo", Time: time.Now().Add(-30 * time.Minute)},
+		{Id: uuid.New(), Merchant: "Walmart", Time: time.Now()},
+	}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		im.RunCompaction(ctx, time.Millisecond, Retention{Horizon: time.Minute})
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return len(im.GetTransactions(1)) == 2 }, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+// BenchmarkInMemory_retention executes transactions one second apart on a single account and reports the size of the
+// history and of the heap, without a horizon both grow with b.N, with it they are bounded by the horizon
+func BenchmarkInMemory_retention(b *testing.B) {
+	for _, horizon := range []time.Duration{0, 10 * time.Minute} {
+		horizon := horizon
+
+		name := "unbounded"
+		if horizon > 0 {
+			name = fmt.Sprintf("horizon=%s", horizon)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			im := &InMemory{}
+			start := time.Date(2019, 2, 13, 10, 0, 0, 0, time.UTC)
+
+			if err := im.CreateAccount(model.Account{Id: 1, ActiveCard: true, AvailableLimit: b.N}); err != nil {
+				b.Fatal(err)
+			}
+
+			account := im.GetAccount(1)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				tx := model.Transaction{Merchant: "Burger King", Amount: 1, Time: start.Add(time.Duration(i) * time.Second)}
+
+				var err error
+				if account, err = im.ExecuteTransaction(account, tx); err != nil {
+					b.Fatal(err)
+				}
+
+				if horizon > 0 && i%1000 == 0 {
+					if _, err = im.Compact(Retention{Horizon: horizon}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+
+			b.StopTimer()
+
+			runtime.GC()
+
+			var mem runtime.MemStats
+			runtime.ReadMemStats(&mem)
+
+			_, transactions := im.Stats()
+			b.ReportMetric(float64(transactions), "history")
+			b.ReportMetric(float64(mem.HeapAlloc), "heap-bytes")
+		})
+	}
+}
@@ -7,3 +7,15 @@ const ViolationCardNotActive = "card-not-active"
 const ViolationInsufficientLimit = "insufficient-limit"
 const ViolationHighFrequencySmallInterval = "high-frequency-small-interval"
 const ViolationDoubledTransaction = "doubled-transaction"
+const ViolationCardTestingSuspected = "card-testing-suspected"
+const ViolationOutsideHomeCountry = "outside-home-country"
+const ViolationImpossibleTravel = "impossible-travel"
+const ViolationTooManyDeclinedAttempts = "too-many-declined-attempts"
+const ViolationAccountNotInitialized = "account-not-initialized"
+const ViolationInvalidRuleSettings = "invalid-rule-settings"
+const ViolationConcurrentModification = "concurrent-modification"
+const ViolationInvalidCreditLine = "invalid-credit-line"
+const ViolationCreditLineNotEnabled = "credit-line-not-enabled"
+const ViolationInvalidPaymentAmount = "invalid-payment-amount"
+const ViolationPaymentExceedsBalance = "payment-exceeds-balance"
+const ViolationReservedMerchant = "reserved-merchant"
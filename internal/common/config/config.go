@@ -0,0 +1,122 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is the prefix of the environment variables that set the flags
+const EnvPrefix = "AUTHORIZER_"
+
+// Values are the settings of the application by flag name, they are read from a config file or the environment
+// and applied to the flags that were not set in the command line
+type Values map[string]string
+
+// Load reads a json object whose keys are flag names, the values can be strings, numbers or booleans:
+// {"log-level": "info", "rules": "rules.json", "explain": true}
+func Load(path string) (Values, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	raw := map[string]interface{}{}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	if err = decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	values := Values{}
+
+	for name, v := range raw {
+		switch v := v.(type) {
+		case string:
+			values[name] = v
+		case json.Number:
+			values[name] = v.String()
+		case bool:
+			values[name] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("invalid config file %s: %s must be a string, a number or a boolean", path, name)
+		}
+	}
+
+	return values, nil
+}
+
+// EnvName is the environment variable of a flag, log-max-size is set with AUTHORIZER_LOG_MAX_SIZE
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// FromEnv returns the values of the flags of fs that are set in the environment
+func FromEnv(fs *flag.FlagSet) Values {
+	values := Values{}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if v, ok := os.LookupEnv(EnvName(f.Name)); ok {
+			values[f.Name] = v
+		}
+	})
+
+	return values
+}
+
+// Apply sets the flags of fs that were not set yet, in the command line or by a previous Apply,
+// so applying the environment before the config file gives precedence to the environment.
+// The values of other flags are ignored, source names the values in the errors
+func Apply(fs *flag.FlagSet, values Values, source string) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+
+	fs.VisitAll(func(f *flag.Flag) {
+		v, ok := values[f.Name]
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+
+		if setErr := fs.Set(f.Name, v); setErr != nil {
+			err = fmt.Errorf("invalid value %q for %s in %s: %w", v, f.Name, source, setErr)
+		}
+	})
+
+	return err
+}
+
+// Unknown returns the names that are not flags of any of the flag sets, in order
+func (v Values) Unknown(sets ...*flag.FlagSet) []string {
+	var unknown []string
+
+	for name := range v {
+		found := false
+
+		for _, fs := range sets {
+			if fs.Lookup(name) != nil {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			unknown = append(unknown, name)
+		}
+	}
+
+	sort.Strings(unknown)
+
+	return unknown
+}
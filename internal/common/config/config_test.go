@@ -0,0 +1,93 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("log-level", "debug", "")
+	fs.Duration("rules-interval", 5*time.Second, "")
+	fs.Bool("explain", false, "")
+
+	return fs
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Values
+		wantErr bool
+	}{
+		{"values",
+			`{"log-level": "info", "log-max-size": 1024, "explain": true}`,
+			Values{"log-level": "info", "log-max-size": "1024", "explain": "true"},
+			false,
+		},
+		{"nested", `{"rules": {"path": "rules.json"}}`, nil, true},
+		{"notJSON", `log-level=info`, nil, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "authorizer.json")
+			assert.NoError(t, os.WriteFile(path, []byte(tt.content), 0600))
+
+			got, err := Load(path)
+			if tt.wantErr {
+				assert.Error(t, err)
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestApply(t *testing.T) {
+	t.Setenv("AUTHORIZER_LOG_LEVEL", "warning")
+	t.Setenv("AUTHORIZER_RULES_INTERVAL", "1m")
+
+	fs := flagSet()
+	assert.NoError(t, fs.Parse([]string{"-rules-interval", "10s"}))
+
+	file := Values{"log-level": "info", "explain": "true", "listen": ":9090"}
+
+	// the command line has precedence over the environment and the environment over the file
+	assert.NoError(t, Apply(fs, FromEnv(fs), "environment"))
+	assert.NoError(t, Apply(fs, file, "config file"))
+
+	assert.Equal(t, "warning", fs.Lookup("log-level").Value.String())
+	assert.Equal(t, "10s", fs.Lookup("rules-interval").Value.String())
+	assert.Equal(t, "true", fs.Lookup("explain").Value.String())
+
+	err := Apply(flagSet(), Values{"explain": "maybe"}, "config file")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid value "maybe" for explain in config file`)
+}
+
+func TestValues_Unknown(t *testing.T) {
+	other := flag.NewFlagSet("other", flag.ContinueOnError)
+	other.String("listen", "", "")
+
+	values := Values{"log-level": "info", "listen": ":9090", "port": "80", "level": "info"}
+
+	assert.Equal(t, []string{"level", "port"}, values.Unknown(flagSet(), other))
+}
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "AUTHORIZER_LOG_MAX_SIZE", EnvName("log-max-size"))
+}
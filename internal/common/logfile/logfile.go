@@ -1,21 +1,83 @@
 package logfile
 
 import (
+	"fmt"
+	"io"
 	"os"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
-// Init creates a file named authorizer.log and log all the application errors in there
-func Init() {
-	log.SetLevel(log.DebugLevel)
+// Stderr is the Path used to write the log to the standard error instead of a file
+const Stderr = "stderr"
 
-	f, err := os.OpenFile("authorizer.log", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0755)
+// Config contains the options of the application log
+type Config struct {
+	// Level is one of the logrus levels: trace, debug, info, warning, error, fatal or panic
+	Level string
+	// Format is text or json
+	Format string
+	// Path is the file where the log is written, or Stderr
+	Path string
+	// MaxSize rotates the file when it would exceed this number of bytes, 0 disables it
+	MaxSize int64
+	// MaxAge rotates the file when it was opened before this period, 0 disables it
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files kept, 0 keeps all of them
+	MaxBackups int
+}
+
+// DefaultConfig returns the configuration used when neither flags nor environment variables are set
+func DefaultConfig() Config {
+	return Config{
+		Level:  "debug",
+		Format: "text",
+		Path:   "authorizer.log",
+	}
+}
+
+// Init configures the standard logger, the returned closer must be closed when the application ends,
+// an error is returned when the destination can't be opened instead of logging somewhere else
+func Init(c Config) (io.Closer, error) {
+	level, err := log.ParseLevel(c.Level)
 	if err != nil {
-		log.Errorln("error writing file: ", err)
+		return nil, err
+	}
+
+	var formatter log.Formatter
+
+	switch c.Format {
+	case "text":
+		formatter = &log.TextFormatter{}
+	case "json":
+		formatter = &log.JSONFormatter{}
+	default:
+		return nil, fmt.Errorf("unknown log format %q, it must be text or json", c.Format)
 	}
 
-	log.SetOutput(f)
+	var output io.WriteCloser = nopCloser{os.Stderr}
+
+	if c.Path != Stderr {
+		output, err = OpenRotatingFile(c.Path, c.MaxSize, c.MaxAge, c.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.SetLevel(level)
+	log.SetFormatter(formatter)
+	log.SetOutput(output)
 
 	log.Println("---------------")
+
+	return output, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
 }
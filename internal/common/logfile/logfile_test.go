@@ -0,0 +1,47 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInit(t *testing.T) {
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"file", Config{Level: "info", Format: "json", Path: filepath.Join(dir, "authorizer.log")}, false},
+		{"stderr", Config{Level: "debug", Format: "text", Path: Stderr}, false},
+		{"invalidLevel", Config{Level: "verbose", Format: "text", Path: Stderr}, true},
+		{"invalidFormat", Config{Level: "debug", Format: "xml", Path: Stderr}, true},
+		{"invalidPath", Config{Level: "debug", Format: "text", Path: filepath.Join(dir, "missing", "a.log")}, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			closer, err := Init(tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NoError(t, closer.Close())
+		})
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "authorizer.log"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"level":"info"`)
+}
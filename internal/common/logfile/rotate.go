@@ -0,0 +1,148 @@
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is appended to the name of the rotated files, it sorts in chronological order
+const backupTimeFormat = "20060102T150405.000000000"
+
+// RotatingFile is a log file that is renamed and replaced by a new one when it reaches
+// its maximum size or age, only the newest backups are kept
+type RotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	file       *os.File
+	size       int64
+	openedAt   time.Time
+	now        func() time.Time
+}
+
+// OpenRotatingFile opens (or creates) the file in path, maxSize and maxAge equal to 0 disable each kind of rotation
+// and maxBackups equal to 0 keeps every rotated file
+func OpenRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	rf := &RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+		now:        time.Now,
+	}
+
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+// Write writes to the current file, rotating it before if it is needed
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.shouldRotate(int64(len(p))) {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+
+	return n, err
+}
+
+// Close closes the current file
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	return rf.file.Close()
+}
+
+func (rf *RotatingFile) shouldRotate(size int64) bool {
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+size > rf.maxSize {
+		return true
+	}
+
+	return rf.maxAge > 0 && rf.now().Sub(rf.openedAt) >= rf.maxAge
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return fmt.Errorf("error opening log file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+
+		return fmt.Errorf("error opening log file: %w", err)
+	}
+
+	rf.file = f
+	rf.size = info.Size()
+	rf.openedAt = rf.now()
+
+	return nil
+}
+
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return fmt.Errorf("error closing log file: %w", err)
+	}
+
+	backup := rf.path + "." + rf.now().UTC().Format(backupTimeFormat)
+	if err := os.Rename(rf.path, backup); err != nil {
+		return fmt.Errorf("error rotating log file: %w", err)
+	}
+
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	return rf.removeOldBackups()
+}
+
+// removeOldBackups deletes the oldest rotated files when there are more than maxBackups
+func (rf *RotatingFile) removeOldBackups() error {
+	if rf.maxBackups <= 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+
+	for _, match := range matches {
+		if _, err = time.Parse(backupTimeFormat, strings.TrimPrefix(match, rf.path+".")); err == nil {
+			backups = append(backups, match)
+		}
+	}
+
+	sort.Strings(backups)
+
+	for len(backups) > rf.maxBackups {
+		if err = os.Remove(backups[0]); err != nil {
+			return fmt.Errorf("error removing old log file: %w", err)
+		}
+
+		backups = backups[1:]
+	}
+
+	return nil
+}
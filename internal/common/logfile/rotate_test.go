@@ -0,0 +1,74 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFile_size(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "authorizer.log")
+
+	rf, err := OpenRotatingFile(path, 10, 0, 2)
+	assert.NoError(t, err)
+
+	current := time.Date(2019, 2, 13, 11, 0, 0, 0, time.UTC)
+	rf.now = func() time.Time {
+		current = current.Add(time.Second)
+
+		return current
+	}
+
+	for _, line := range []string{"12345\n", "12345\n", "12345\n", "12345\n"} {
+		_, err = rf.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, rf.Close())
+
+	backups, err := filepath.Glob(path + ".*")
+	assert.NoError(t, err)
+	sort.Strings(backups)
+	assert.Equal(t, []string{path + ".20190213T110003.000000000", path + ".20190213T110005.000000000"}, backups)
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "12345\n", string(content))
+}
+
+func TestRotatingFile_age(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "authorizer.log")
+	current := time.Date(2019, 2, 13, 11, 0, 0, 0, time.UTC)
+
+	rf, err := OpenRotatingFile(path, 0, time.Hour, 0)
+	assert.NoError(t, err)
+
+	rf.now = func() time.Time { return current }
+	rf.openedAt = current
+
+	_, err = rf.Write([]byte("first\n"))
+	assert.NoError(t, err)
+
+	current = current.Add(time.Hour)
+
+	_, err = rf.Write([]byte("second\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, rf.Close())
+
+	backup, err := os.ReadFile(path + ".20190213T120000.000000000")
+	assert.NoError(t, err)
+	assert.Equal(t, "first\n", string(backup))
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "second\n", string(content))
+}
+
+func TestOpenRotatingFile_error(t *testing.T) {
+	_, err := OpenRotatingFile(filepath.Join(t.TempDir(), "missing", "authorizer.log"), 0, 0, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"io"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// DefaultBuckets are the upper bounds in seconds used by latency histograms
+func DefaultBuckets() []float64 {
+	return []float64{0.00001, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+}
+
+// NewRegistry creates an empty registry, the metrics of the application are registered in it instead of the
+// global registry of prometheus so every command and test has its own
+func NewRegistry() *prometheus.Registry {
+	return prometheus.NewRegistry()
+}
+
+// WritePrometheus writes every metric of the gatherer in the Prometheus text exposition format
+func WritePrometheus(w io.Writer, g prometheus.Gatherer) error {
+	families, err := g.Gather()
+	if err != nil {
+		return err
+	}
+
+	for _, family := range families {
+		if _, err = expfmt.MetricFamilyToText(w, family); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	r := NewRegistry()
+
+	operations := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "authorizer_operations_total",
+		Help: "Operations processed.",
+	}, []string{"operation", "outcome"})
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "authorizer_latency_seconds",
+		Help:    "Latency.",
+		Buckets: []float64{0.1, 1},
+	})
+	accounts := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "authorizer_accounts",
+		Help: "Accounts stored.",
+	}, func() float64 { return 3 })
+	r.MustRegister(operations, latency, accounts)
+
+	operations.WithLabelValues("transaction", "approved").Add(2)
+	operations.WithLabelValues("account", "a \"quoted\"\nvalue").Inc()
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(2)
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, WritePrometheus(buf, r))
+
+	// the output is read back with the parser of prometheus
+	families, err := new(expfmt.TextParser).TextToMetricFamilies(buf)
+	assert.NoError(t, err)
+	assert.Len(t, families, 3)
+
+	counters := families["authorizer_operations_total"].GetMetric()
+	assert.Len(t, counters, 2)
+	assert.Equal(t, "a \"quoted\"\nvalue", counters[0].GetLabel()[1].GetValue())
+	assert.Equal(t, float64(1), counters[0].GetCounter().GetValue())
+	assert.Equal(t, float64(2), counters[1].GetCounter().GetValue())
+
+	histogram := families["authorizer_latency_seconds"].GetMetric()[0].GetHistogram()
+	assert.Equal(t, uint64(3), histogram.GetSampleCount())
+	assert.Equal(t, 2.55, histogram.GetSampleSum())
+	assert.Equal(t, uint64(1), histogram.GetBucket()[0].GetCumulativeCount())
+	assert.Equal(t, uint64(2), histogram.GetBucket()[1].GetCumulativeCount())
+
+	assert.Equal(t, float64(3), families["authorizer_accounts"].GetMetric()[0].GetGauge().GetValue())
+}
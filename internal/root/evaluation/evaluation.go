@@ -0,0 +1,218 @@
+package evaluation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"authorizer/internal/root/reader"
+	"authorizer/internal/root/workload"
+	"authorizer/internal/root/writer"
+)
+
+// Matrix is the confusion matrix of a decision: a positive is a declined transaction and a true one is labeled as fraud
+type Matrix struct {
+	TruePositives  int `json:"truePositives"`
+	FalsePositives int `json:"falsePositives"`
+	FalseNegatives int `json:"falseNegatives"`
+	TrueNegatives  int `json:"trueNegatives"`
+	// Precision is the fraction of the declined transactions that were fraud, 0 when nothing was declined
+	Precision float64 `json:"precision"`
+	// Recall is the fraction of the fraud that was declined, 0 when there was no fraud
+	Recall float64 `json:"recall"`
+}
+
+func (m *Matrix) add(declined, fraud bool) {
+	switch {
+	case declined && fraud:
+		m.TruePositives++
+	case declined:
+		m.FalsePositives++
+	case fraud:
+		m.FalseNegatives++
+	default:
+		m.TrueNegatives++
+	}
+
+	m.Precision = ratio(m.TruePositives, m.TruePositives+m.FalsePositives)
+	m.Recall = ratio(m.TruePositives, m.TruePositives+m.FalseNegatives)
+}
+
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(n) / float64(total)
+}
+
+// Evaluation compares the decisions of the business rules with the labels of the transactions.
+// The input is read with Format and the responses are added with Output, the transactions must be explained,
+// so every rule is evaluated even after a violation
+type Evaluation struct {
+	Transactions int `json:"transactions"`
+	// Unlabeled are the transactions without label, they are not part of the matrices
+	Unlabeled int `json:"unlabeled"`
+	// RuleSetVersion is the version of the rules configuration of the last transaction
+	RuleSetVersion string `json:"ruleSetVersion,omitempty"`
+	// Overall is the decision of the service, Rules the violations raised by every rule
+	Overall             Matrix             `json:"overall"`
+	Rules               map[string]*Matrix `json:"rules"`
+	ApprovedFraudAmount int                `json:"approvedFraudAmount"`
+	DeclinedLegitAmount int                `json:"declinedLegitAmount"`
+	// order of the rules in the explanations, it is the order they are executed
+	order []string
+	// last is the transaction read last, its response is the next one added
+	last labeledTransaction
+}
+
+// labeledTransaction is a transaction read by Format waiting for its response
+type labeledTransaction struct {
+	line   int
+	amount int
+	label  *workload.Label
+}
+
+// New creates an empty evaluation
+func New() *Evaluation {
+	return &Evaluation{Rules: map[string]*Matrix{}}
+}
+
+// Format reads the input with format and keeps the label of every transaction, the label is the key label
+// of the ndjson object: {"transaction": {...}, "label": {"fraud": true}}
+func (e *Evaluation) Format(format reader.Format) reader.Format {
+	return func(r io.Reader) reader.Decoder {
+		return &labelDecoder{decoder: format(r), evaluation: e}
+	}
+}
+
+type labelDecoder struct {
+	decoder    reader.Decoder
+	evaluation *Evaluation
+}
+
+func (d *labelDecoder) Decode() (reader.Request, error) {
+	req, err := d.decoder.Decode()
+
+	d.evaluation.last = labeledTransaction{line: req.Line}
+
+	if err != nil || req.ProcessTransaction == nil {
+		return req, err
+	}
+
+	var labeled struct {
+		Label *workload.Label `json:"label"`
+	}
+
+	if json.Unmarshal([]byte(req.Input), &labeled) == nil {
+		d.evaluation.last.label = labeled.Label
+	}
+
+	d.evaluation.last.amount = req.ProcessTransaction.Transaction.Amount
+
+	return req, nil
+}
+
+// Output is a writer.Format that adds the responses to the evaluation instead of writing them
+func (e *Evaluation) Output(io.Writer, writer.Fields) writer.Encoder {
+	return evaluationEncoder{e}
+}
+
+type evaluationEncoder struct {
+	evaluation *Evaluation
+}
+
+func (enc evaluationEncoder) Encode(r writer.Record) error {
+	e := enc.evaluation
+	if r.Operation != reader.OperationTransaction || r.Failure != "" || r.Line != e.last.line {
+		return nil
+	}
+
+	e.add(r, e.last)
+
+	return nil
+}
+
+func (enc evaluationEncoder) Flush() error {
+	return nil
+}
+
+func (e *Evaluation) add(r writer.Record, tx labeledTransaction) {
+	e.Transactions++
+
+	if tx.label == nil {
+		e.Unlabeled++
+
+		return
+	}
+
+	fraud := tx.label.Fraud
+	declined := len(r.Response.Violations) > 0
+
+	e.RuleSetVersion = r.Response.RuleSetVersion
+	e.Overall.add(declined, fraud)
+
+	switch {
+	case fraud && !declined:
+		e.ApprovedFraudAmount += tx.amount
+	case !fraud && declined:
+		e.DeclinedLegitAmount += tx.amount
+	}
+
+	for _, trace := range r.Response.Explanation {
+		m, ok := e.Rules[trace.Rule]
+		if !ok {
+			m = &Matrix{}
+			e.Rules[trace.Rule] = m
+			e.order = append(e.order, trace.Rule)
+		}
+
+		m.add(!trace.Passed, fraud)
+	}
+}
+
+// Write writes the evaluation as "json" or as a "table" with a row for every matrix
+func (e *Evaluation) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(e)
+	case "table":
+		return e.writeTable(w)
+	default:
+		return fmt.Errorf("unknown evaluation format %q, it must be json or table", format)
+	}
+}
+
+func (e *Evaluation) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "\ttp\tfp\tfn\ttn\tprecision\trecall\n")
+	writeMatrix(tw, "overall", e.Overall)
+
+	for _, rule := range e.order {
+		writeMatrix(tw, rule, *e.Rules[rule])
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	version := e.RuleSetVersion
+	if version == "" {
+		version = "default"
+	}
+
+	_, err := fmt.Fprintf(w, "\n%d transactions, %d unlabeled, rule set %s\n"+
+		"approved fraud amount: %d\ndeclined legit amount: %d\n",
+		e.Transactions, e.Unlabeled, version, e.ApprovedFraudAmount, e.DeclinedLegitAmount)
+
+	return err
+}
+
+func writeMatrix(w io.Writer, name string, m Matrix) {
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\t%s\n", name,
+		m.TruePositives, m.FalsePositives, m.FalseNegatives, m.TrueNegatives,
+		strconv.FormatFloat(m.Precision, 'f', 3, 64), strconv.FormatFloat(m.Recall, 'f', 3, 64))
+}
@@ -0,0 +1,75 @@
+package evaluation
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/service"
+	"authorizer/internal/app/storage"
+	cmd2 "authorizer/internal/root"
+	"authorizer/internal/root/reader"
+	"authorizer/internal/root/writer"
+)
+
+const input = `{"account": {"activeCard": true, "availableLimit": 100}}
+{"transaction": {"merchant": "Oxxo", "amount": 20, "time": "2019-02-13T10:00:00.000Z"}, "label": {"fraud": false}}
+{"transaction": {"merchant": "Oxxo", "amount": 20, "time": "2019-02-13T10:01:00.000Z"}, "label": {"fraud": true}}
+{"transaction": {"merchant": "Habbib's", "amount": 30, "time": "2019-02-13T10:01:30.000Z"}, "label": {"fraud": true}}
+{"transaction": {"merchant": "Oxxo", "amount": 10, "time": "2019-02-13T10:01:40.000Z"}, "label": {"fraud": false}}
+{"transaction": {"merchant": "Burger King", "amount": 10, "time": "2019-02-13T12:00:00.000Z"}}
+{"transaction": {"merchant": "Burger King", "amount": `
+
+func evaluate(t *testing.T) *Evaluation {
+	e := New()
+	out := new(bytes.Buffer)
+
+	cmd2.Execute(service.New(&storage.InMemory{}, service.WithExplain(true)), strings.NewReader(input), out,
+		cmd2.WithInputFormat(e.Format(reader.NDJSON)), cmd2.WithOutputFormat(e.Output, writer.Fields{}))
+
+	assert.Empty(t, out.String())
+
+	return e
+}
+
+func TestEvaluation(t *testing.T) {
+	e := evaluate(t)
+
+	assert.Equal(t, 5, e.Transactions)
+	assert.Equal(t, 1, e.Unlabeled)
+
+	// the double is declined, the transaction of Habbib's is approved and the last one of Oxxo is the third
+	// transaction in 2 minutes
+	assert.Equal(t, Matrix{TruePositives: 1, FalsePositives: 1, FalseNegatives: 1, TrueNegatives: 1,
+		Precision: 0.5, Recall: 0.5}, e.Overall)
+	assert.Equal(t, Matrix{TruePositives: 1, TrueNegatives: 2, FalseNegatives: 1, Precision: 1, Recall: 0.5},
+		*e.Rules["doubleTransaction"])
+	assert.Equal(t, Matrix{FalsePositives: 1, FalseNegatives: 2, TrueNegatives: 1},
+		*e.Rules["highFrequency"])
+	assert.Equal(t, Matrix{FalseNegatives: 2, TrueNegatives: 2}, *e.Rules["isActive"])
+	assert.Equal(t, 30, e.ApprovedFraudAmount)
+	assert.Equal(t, 10, e.DeclinedLegitAmount)
+	assert.Equal(t, []string{"isActive", "declinedAttempts", "sufficientLimit", "homeCountry", "doubleTransaction",
+		"highFrequency",
+		"cardTesting", "impossibleTravel"}, e.order)
+}
+
+func TestEvaluation_Write(t *testing.T) {
+	e := evaluate(t)
+
+	out := new(bytes.Buffer)
+	assert.NoError(t, e.Write(out, "table"))
+	assert.Contains(t, out.String(), "overall            1   1   1   1   0.500      0.500\n")
+	assert.Contains(t, out.String(), "doubleTransaction  1   0   1   2   1.000      0.500\n")
+	assert.Contains(t, out.String(), "5 transactions, 1 unlabeled, rule set default\n"+
+		"approved fraud amount: 30\ndeclined legit amount: 10\n")
+
+	out.Reset()
+	assert.NoError(t, e.Write(out, "json"))
+	assert.Contains(t, out.String(), `"overall":{"truePositives":1,"falsePositives":1,"falseNegatives":1,`+
+		`"trueNegatives":1,"precision":0.5,"recall":0.5}`)
+
+	assert.EqualError(t, e.Write(out, "xml"), `unknown evaluation format "xml", it must be json or table`)
+}
@@ -0,0 +1,143 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type csvDecoder struct {
+	reader  *csv.Reader
+	mapping map[string]string
+	// header are the field names of the columns, an empty name is a column that is ignored
+	header []string
+	line   int
+	// strict returns the columns that are not fields as a problem of the header
+	strict bool
+	// ignored are the columns of the header that are not fields
+	ignored []string
+}
+
+// CSV reads records with a header row, the columns are named as the fields (amount, merchant, time...)
+// or renamed with the mapping, columns that are not fields are ignored.
+// The operation is the column "operation" or it is detected from the columns with a value
+func CSV(mapping map[string]string) Format {
+	return func(r io.Reader) Decoder {
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+
+		return &csvDecoder{reader: reader, mapping: mapping}
+	}
+}
+
+// strictCSV is CSV returning the header as an invalid record when it has columns that are not fields
+func strictCSV(mapping map[string]string) Format {
+	csvFormat := CSV(mapping)
+
+	return func(r io.Reader) Decoder {
+		d := csvFormat(r).(*csvDecoder)
+		d.strict = true
+
+		return d
+	}
+}
+
+func (d *csvDecoder) Decode() (Request, error) {
+	if d.header == nil {
+		if err := d.readHeader(); err != nil {
+			return Request{}, err
+		}
+
+		if d.strict && len(d.ignored) > 0 {
+			problems := make([]string, 0, len(d.ignored))
+			for _, column := range d.ignored {
+				problems = append(problems, fmt.Sprintf("unknown column %s", column))
+			}
+
+			return Request{Input: strings.Join(d.ignored, ","), Line: d.line}, &ValidationError{Problems: problems}
+		}
+	}
+
+	record, err := d.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			d.line++
+
+			return Request{Input: strings.Join(record, ","), Line: d.line}, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+
+		return Request{}, err
+	}
+
+	d.line++
+	input := encodeRecord(record)
+
+	if len(record) != len(d.header) {
+		return Request{Input: input, Line: d.line}, fmt.Errorf("%w: %d columns, the header has %d",
+			ErrInvalidInput, len(record), len(d.header))
+	}
+
+	f := fields{}
+
+	for i, value := range record {
+		if d.header[i] != "" {
+			f.set(d.header[i], value)
+		}
+	}
+
+	return f.request(input, d.line)
+}
+
+func (d *csvDecoder) readHeader() error {
+	header, err := d.reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return err
+		}
+
+		return fmt.Errorf("error reading csv header: %w", err)
+	}
+
+	d.line++
+
+	d.header = make([]string, len(header))
+
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		if field, ok := d.mapping[column]; ok {
+			column = field
+		}
+
+		if isField(column) {
+			d.header[i] = column
+		} else {
+			d.ignored = append(d.ignored, column)
+		}
+	}
+
+	return nil
+}
+
+// encodeRecord writes the record back as csv to be recorded in the audit log
+func encodeRecord(record []string) string {
+	buf := bytes.Buffer{}
+	w := csv.NewWriter(&buf)
+	_ = w.Write(record)
+	w.Flush()
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func isField(name string) bool {
+	switch name {
+	case FieldOperation, FieldAccountID, FieldRequestID, FieldActiveCard, FieldAvailableLimit, FieldHomeCountry,
+		FieldMerchant, FieldAmount, FieldTime, FieldCountry, FieldLatitude, FieldLongitude, FieldExplain:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,94 @@
+package reader
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/app/service"
+)
+
+func TestCSV(t *testing.T) {
+	input := "operation,activeCard,availableLimit,merchant,amount,time,lat,long,reference\n" +
+		"account,true,100,,,,,,a1\n" +
+		",,,Burger King,20,2019-02-13T10:00:00Z,,,a2\n" +
+		"transaction,,,\"Habbib's, Centro\",30,2019-02-13T11:00:00Z,-23.5,-46.6,a3\n" +
+		",,,,,,,,a4\n" +
+		",,,Burger King,twenty,2019-02-13T10:00:00Z,,,a5\n" +
+		"payment,,,,15,2019-02-13T12:00:00Z,,,a6\n" +
+		"deposit,,,,10,,,,a7\n" +
+		"account,true\n"
+	decoder := CSV(nil)(strings.NewReader(input))
+
+	req, err := decoder.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, &service.CreateAccount{Account: model.Account{Id: 1, ActiveCard: true, AvailableLimit: 100}},
+		req.CreateAccount)
+	assert.Equal(t, "account,true,100,,,,,,a1", req.Input)
+	assert.Equal(t, 2, req.Line)
+
+	req, err = decoder.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, OperationTransaction, req.Operation)
+	assert.Equal(t, model.Transaction{
+		Merchant: "Burger King",
+		Amount:   20,
+		Time:     time.Date(2019, 2, 13, 10, 0, 0, 0, time.UTC),
+	}, req.ProcessTransaction.Transaction)
+	assert.Equal(t, 1, req.ProcessTransaction.AccountID)
+
+	req, err = decoder.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, "Habbib's, Centro", req.ProcessTransaction.Transaction.Merchant)
+	assert.Equal(t, &model.Coordinates{Latitude: -23.5, Longitude: -46.6}, req.ProcessTransaction.Transaction.Coordinates)
+	assert.Equal(t, "transaction,,,\"Habbib's, Centro\",30,2019-02-13T11:00:00Z,-23.5,-46.6,a3", req.Input)
+
+	for _, want := range []error{ErrUnknownOperation, ErrInvalidInput} {
+		_, err = decoder.Decode()
+		assert.True(t, errors.Is(err, want), "got error %v, want %v", err, want)
+	}
+
+	req, err = decoder.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, OperationPayment, req.Operation)
+	assert.Equal(t, model.Payment{Amount: 15, Time: time.Date(2019, 2, 13, 12, 0, 0, 0, time.UTC)},
+		req.ProcessPayment.Payment)
+	assert.Equal(t, 1, req.ProcessPayment.AccountID)
+
+	for _, want := range []error{ErrUnknownOperation, ErrInvalidInput} {
+		_, err = decoder.Decode()
+		assert.True(t, errors.Is(err, want), "got error %v, want %v", err, want)
+	}
+
+	_, err = decoder.Decode()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestCSV_mapping(t *testing.T) {
+	mapping, err := ParseMapping("MERCHANT_NAME=merchant, AMT=amount,TX_TIME=time,ACCOUNT=accountId")
+	assert.NoError(t, err)
+
+	input := "ACCOUNT,MERCHANT_NAME,AMT,TX_TIME\n2,Burger King,20,2019-02-13T10:00:00Z\n"
+
+	req, err := CSV(mapping)(strings.NewReader(input)).Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, req.ProcessTransaction.AccountID)
+	assert.Equal(t, "Burger King", req.ProcessTransaction.Transaction.Merchant)
+	assert.Equal(t, 20, req.ProcessTransaction.Transaction.Amount)
+
+	_, err = ParseMapping("AMT")
+	assert.Error(t, err)
+
+	_, err = NewFormat(FormatCSV, Options{Mapping: map[string]string{"AMT": "value"}})
+	assert.Error(t, err)
+}
+
+func TestCSV_empty(t *testing.T) {
+	_, err := CSV(nil)(strings.NewReader("")).Decode()
+	assert.Equal(t, io.EOF, err)
+}
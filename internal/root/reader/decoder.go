@@ -0,0 +1,113 @@
+package reader
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	"authorizer/internal/app/service"
+)
+
+// Operations that can be received in the input
+const (
+	OperationAccount      = "account"
+	OperationTransaction  = "transaction"
+	OperationRuleSettings = "ruleSettings"
+	OperationPayment      = "payment"
+)
+
+// Input formats
+const (
+	FormatNDJSON     = "ndjson"
+	FormatCSV        = "csv"
+	FormatFixedWidth = "fixed-width"
+)
+
+// ErrUnknownOperation is returned when the operation of a record can't be detected
+var ErrUnknownOperation = errors.New("unknown operation")
+
+// ErrInvalidInput is returned when the operation was detected but the record can't be parsed
+var ErrInvalidInput = errors.New("invalid input")
+
+// Request is an operation read from the input, only the field of its operation is set
+type Request struct {
+	Operation string
+	// Line is the position of the record in the input starting at 1, the csv header is the line 1
+	Line int
+	// Input is the record as it was received, it is recorded in the audit log
+	Input              string
+	CreateAccount      *service.CreateAccount
+	ProcessTransaction *service.ProcessTransaction
+	SetRuleSettings    *service.SetRuleSettings
+	ProcessPayment     *service.ProcessPayment
+}
+
+// Decoder reads the operations of an input one at a time
+type Decoder interface {
+	// Decode returns the next request and io.EOF when the input ends,
+	// errors wrapping ErrUnknownOperation or ErrInvalidInput only affect the record returned,
+	// the input can still be read, any other error means the input can't be read anymore
+	Decode() (Request, error)
+}
+
+// Format creates the decoder of an input
+type Format func(r io.Reader) Decoder
+
+// Options are the settings of the formats that are not self-describing
+type Options struct {
+	// Mapping renames the columns of the csv header to the field names, e.g. "AMT" to "amount"
+	Mapping map[string]string
+	// Layout are the columns of the fixed-width records
+	Layout []Column
+	// Strict rejects the unknown fields and the records that Strict considers wrong
+	Strict bool
+}
+
+// NewFormat returns the Format with the name received
+func NewFormat(name string, o Options) (Format, error) {
+	format, err := newFormat(name, o)
+	if err != nil || !o.Strict {
+		return format, err
+	}
+
+	return Strict(format), nil
+}
+
+func newFormat(name string, o Options) (Format, error) {
+	switch name {
+	case FormatNDJSON, "":
+		if o.Strict {
+			return func(r io.Reader) Decoder {
+				return &ndjsonDecoder{scanner: bufio.NewScanner(r), strict: true}
+			}, nil
+		}
+
+		return NDJSON, nil
+	case FormatCSV:
+		for column, field := range o.Mapping {
+			if !isField(field) {
+				return nil, fmt.Errorf("column %s is mapped to the unknown field %s", column, field)
+			}
+		}
+
+		if o.Strict {
+			return strictCSV(o.Mapping), nil
+		}
+
+		return CSV(o.Mapping), nil
+	case FormatFixedWidth:
+		if len(o.Layout) == 0 {
+			return nil, errors.New("fixed-width input requires a layout")
+		}
+
+		if err := validateLayout(o.Layout); err != nil {
+			return nil, err
+		}
+
+		return FixedWidth(o.Layout), nil
+	default:
+		return nil, fmt.Errorf("unknown input format %q, it must be %s, %s or %s",
+			name, FormatNDJSON, FormatCSV, FormatFixedWidth)
+	}
+}
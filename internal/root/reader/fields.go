@@ -0,0 +1,241 @@
+package reader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/app/service"
+)
+
+// Fields of the flat formats, csv and fixed-width, the rule settings can only be received as ndjson
+const (
+	FieldOperation      = "operation"
+	FieldAccountID      = "accountId"
+	FieldRequestID      = "requestId"
+	FieldActiveCard     = "activeCard"
+	FieldAvailableLimit = "availableLimit"
+	FieldHomeCountry    = "homeCountry"
+	FieldMerchant       = "merchant"
+	FieldAmount         = "amount"
+	FieldTime           = "time"
+	FieldCountry        = "country"
+	FieldLatitude       = "lat"
+	FieldLongitude      = "long"
+	FieldExplain        = "explain"
+)
+
+// fields is a flat record, the values are already trimmed and the empty ones are not set
+type fields map[string]string
+
+// operation returns the operation column, or detects it from the fields set
+func (f fields) operation() string {
+	if operation, ok := f[FieldOperation]; ok {
+		return operation
+	}
+
+	for _, field := range []string{FieldMerchant, FieldAmount, FieldTime} {
+		if _, ok := f[field]; ok {
+			return OperationTransaction
+		}
+	}
+
+	for _, field := range []string{FieldActiveCard, FieldAvailableLimit} {
+		if _, ok := f[field]; ok {
+			return OperationAccount
+		}
+	}
+
+	return ""
+}
+
+// request builds the request of the operation of the record
+func (f fields) request(input string, line int) (Request, error) {
+	req := Request{Input: input, Line: line, Operation: f.operation()}
+
+	var err error
+
+	switch req.Operation {
+	case OperationAccount:
+		req.CreateAccount, err = f.createAccount()
+	case OperationTransaction:
+		req.ProcessTransaction, err = f.processTransaction()
+	case OperationPayment:
+		req.ProcessPayment, err = f.processPayment()
+	case OperationRuleSettings:
+		err = fmt.Errorf("%s is only supported in %s", OperationRuleSettings, FormatNDJSON)
+	case "":
+		return req, ErrUnknownOperation
+	default:
+		return req, fmt.Errorf("%w: %s", ErrUnknownOperation, req.Operation)
+	}
+
+	if err != nil {
+		return req, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	return req, nil
+}
+
+func (f fields) createAccount() (*service.CreateAccount, error) {
+	ca := &service.CreateAccount{RequestID: f[FieldRequestID]}
+
+	var err error
+
+	if ca.Account.Id, err = f.int(FieldAccountID, defaultID); err != nil {
+		return nil, err
+	}
+
+	if ca.Account.ActiveCard, err = f.bool(FieldActiveCard); err != nil {
+		return nil, err
+	}
+
+	if ca.Account.AvailableLimit, err = f.int(FieldAvailableLimit, 0); err != nil {
+		return nil, err
+	}
+
+	ca.Account.HomeCountry = f[FieldHomeCountry]
+
+	return ca, nil
+}
+
+func (f fields) processTransaction() (*service.ProcessTransaction, error) {
+	pt := &service.ProcessTransaction{RequestID: f[FieldRequestID]}
+
+	var err error
+
+	if pt.AccountID, err = f.int(FieldAccountID, defaultID); err != nil {
+		return nil, err
+	}
+
+	if pt.Explain, err = f.bool(FieldExplain); err != nil {
+		return nil, err
+	}
+
+	pt.Transaction.Merchant = f[FieldMerchant]
+	pt.Transaction.Country = f[FieldCountry]
+
+	if pt.Transaction.Amount, err = f.int(FieldAmount, 0); err != nil {
+		return nil, err
+	}
+
+	if v, ok := f[FieldTime]; ok {
+		if pt.Transaction.Time, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, fmt.Errorf("%s: %w", FieldTime, err)
+		}
+	}
+
+	_, hasLatitude := f[FieldLatitude]
+	_, hasLongitude := f[FieldLongitude]
+
+	if hasLatitude || hasLongitude {
+		coordinates := &model.Coordinates{}
+
+		if coordinates.Latitude, err = f.float(FieldLatitude); err != nil {
+			return nil, err
+		}
+
+		if coordinates.Longitude, err = f.float(FieldLongitude); err != nil {
+			return nil, err
+		}
+
+		pt.Transaction.Coordinates = coordinates
+	}
+
+	return pt, nil
+}
+
+// processPayment reads the payment of a record, the operation column is required as a payment has the fields
+// of a transaction
+func (f fields) processPayment() (*service.ProcessPayment, error) {
+	pp := &service.ProcessPayment{RequestID: f[FieldRequestID]}
+
+	var err error
+
+	if pp.AccountID, err = f.int(FieldAccountID, defaultID); err != nil {
+		return nil, err
+	}
+
+	if pp.Payment.Amount, err = f.int(FieldAmount, 0); err != nil {
+		return nil, err
+	}
+
+	if v, ok := f[FieldTime]; ok {
+		if pp.Payment.Time, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, fmt.Errorf("%s: %w", FieldTime, err)
+		}
+	}
+
+	return pp, nil
+}
+
+func (f fields) int(field string, def int) (int, error) {
+	v, ok := f[field]
+	if !ok {
+		return def, nil
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", field, err)
+	}
+
+	return i, nil
+}
+
+func (f fields) bool(field string) (bool, error) {
+	v, ok := f[field]
+	if !ok {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", field, err)
+	}
+
+	return b, nil
+}
+
+func (f fields) float(field string) (float64, error) {
+	v, ok := f[field]
+	if !ok {
+		return 0, fmt.Errorf("%s is required with %s and %s", field, FieldLatitude, FieldLongitude)
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", field, err)
+	}
+
+	return n, nil
+}
+
+// set adds the value to the record when it isn't empty
+func (f fields) set(field, value string) {
+	if value = strings.TrimSpace(value); value != "" {
+		f[field] = value
+	}
+}
+
+// ParseMapping parses the renaming of columns to fields with the form "COLUMN=field,OTHER=field"
+func ParseMapping(s string) (map[string]string, error) {
+	mapping := map[string]string{}
+
+	if s == "" {
+		return mapping, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid mapping %q, it must be COLUMN=field", pair)
+		}
+
+		mapping[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return mapping, nil
+}
@@ -0,0 +1,100 @@
+package reader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Column is a field of a fixed-width record
+type Column struct {
+	Field string
+	// Width is the number of characters of the column
+	Width int
+}
+
+type fixedWidthDecoder struct {
+	scanner *bufio.Scanner
+	layout  []Column
+	line    int
+}
+
+// FixedWidth reads one record per line, the columns are the layout in order, values are trimmed.
+// Columns with the name "-" are ignored
+func FixedWidth(layout []Column) Format {
+	return func(r io.Reader) Decoder {
+		return &fixedWidthDecoder{scanner: bufio.NewScanner(r), layout: layout}
+	}
+}
+
+func (d *fixedWidthDecoder) Decode() (Request, error) {
+	if !d.scanner.Scan() {
+		if err := d.scanner.Err(); err != nil {
+			return Request{}, err
+		}
+
+		return Request{}, io.EOF
+	}
+
+	d.line++
+	line := d.scanner.Text()
+	record := []rune(line)
+	f := fields{}
+	start := 0
+
+	for _, column := range d.layout {
+		end := start + column.Width
+		if end > len(record) {
+			end = len(record)
+		}
+
+		if start < end && column.Field != "-" {
+			f.set(column.Field, string(record[start:end]))
+		}
+
+		start += column.Width
+	}
+
+	return f.request(line, d.line)
+}
+
+// ParseLayout parses the columns of a fixed-width record with the form "field:width,field:width"
+func ParseLayout(s string) ([]Column, error) {
+	var layout []Column
+
+	if s == "" {
+		return layout, nil
+	}
+
+	for _, column := range strings.Split(s, ",") {
+		parts := strings.SplitN(column, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid column %q, it must be field:width", column)
+		}
+
+		width, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid width of column %q: %w", column, err)
+		}
+
+		layout = append(layout, Column{Field: strings.TrimSpace(parts[0]), Width: width})
+	}
+
+	return layout, validateLayout(layout)
+}
+
+func validateLayout(layout []Column) error {
+	for _, column := range layout {
+		if column.Width <= 0 {
+			return fmt.Errorf("the width of column %s must be greater than 0", column.Field)
+		}
+
+		if column.Field != "-" && !isField(column.Field) {
+			return fmt.Errorf("unknown field %s in the layout", column.Field)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package reader
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/model"
+)
+
+func TestFixedWidth(t *testing.T) {
+	layout, err := ParseLayout("operation:12,merchant:15,amount:8,-:4,time:20")
+	assert.NoError(t, err)
+
+	input := "transaction Burger King          20XXXX2019-02-13T10:00:00Z\n" +
+		"transaction Habbib's            abcXXXX2019-02-13T10:00:00Z\n" +
+		"deposit                          10\n" +
+		"transaction McDonald's           30\n"
+	decoder := FixedWidth(layout)(strings.NewReader(input))
+
+	req, err := decoder.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, model.Transaction{
+		Merchant: "Burger King",
+		Amount:   20,
+		Time:     time.Date(2019, 2, 13, 10, 0, 0, 0, time.UTC),
+	}, req.ProcessTransaction.Transaction)
+	assert.Equal(t, "transaction Burger King          20XXXX2019-02-13T10:00:00Z", req.Input)
+
+	_, err = decoder.Decode()
+	assert.True(t, errors.Is(err, ErrInvalidInput))
+
+	_, err = decoder.Decode()
+	assert.True(t, errors.Is(err, ErrUnknownOperation))
+
+	req, err = decoder.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, 30, req.ProcessTransaction.Transaction.Amount)
+	assert.Equal(t, 4, req.Line)
+	assert.True(t, req.ProcessTransaction.Transaction.Time.IsZero())
+
+	_, err = decoder.Decode()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestParseLayout(t *testing.T) {
+	tests := []struct {
+		name    string
+		layout  string
+		want    []Column
+		wantErr bool
+	}{
+		{"valid", "merchant:10, amount:5", []Column{{"merchant", 10}, {"amount", 5}}, false},
+		{"empty", "", nil, false},
+		{"without width", "merchant", nil, true},
+		{"invalid width", "merchant:ten", nil, true},
+		{"zero width", "merchant:0", nil, true},
+		{"unknown field", "value:10", nil, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLayout(tt.layout)
+			if tt.wantErr {
+				assert.Error(t, err)
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package reader
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"authorizer/internal/app/service"
+)
+
+// FieldLabel is the expected outcome of a transaction in a labeled input, it is not executed but strict mode
+// accepts it, so a generated input can be validated
+const FieldLabel = "label"
+
+type ndjsonDecoder struct {
+	scanner *bufio.Scanner
+	line    int
+	// strict rejects the keys that are not fields of the operation
+	strict bool
+}
+
+// NDJSON reads one json object per line, the operation is the key of the object:
+// {"account": {...}}, {"transaction": {...}}, {"ruleSettings": {...}} or {"payment": {...}}.
+// The account of the operation is the key accountId of the object, 1 when it is not set
+func NDJSON(r io.Reader) Decoder {
+	return &ndjsonDecoder{scanner: bufio.NewScanner(r)}
+}
+
+func (d *ndjsonDecoder) Decode() (Request, error) {
+	if !d.scanner.Scan() {
+		if err := d.scanner.Err(); err != nil {
+			return Request{}, err
+		}
+
+		return Request{}, io.EOF
+	}
+
+	d.line++
+	line := d.scanner.Text()
+	req := Request{Input: line, Line: d.line}
+
+	if !strings.HasPrefix(strings.TrimSpace(line), "{") {
+		return req, ErrUnknownOperation
+	}
+
+	keys := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(line), &keys); err != nil {
+		return req, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	operations := []string{OperationAccount, OperationTransaction, OperationRuleSettings, OperationPayment}
+
+	for _, operation := range operations {
+		if _, ok := keys[operation]; !ok {
+			continue
+		}
+
+		if req.Operation != "" {
+			return req, fmt.Errorf("%w: operations %s and %s in the same line", ErrInvalidInput, req.Operation, operation)
+		}
+
+		req.Operation = operation
+	}
+
+	switch req.Operation {
+	case OperationAccount:
+		req.CreateAccount = ReadCreateAccount(line)
+	case OperationTransaction:
+		req.ProcessTransaction = ReadProcessTransaction(line)
+	case OperationRuleSettings:
+		req.SetRuleSettings = ReadSetRuleSettings(line)
+	case OperationPayment:
+		req.ProcessPayment = ReadProcessPayment(line)
+	default:
+		return req, ErrUnknownOperation
+	}
+
+	if req.CreateAccount == nil && req.ProcessTransaction == nil && req.SetRuleSettings == nil &&
+		req.ProcessPayment == nil {
+		return req, fmt.Errorf("%w: %s: %v", ErrInvalidInput, req.Operation, decodeError(line, req.Operation))
+	}
+
+	if raw, ok := keys[FieldAccountID]; ok {
+		if err := setAccountID(&req, raw); err != nil {
+			return req, err
+		}
+	}
+
+	if d.strict {
+		return req, d.checkFields(req)
+	}
+
+	return req, nil
+}
+
+// checkFields returns a *ValidationError with the keys of the line that are ignored by the operation
+func (d *ndjsonDecoder) checkFields(req Request) error {
+	var unknown []string
+
+	switch req.Operation {
+	case OperationAccount:
+		unknown = unknownFields(req.Input, req.CreateAccount)
+	case OperationTransaction:
+		unknown = unknownFields(req.Input, req.ProcessTransaction)
+	case OperationRuleSettings:
+		unknown = unknownFields(req.Input, req.SetRuleSettings)
+	case OperationPayment:
+		unknown = unknownFields(req.Input, req.ProcessPayment)
+	}
+
+	var problems []string
+
+	for _, field := range unknown {
+		if field == FieldAccountID || field == FieldLabel {
+			continue
+		}
+
+		problems = append(problems, fmt.Sprintf("unknown field %s", field))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Problems: problems}
+}
+
+// setAccountID sets the account of the operation, the id must be a positive number
+func setAccountID(req *Request, raw json.RawMessage) error {
+	var id int
+	if err := json.Unmarshal(raw, &id); err != nil || id < 1 {
+		return fmt.Errorf("%w: %s must be a positive number", ErrInvalidInput, FieldAccountID)
+	}
+
+	switch {
+	case req.CreateAccount != nil:
+		req.CreateAccount.Account.Id = id
+	case req.ProcessTransaction != nil:
+		req.ProcessTransaction.AccountID = id
+	case req.SetRuleSettings != nil:
+		req.SetRuleSettings.AccountID = id
+	case req.ProcessPayment != nil:
+		req.ProcessPayment.AccountID = id
+	}
+
+	return nil
+}
+
+// decodeError is the error of decoding the line as the operation, the Read functions only log it
+func decodeError(line, operation string) error {
+	var v interface{}
+
+	switch operation {
+	case OperationAccount:
+		v = &service.CreateAccount{}
+	case OperationTransaction:
+		v = &service.ProcessTransaction{}
+	case OperationPayment:
+		v = &service.ProcessPayment{}
+	default:
+		v = &service.SetRuleSettings{}
+	}
+
+	return json.Unmarshal([]byte(line), v)
+}
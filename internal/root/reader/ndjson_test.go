@@ -0,0 +1,94 @@
+package reader
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNDJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		operation string
+		err       error
+	}{
+		{"account",
+			`{"account": {"activeCard": true, "availableLimit": 100}}`, OperationAccount, nil},
+		{"transaction",
+			`{"transaction": {"merchant": "Burger King", "amount": 20, "time": "2019-02-13T10:00:00.000Z"}}`,
+			OperationTransaction, nil},
+		{"merchant containing the name of other operation",
+			`{"transaction": {"merchant": "account ruleSettings", "amount": 20, "time": "2019-02-13T10:00:00.000Z"}}`,
+			OperationTransaction, nil},
+		{"ruleSettings",
+			`{"ruleSettings": {"highFrequency": {"disabled": true}}, "requestId": "r1"}`, OperationRuleSettings, nil},
+		{"payment",
+			`{"payment": {"amount": 10, "time": "2019-02-13T10:00:00.000Z"}}`, OperationPayment, nil},
+		{"not json", "abcde", "", ErrUnknownOperation},
+		{"unknown key", `{"deposit": {"amount": 10}}`, "", ErrUnknownOperation},
+		{"truncated", `{"transaction": {"merchant": "Burger King", "amount": `, "", ErrInvalidInput},
+		{"two operations", `{"account": {}, "transaction": {}}`, OperationAccount, ErrInvalidInput},
+		{"invalid field", `{"transaction": {"amount": "20"}}`, OperationTransaction, ErrInvalidInput},
+		{"invalid account id", `{"account": {"activeCard": true}, "accountId": "2"}`, OperationAccount, ErrInvalidInput},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := NDJSON(strings.NewReader(tt.line)).Decode()
+
+			assert.True(t, errors.Is(err, tt.err), "got error %v", err)
+			assert.Equal(t, tt.operation, req.Operation)
+			assert.Equal(t, tt.line, req.Input)
+		})
+	}
+}
+
+func TestNDJSON_readsEveryLine(t *testing.T) {
+	decoder := NDJSON(strings.NewReader("abcde\n" + `{"account": {"activeCard": true, "availableLimit": 100}}` + "\n"))
+
+	_, err := decoder.Decode()
+	assert.True(t, errors.Is(err, ErrUnknownOperation))
+
+	req, err := decoder.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, 100, req.CreateAccount.Account.AvailableLimit)
+	assert.Equal(t, defaultID, req.CreateAccount.Account.Id)
+	assert.Equal(t, 2, req.Line)
+
+	_, err = decoder.Decode()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestNDJSON_accountID(t *testing.T) {
+	decoder := NDJSON(strings.NewReader(`{"account": {"activeCard": true, "availableLimit": 100}, "accountId": 2}
+{"transaction": {"merchant": "Oxxo", "amount": 20, "time": "2019-02-13T10:00:00.000Z"}, "accountId": 2}
+{"ruleSettings": {"highFrequency": {"disabled": true}}, "accountId": 3}
+{"payment": {"amount": 10, "time": "2019-02-13T10:00:00.000Z"}, "accountId": 4}
+{"transaction": {"merchant": "Oxxo", "amount": 20, "time": "2019-02-13T10:00:00.000Z"}, "accountId": 0}
+`))
+
+	req, err := decoder.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, req.CreateAccount.Account.Id)
+
+	req, err = decoder.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, req.ProcessTransaction.AccountID)
+
+	req, err = decoder.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, req.SetRuleSettings.AccountID)
+
+	req, err = decoder.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, req.ProcessPayment.AccountID)
+	assert.Equal(t, 10, req.ProcessPayment.Payment.Amount)
+
+	_, err = decoder.Decode()
+	assert.EqualError(t, err, "invalid input: accountId must be a positive number")
+}
@@ -43,3 +43,37 @@ func ReadProcessTransaction(s string) *service.ProcessTransaction {
 
 	return processTransaction
 }
+
+// ReadProcessPayment gets the struct from the text line received
+func ReadProcessPayment(s string) *service.ProcessPayment {
+	processPayment := &service.ProcessPayment{}
+
+	if err := json.Unmarshal([]byte(s), processPayment); err != nil {
+		log.Errorf("error unmarshaling request: %+v", err)
+
+		return nil
+	}
+
+	if processPayment.AccountID == 0 {
+		processPayment.AccountID = defaultID
+	}
+
+	return processPayment
+}
+
+// ReadSetRuleSettings gets the struct from the text line received
+func ReadSetRuleSettings(s string) *service.SetRuleSettings {
+	setRuleSettings := &service.SetRuleSettings{}
+
+	if err := json.Unmarshal([]byte(s), setRuleSettings); err != nil {
+		log.Errorf("error unmarshaling request: %+v", err)
+
+		return nil
+	}
+
+	if setRuleSettings.AccountID == 0 {
+		setRuleSettings.AccountID = defaultID
+	}
+
+	return setRuleSettings
+}
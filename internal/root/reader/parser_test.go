@@ -107,3 +107,45 @@ func TestReadProcessTransaction(t *testing.T) {
 		})
 	}
 }
+
+func TestReadSetRuleSettings(t *testing.T) {
+	type args struct {
+		s string
+	}
+
+	window := model.Duration{Duration: 10 * time.Minute}
+
+	successSettings := service.SetRuleSettings{
+		RuleSettings: model.RuleSettings{
+			"highFrequency": {Window: &window, Threshold: 10},
+		},
+		AccountID: defaultID,
+	}
+
+	tests := []struct {
+		name string
+		args args
+		want *service.SetRuleSettings
+	}{
+		{"successCase",
+			args{s: "{ \"ruleSettings\": { \"highFrequency\": { \"window\": \"10m\", \"threshold\": 10 } } }"},
+			&successSettings,
+		},
+		{"invalidWindow",
+			args{s: "{ \"ruleSettings\": { \"highFrequency\": { \"window\": 10 } } }"},
+			nil,
+		},
+		{"invalidString",
+			args{s: "---"},
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := ReadSetRuleSettings(tt.args.s)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
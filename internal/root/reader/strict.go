@@ -0,0 +1,222 @@
+package reader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/app/service"
+)
+
+// ValidationError contains every problem found in a record by a strict decoder, it wraps ErrInvalidInput
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrInvalidInput, strings.Join(e.Problems, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidInput
+}
+
+type strictDecoder struct {
+	decoder Decoder
+	// accounts are the lines where every account was created
+	accounts map[int]int
+}
+
+// Strict reads with the format and also rejects the records that the service would execute but are probably wrong:
+// transactions without merchant or time, with an amount that is not positive or with coordinates out of range,
+// payments without time or with an amount that is not positive, accounts with a negative limit and accounts created
+// more than once. The problems of a record are returned together
+// in a *ValidationError. The formats returned by NewFormat with Options.Strict also reject the unknown fields
+func Strict(format Format) Format {
+	return func(r io.Reader) Decoder {
+		return &strictDecoder{decoder: format(r), accounts: map[int]int{}}
+	}
+}
+
+func (d *strictDecoder) Decode() (Request, error) {
+	req, err := d.decoder.Decode()
+
+	var validation *ValidationError
+	if err != nil && !errors.As(err, &validation) {
+		return req, err
+	}
+
+	var problems []string
+
+	switch req.Operation {
+	case OperationAccount:
+		problems = d.accountProblems(req)
+	case OperationTransaction:
+		problems = transactionProblems(req.ProcessTransaction)
+	case OperationPayment:
+		problems = paymentProblems(req.ProcessPayment)
+	}
+
+	if validation == nil && len(problems) == 0 {
+		return req, nil
+	}
+
+	if validation == nil {
+		validation = &ValidationError{}
+	}
+
+	validation.Problems = append(validation.Problems, problems...)
+
+	return req, validation
+}
+
+func (d *strictDecoder) accountProblems(req Request) []string {
+	if req.CreateAccount == nil {
+		return nil
+	}
+
+	var problems []string
+
+	account := req.CreateAccount.Account
+
+	if line, ok := d.accounts[account.Id]; ok {
+		problems = append(problems, fmt.Sprintf("account %d was already created in line %d", account.Id, line))
+	} else {
+		d.accounts[account.Id] = req.Line
+	}
+
+	if account.AvailableLimit < 0 {
+		problems = append(problems, "availableLimit is negative")
+	}
+
+	return problems
+}
+
+func transactionProblems(pt *service.ProcessTransaction) []string {
+	if pt == nil {
+		return nil
+	}
+
+	var problems []string
+
+	tx := pt.Transaction
+
+	if strings.TrimSpace(tx.Merchant) == "" {
+		problems = append(problems, "merchant is missing")
+	}
+
+	if model.IsReservedMerchant(tx.Merchant) {
+		problems = append(problems, fmt.Sprintf("merchant %s is reserved", tx.Merchant))
+	}
+
+	if tx.Amount <= 0 {
+		problems = append(problems, "amount must be greater than 0")
+	}
+
+	if tx.Time.IsZero() {
+		problems = append(problems, "time is missing")
+	}
+
+	c := tx.Coordinates
+	if c != nil && (c.Latitude < -90 || c.Latitude > 90 || c.Longitude < -180 || c.Longitude > 180) {
+		problems = append(problems, "coordinates are out of range")
+	}
+
+	return problems
+}
+
+func paymentProblems(pp *service.ProcessPayment) []string {
+	if pp == nil {
+		return nil
+	}
+
+	var problems []string
+
+	if pp.Payment.Amount <= 0 {
+		problems = append(problems, "amount must be greater than 0")
+	}
+
+	if pp.Payment.Time.IsZero() {
+		problems = append(problems, "time is missing")
+	}
+
+	return problems
+}
+
+// unknownFields returns the keys of the json object that are not fields of the type of v, with their path
+func unknownFields(line string, v interface{}) []string {
+	var unknown []string
+
+	collectUnknownFields(json.RawMessage(line), reflect.TypeOf(v), "", &unknown)
+
+	sort.Strings(unknown)
+
+	return unknown
+}
+
+// collectUnknownFields walks the json value with the type it is decoded to, values that can't be decoded
+// are not walked, they already fail the decoding
+func collectUnknownFields(raw json.RawMessage, t reflect.Type, path string, unknown *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if reflect.PtrTo(t).Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object := map[string]json.RawMessage{}
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return
+		}
+
+		for key, value := range object {
+			field, ok := jsonField(t, key)
+			if !ok {
+				*unknown = append(*unknown, path+key)
+
+				continue
+			}
+
+			collectUnknownFields(value, field.Type, path+key+".", unknown)
+		}
+	case reflect.Map:
+		object := map[string]json.RawMessage{}
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return
+		}
+
+		for key, value := range object {
+			collectUnknownFields(value, t.Elem(), path+key+".", unknown)
+		}
+	}
+}
+
+// jsonField returns the field of the struct decoded from the key, json matches the names without case
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		if strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
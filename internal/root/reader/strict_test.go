@@ -0,0 +1,126 @@
+package reader
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrict_ndjson(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		problems []string
+		err      error
+	}{
+		{"valid transaction",
+			`{"transaction": {"merchant": "Burger King", "amount": 20, "time": "2019-02-13T10:00:00.000Z"}}`, nil, nil},
+		{"valid labeled transaction",
+			`{"transaction": {"merchant": "Oxxo", "amount": 20, "time": "2019-02-13T10:00:00.000Z"}, "accountId": 3,` +
+				` "label": {"fraud": true}}`, nil, nil},
+		{"valid ruleSettings",
+			`{"ruleSettings": {"highFrequency": {"window": "5m", "threshold": 10}}, "requestId": "r1"}`, nil, nil},
+		{"unknown fields",
+			`{"transaction": {"merchant": "Burger King", "amount": 20, "time": "2019-02-13T10:00:00.000Z",` +
+				` "mcc": "5814", "coordinates": {"lat": 1, "long": 2, "alt": 3}}, "accountId": 2, "cardId": 7}`,
+			[]string{"unknown field cardId", "unknown field transaction.coordinates.alt",
+				"unknown field transaction.mcc"},
+			ErrInvalidInput},
+		{"unknown field of a rule override",
+			`{"ruleSettings": {"highFrequency": {"disable": true}}}`,
+			[]string{"unknown field ruleSettings.highFrequency.disable"},
+			ErrInvalidInput},
+		{"missing merchant, amount and time",
+			`{"transaction": {"merchant": " "}}`,
+			[]string{"merchant is missing", "amount must be greater than 0", "time is missing"},
+			ErrInvalidInput},
+		{"negative amount and coordinates out of range",
+			`{"transaction": {"merchant": "Oxxo", "amount": -5, "time": "2019-02-13T10:00:00.000Z",` +
+				` "coordinates": {"lat": 91, "long": 0}}}`,
+			[]string{"amount must be greater than 0", "coordinates are out of range"},
+			ErrInvalidInput},
+		{"unknown field and missing merchant",
+			`{"transaction": {"merchnt": "Oxxo", "amount": 5, "time": "2019-02-13T10:00:00.000Z"}}`,
+			[]string{"unknown field transaction.merchnt", "merchant is missing"},
+			ErrInvalidInput},
+		{"valid payment", `{"payment": {"amount": 20, "time": "2019-02-13T10:00:00.000Z"}, "accountId": 2}`, nil, nil},
+		{"payment without amount and time", `{"payment": {"amount": 0}}`,
+			[]string{"amount must be greater than 0", "time is missing"}, ErrInvalidInput},
+		{"reserved merchant", `{"transaction": {"merchant": "payment", "amount": 5, "time": "2019-02-13T10:00:00.000Z"}}`,
+			[]string{"merchant payment is reserved"}, ErrInvalidInput},
+		{"negative limit", `{"account": {"activeCard": true, "availableLimit": -1}}`,
+			[]string{"availableLimit is negative"}, ErrInvalidInput},
+		{"unparsable time", `{"transaction": {"merchant": "Oxxo", "amount": 5, "time": "yesterday"}}`,
+			nil, ErrInvalidInput},
+		{"not json", "abcde", nil, ErrUnknownOperation},
+	}
+
+	format, err := NewFormat(FormatNDJSON, Options{Strict: true})
+	assert.NoError(t, err)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := format(strings.NewReader(tt.line)).Decode()
+			if tt.err == nil {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			assert.True(t, errors.Is(err, tt.err), "got error %v, want %v", err, tt.err)
+
+			var validation *ValidationError
+			if errors.As(err, &validation) {
+				assert.Equal(t, tt.problems, validation.Problems)
+			} else {
+				assert.Nil(t, tt.problems)
+			}
+		})
+	}
+}
+
+func TestStrict_duplicateAccount(t *testing.T) {
+	input := `{"account": {"activeCard": true, "availableLimit": 100}}
+{"transaction": {"merchant": "Oxxo", "amount": 5, "time": "2019-02-13T10:00:00.000Z"}}
+{"account": {"activeCard": true, "availableLimit": 200}}
+`
+	decoder := Strict(NDJSON)(strings.NewReader(input))
+
+	for i := 0; i < 2; i++ {
+		_, err := decoder.Decode()
+		assert.NoError(t, err)
+	}
+
+	_, err := decoder.Decode()
+	assert.EqualError(t, err, "invalid input: account 1 was already created in line 1")
+
+	_, err = decoder.Decode()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestStrict_csv(t *testing.T) {
+	input := "operation,merchant,amount,time,reference\n" +
+		"transaction,Burger King,20,2019-02-13T10:00:00Z,a1\n" +
+		"transaction,,0,,a2\n"
+
+	format, err := NewFormat(FormatCSV, Options{Strict: true})
+	assert.NoError(t, err)
+
+	decoder := format(strings.NewReader(input))
+
+	req, err := decoder.Decode()
+	assert.EqualError(t, err, "invalid input: unknown column reference")
+	assert.Equal(t, 1, req.Line)
+
+	req, err = decoder.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, req.Line)
+
+	req, err = decoder.Decode()
+	assert.EqualError(t, err, "invalid input: merchant is missing; amount must be greater than 0; time is missing")
+	assert.Equal(t, 3, req.Line)
+}
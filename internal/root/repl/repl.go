@@ -0,0 +1,556 @@
+package repl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/app/service"
+	"authorizer/internal/app/snapshot"
+	cmd2 "authorizer/internal/root"
+	"authorizer/internal/root/reader"
+	"authorizer/internal/root/writer"
+)
+
+// Colors of the responses, they are only written when the session is colored
+const (
+	colorReset  = "\x1b[0m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorCyan   = "\x1b[36m"
+)
+
+const help = `Operations:
+  {"account": {...}} {"transaction": {...}} {"ruleSettings": {...}} {"payment": {...}}
+                                                                       the json lines of the stdin
+  account limit=1000 [active=true] [homeCountry=MX] [closingDay=10]    create the account, with a credit line
+                                                                       when closingDay is set
+  tx merchant=X amount=10 [account=1] [time=RFC3339] [country=MX] [lat=19.4 long=-99.1]
+                                                                       process a transaction, time is now by default
+  pay amount=10 [account=1] [time=RFC3339]                             pay the balance of the credit line
+                                                                       account is the id of the account, 1 by default
+Commands:
+  show account [id]       the account stored, 1 by default
+  history [id]            the transactions stored of the account
+  declined [id]           the declined attempts of the account with their violations
+  explain last            the result of every business rule for the last transaction
+  load <file>             execute the json lines of a file
+  load snapshot <file>    restore the accounts of a snapshot
+  save snapshot <file>    export the accounts to a snapshot
+  help                    this help
+  quit                    end the session
+`
+
+// ErrUnknownCommand is returned by Execute when the line is not an operation nor a command
+var ErrUnknownCommand = errors.New("unknown command, type help to see the commands")
+
+// Session executes the lines typed by an operator with a service that lives as long as the session,
+// the state can be inspected between the operations
+type Session struct {
+	auth    cmd2.Authorizer
+	storage snapshot.Storage
+	out     io.Writer
+	opts    []cmd2.Option
+	color   bool
+	// last is the response of the last transaction, its explanation is written by "explain last"
+	last *service.TransactionResponse
+	now  func() time.Time
+}
+
+// Option modifies the default configuration of the session
+type Option func(*Session)
+
+// WithColor writes the approved operations in green, the declined ones in red and the failures in yellow
+func WithColor(color bool) Option {
+	return func(s *Session) {
+		s.color = color
+	}
+}
+
+// WithExecuteOptions are used every time root.Execute is called, e.g. to audit the operations
+func WithExecuteOptions(opts ...cmd2.Option) Option {
+	return func(s *Session) {
+		s.opts = opts
+	}
+}
+
+// New creates a session that executes the operations with auth, storage must be the storage used by auth.
+// The explanation of the transactions is only written by "explain last", so auth should explain every decision
+func New(auth cmd2.Authorizer, storage snapshot.Storage, out io.Writer, opts ...Option) *Session {
+	s := &Session{
+		auth:    auth,
+		storage: storage,
+		out:     out,
+		now:     time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Run executes the lines of in until it ends or the quit command, the prompt is written before every line.
+// The errors of a line are written and the session continues
+func (s *Session) Run(in io.Reader, prompt string) error {
+	scanner := bufio.NewScanner(in)
+
+	for {
+		fmt.Fprint(s.out, prompt)
+
+		if !scanner.Scan() {
+			if prompt != "" {
+				fmt.Fprintln(s.out)
+			}
+
+			return scanner.Err()
+		}
+
+		quit, err := s.Execute(scanner.Text())
+		if err != nil {
+			fmt.Fprintln(s.out, s.paint(colorYellow, "error: "+err.Error()))
+		}
+
+		if quit {
+			return nil
+		}
+	}
+}
+
+// Execute executes a single line, quit is true when the session must end
+func (s *Session) Execute(line string) (quit bool, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return false, nil
+	}
+
+	if strings.HasPrefix(line, "{") {
+		return false, s.execute(strings.NewReader(line))
+	}
+
+	args, err := splitArgs(line)
+	if err != nil {
+		return false, err
+	}
+
+	switch args[0] {
+	case "quit", "exit":
+		return true, nil
+	case "help":
+		fmt.Fprint(s.out, help)
+
+		return false, nil
+	case "account", "tx", "transaction", "pay":
+		return false, s.shorthand(args[0], args[1:])
+	case "show":
+		if len(args) < 2 || args[1] != "account" || len(args) > 3 {
+			return false, errors.New("usage: show account [id]")
+		}
+
+		return false, s.showAccount(args[2:])
+	case "history":
+		return false, s.history(args[1:])
+	case "declined":
+		return false, s.declined(args[1:])
+	case "explain":
+		if len(args) != 2 || args[1] != "last" {
+			return false, errors.New("usage: explain last")
+		}
+
+		return false, s.explainLast()
+	case "load":
+		return false, s.load(args[1:])
+	case "save":
+		if len(args) != 3 || args[1] != "snapshot" {
+			return false, errors.New("usage: save snapshot <file>")
+		}
+
+		return false, snapshot.Export(s.storage, args[2])
+	default:
+		return false, ErrUnknownCommand
+	}
+}
+
+// execute executes the json lines and writes their responses, it fails when a response can't be written
+func (s *Session) execute(r io.Reader) error {
+	format := func(io.Writer, writer.Fields) writer.Encoder {
+		return &responseEncoder{session: s}
+	}
+
+	return cmd2.Execute(s.auth, r, s.out, append(s.opts, cmd2.WithOutputFormat(format, writer.Fields{}))...)
+}
+
+// shorthand executes "account key=value...", "tx key=value..." or "pay key=value..." as the json line of the operation
+func (s *Session) shorthand(operation string, args []string) error {
+	values := map[string]string{}
+
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("%q must be key=value", arg)
+		}
+
+		values[kv[0]] = kv[1]
+	}
+
+	var (
+		line interface{}
+		err  error
+	)
+
+	switch operation {
+	case "account":
+		line, err = accountLine(values)
+	case "pay":
+		var pp service.ProcessPayment
+
+		pp, err = s.paymentLine(values)
+		line = accountPayment{AccountID: pp.AccountID, ProcessPayment: pp}
+	default:
+		var pt service.ProcessTransaction
+
+		pt, err = s.transactionLine(values)
+		line = accountTransaction{AccountID: pt.AccountID, ProcessTransaction: pt}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+
+	return s.execute(strings.NewReader(string(b)))
+}
+
+// accountTransaction and accountPayment are the json lines of the shorthands, the account is the key accountId of
+// the line and not a field of the operation
+type accountTransaction struct {
+	AccountID int `json:"accountId,omitempty"`
+	service.ProcessTransaction
+}
+
+type accountPayment struct {
+	AccountID int `json:"accountId,omitempty"`
+	service.ProcessPayment
+}
+
+// shorthandAccountID parses the key account of tx and pay, the id must be a positive number as the accountId of
+// the json lines
+func shorthandAccountID(v string) (int, error) {
+	id, err := strconv.Atoi(v)
+	if err == nil && id <= 0 {
+		err = errors.New("the account id must be a positive number")
+	}
+
+	return id, err
+}
+
+func accountLine(values map[string]string) (service.CreateAccount, error) {
+	ca := service.CreateAccount{Account: model.Account{ActiveCard: true}}
+
+	var err error
+
+	for key, v := range values {
+		switch key {
+		case "limit", "availableLimit":
+			ca.Account.AvailableLimit, err = strconv.Atoi(v)
+		case "active", "activeCard":
+			ca.Account.ActiveCard, err = strconv.ParseBool(v)
+		case "homeCountry", "country":
+			ca.Account.HomeCountry = v
+		case "closingDay":
+			ca.Account.CreditLine = &model.CreditLine{}
+			ca.Account.CreditLine.ClosingDay, err = strconv.Atoi(v)
+		default:
+			return ca, fmt.Errorf("unknown field %s of account, it must be limit, active, homeCountry or closingDay", key)
+		}
+
+		if err != nil {
+			return ca, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	return ca, nil
+}
+
+func (s *Session) transactionLine(values map[string]string) (service.ProcessTransaction, error) {
+	pt := service.ProcessTransaction{Transaction: model.Transaction{Time: s.now().UTC()}}
+
+	var (
+		err         error
+		coordinates model.Coordinates
+	)
+
+	for key, v := range values {
+		switch key {
+		case "account":
+			pt.AccountID, err = shorthandAccountID(v)
+		case "merchant":
+			pt.Transaction.Merchant = v
+		case "amount":
+			pt.Transaction.Amount, err = strconv.Atoi(v)
+		case "time":
+			pt.Transaction.Time, err = time.Parse(time.RFC3339, v)
+		case "country":
+			pt.Transaction.Country = v
+		case "lat":
+			coordinates.Latitude, err = strconv.ParseFloat(v, 64)
+			pt.Transaction.Coordinates = &coordinates
+		case "long":
+			coordinates.Longitude, err = strconv.ParseFloat(v, 64)
+			pt.Transaction.Coordinates = &coordinates
+		default:
+			return pt, fmt.Errorf("unknown field %s of transaction, "+
+				"it must be account, merchant, amount, time, country, lat or long", key)
+		}
+
+		if err != nil {
+			return pt, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	return pt, nil
+}
+
+func (s *Session) paymentLine(values map[string]string) (service.ProcessPayment, error) {
+	pp := service.ProcessPayment{Payment: model.Payment{Time: s.now().UTC()}}
+
+	var err error
+
+	for key, v := range values {
+		switch key {
+		case "account":
+			pp.AccountID, err = shorthandAccountID(v)
+		case "amount":
+			pp.Payment.Amount, err = strconv.Atoi(v)
+		case "time":
+			pp.Payment.Time, err = time.Parse(time.RFC3339, v)
+		default:
+			return pp, fmt.Errorf("unknown field %s of payment, it must be account, amount or time", key)
+		}
+
+		if err != nil {
+			return pp, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	return pp, nil
+}
+
+func (s *Session) showAccount(args []string) error {
+	id, err := accountID(args)
+	if err != nil {
+		return err
+	}
+
+	account := s.storage.GetAccount(id)
+	if account.Version == 0 {
+		return fmt.Errorf("account %d doesn't exist", id)
+	}
+
+	return s.writeJSON(colorCyan, account)
+}
+
+func (s *Session) history(args []string) error {
+	id, err := accountID(args)
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range s.storage.GetTransactions(id) {
+		fmt.Fprintf(s.out, "%s  %-20s %8d  %s\n", tx.Time.Format(time.RFC3339), tx.Merchant, tx.Amount, tx.Country)
+	}
+
+	return nil
+}
+
+func (s *Session) declined(args []string) error {
+	id, err := accountID(args)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range s.storage.GetDeclined(id) {
+		fmt.Fprintf(s.out, "%s  %-20s %8d  %s\n", d.Time.Format(time.RFC3339), d.Merchant, d.Amount,
+			s.paint(colorRed, strings.Join(d.Violations, ",")))
+	}
+
+	return nil
+}
+
+func (s *Session) explainLast() error {
+	if s.last == nil {
+		return errors.New("no transaction was processed in this session")
+	}
+
+	for _, trace := range s.last.Explanation {
+		switch {
+		case trace.Skipped:
+			fmt.Fprintf(s.out, "%s %s\n", s.paint(colorCyan, "skipped"), trace.Rule)
+		case trace.Passed:
+			fmt.Fprintf(s.out, "%s  %s\n", s.paint(colorGreen, "passed"), trace.Rule)
+		default:
+			fmt.Fprintf(s.out, "%s  %s: %s\n", s.paint(colorRed, "failed"), trace.Rule, trace.Violation)
+		}
+
+		for _, name := range sortedKeys(trace.Parameters) {
+			fmt.Fprintf(s.out, "        %s=%s\n", name, trace.Parameters[name])
+		}
+
+		for _, c := range trace.Conflicts {
+			fmt.Fprintf(s.out, "        conflicts with %s %d at %s\n", c.Merchant, c.Amount, c.Time.Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
+
+// load executes "load <file>" and "load snapshot <file>"
+func (s *Session) load(args []string) error {
+	switch {
+	case len(args) == 2 && args[0] == "snapshot":
+		if err := snapshot.Import(s.storage, args[1]); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(s.out, "%d accounts restored\n", len(s.storage.Accounts()))
+
+		return nil
+	case len(args) == 1:
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return s.execute(f)
+	default:
+		return errors.New("usage: load <file> or load snapshot <file>")
+	}
+}
+
+func (s *Session) writeJSON(color string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(s.out, s.paint(color, string(b)))
+
+	return nil
+}
+
+func (s *Session) paint(color, text string) string {
+	if !s.color {
+		return text
+	}
+
+	return color + text + colorReset
+}
+
+// responseEncoder writes the responses of root.Execute with the color of their outcome,
+// the explanation is kept for "explain last" instead of being written
+type responseEncoder struct {
+	session *Session
+}
+
+func (e *responseEncoder) Encode(r writer.Record) error {
+	s := e.session
+	response := r.Response
+
+	if r.Operation == reader.OperationTransaction && r.Failure == "" {
+		last := response
+		s.last = &last
+	}
+
+	response.Explanation = nil
+
+	color := colorGreen
+
+	switch {
+	case r.Failure != "":
+		color = colorYellow
+	case len(response.Violations) > 0:
+		color = colorRed
+	}
+
+	return s.writeJSON(color, response)
+}
+
+func (e *responseEncoder) Flush() error {
+	return nil
+}
+
+func accountID(args []string) (int, error) {
+	if len(args) == 0 {
+		return 1, nil
+	}
+
+	if len(args) > 1 {
+		return 0, errors.New("only one account id is expected")
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid account id %q", args[0])
+	}
+
+	return id, nil
+}
+
+// splitArgs splits the line by spaces, a value can contain spaces between double quotes: merchant="Burger King"
+func splitArgs(line string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		quoted  bool
+	)
+
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if current.Len() > 0 {
+				args = append(args, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+
+	if current.Len() > 0 {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,183 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/service"
+	"authorizer/internal/app/storage"
+)
+
+func newSession(opts ...Option) (*Session, *bytes.Buffer) {
+	out := new(bytes.Buffer)
+	db := &storage.InMemory{}
+	s := New(service.New(db, service.WithExplain(true)), db, out, opts...)
+	s.now = func() time.Time { return time.Date(2019, 2, 13, 10, 0, 0, 0, time.UTC) }
+
+	return s, out
+}
+
+func TestSession_Execute(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		want    string
+		wantErr string
+	}{
+		{"json line",
+			[]string{`{"account": {"activeCard": true, "availableLimit": 100}}`},
+			`{"account":{"activeCard":true,"availableLimit":100},"violations":[]}` + "\n",
+			""},
+		{"shorthand",
+			[]string{"account limit=100 homeCountry=MX", `tx merchant="Burger King" amount=20 country=MX`},
+			`{"account":{"activeCard":true,"availableLimit":100,"homeCountry":"MX"},"violations":[]}` + "\n" +
+				`{"account":{"activeCard":true,"availableLimit":80,"homeCountry":"MX"},"violations":[],` +
+				`"ruleSetVersion":"default"}` + "\n",
+			""},
+		{"declined",
+			[]string{"tx merchant=Oxxo amount=20"},
+			`{"account":{"activeCard":false,"availableLimit":0},"violations":["card-not-active"],` +
+				`"ruleSetVersion":"default"}` + "\n",
+			""},
+		{"show account",
+			[]string{"account limit=100", "show account 1"},
+			`{"account":{"activeCard":true,"availableLimit":100},"violations":[]}` + "\n" +
+				`{"activeCard":true,"availableLimit":100}` + "\n",
+			""},
+		{"history",
+			[]string{"account limit=100", "tx merchant=Oxxo amount=20", "history"},
+			"  initial                   100  \n2019-02-13T10:00:00Z  Oxxo                       20  \n",
+			""},
+		{"declined attempts",
+			[]string{"account limit=100", "tx merchant=Oxxo amount=200", "declined"},
+			"2019-02-13T10:00:00Z  Oxxo                      200  insufficient-limit\n",
+			""},
+		{"credit line",
+			[]string{"account limit=100 closingDay=10", "tx merchant=Oxxo amount=40", "pay amount=30"},
+			`{"account":{"activeCard":true,"availableLimit":90,"creditLine":{"limit":100,"closingDay":10,"dueDays":20,` +
+				`"minimumPaymentPercent":0,"nextClose":"2019-03-10T00:00:00Z"}},"violations":[]}` + "\n",
+			""},
+		{"other account",
+			[]string{"account limit=100", `{"accountId": 2, "account": {"activeCard": true, "availableLimit": 50}}`,
+				"tx merchant=Oxxo amount=20 account=2", "history 2", "show account 1"},
+			"2019-02-13T10:00:00Z  Oxxo                       20  \n" +
+				`{"activeCard":true,"availableLimit":100}` + "\n",
+			""},
+		{"payment of other account",
+			[]string{`{"accountId": 2, "account": {"activeCard": true, "availableLimit": 100, "creditLine": ` +
+				`{"closingDay": 10}}}`, "tx merchant=Oxxo amount=40 account=2", "pay amount=30 account=2"},
+			`{"account":{"activeCard":true,"availableLimit":90,"creditLine":{"limit":100,"closingDay":10,"dueDays":20,` +
+				`"minimumPaymentPercent":0,"nextClose":"2019-03-10T00:00:00Z"}},"violations":[]}` + "\n",
+			""},
+		{"invalid account", []string{"tx merchant=Oxxo amount=20 account=0"}, "",
+			"account: the account id must be a positive number"},
+		{"unknown line", []string{"deposit amount=10"}, "", "unknown command"},
+		{"invalid json", []string{`{"transaction": {"amount": "ten"}}`}, `"violations":["invalid-input"]`, ""},
+		{"invalid shorthand", []string{"tx merchant=Oxxo amount=ten"}, "", "amount: strconv.Atoi"},
+		{"unknown field", []string{"tx mcc=5814"}, "", "unknown field mcc of transaction"},
+		{"unknown field of payment", []string{"pay merchant=Oxxo"}, "", "unknown field merchant of payment"},
+		{"missing account", []string{"show account 2"}, "", "account 2 doesn't exist"},
+		{"explain without transactions", []string{"explain last"}, "", "no transaction was processed"},
+		{"unterminated quote", []string{`tx merchant="Burger King amount=20`}, "", "unterminated quote"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s, out := newSession()
+
+			var err error
+
+			for _, line := range tt.lines {
+				var quit bool
+
+				quit, err = s.Execute(line)
+				assert.False(t, quit)
+			}
+
+			if tt.wantErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+
+				return
+			}
+
+			assert.NoError(t, err)
+
+			assert.Contains(t, out.String(), tt.want)
+		})
+	}
+}
+
+func TestSession_explainLast(t *testing.T) {
+	s, out := newSession(WithColor(true))
+
+	for _, line := range []string{"account limit=100", "tx merchant=Oxxo amount=20", "tx merchant=Oxxo amount=20"} {
+		_, err := s.Execute(line)
+		assert.NoError(t, err)
+	}
+
+	// the explanation is not written with the response
+	assert.NotContains(t, out.String(), "explanation")
+	assert.Contains(t, out.String(), colorRed+`{"account":{"activeCard":true,"availableLimit":80},`+
+		`"violations":["doubled-transaction"],"ruleSetVersion":"default"}`+colorReset)
+
+	out.Reset()
+
+	_, err := s.Execute("explain last")
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), colorGreen+"passed"+colorReset+"  isActive\n")
+	assert.Contains(t, out.String(), colorRed+"failed"+colorReset+"  doubleTransaction: doubled-transaction\n")
+	assert.Contains(t, out.String(), "conflicts with Oxxo 20 at 2019-02-13T10:00:00Z\n")
+}
+
+func TestSession_load(t *testing.T) {
+	dir := t.TempDir()
+	operations := filepath.Join(dir, "operations")
+	assert.NoError(t, os.WriteFile(operations, []byte(`{"account": {"activeCard": true, "availableLimit": 100}}
+{"transaction": {"merchant": "Oxxo", "amount": 20, "time": "2019-02-13T10:00:00.000Z"}}
+`), 0600))
+
+	s, out := newSession()
+
+	_, err := s.Execute("load " + operations)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(out.String(), "\n"))
+
+	snapshotPath := filepath.Join(dir, "state.json")
+	_, err = s.Execute("save snapshot " + snapshotPath)
+	assert.NoError(t, err)
+
+	restored, out := newSession()
+
+	_, err = restored.Execute("load snapshot " + snapshotPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "1 accounts restored\n", out.String())
+
+	out.Reset()
+
+	_, err = restored.Execute("show account")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"activeCard":true,"availableLimit":80}`+"\n", out.String())
+
+	_, err = restored.Execute("load snapshot " + snapshotPath)
+	assert.Error(t, err)
+
+	_, err = restored.Execute("load")
+	assert.EqualError(t, err, "usage: load <file> or load snapshot <file>")
+}
+
+func TestSession_Run(t *testing.T) {
+	s, out := newSession()
+
+	input := "account limit=100\nfoo\nquit\nshow account\n"
+	assert.NoError(t, s.Run(strings.NewReader(input), "> "))
+	assert.Equal(t, `> {"account":{"activeCard":true,"availableLimit":100},"violations":[]}`+"\n"+
+		"> error: unknown command, type help to see the commands\n> ", out.String())
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"authorizer/internal/app/model"
+)
+
+// Report is the summary of the lines processed by Execute
+type Report struct {
+	Lines    int `json:"lines"`
+	Approved int `json:"approved"`
+	Declined int `json:"declined"`
+	// DeclinedByViolation counts the declined operations by their first violation
+	DeclinedByViolation map[string]int `json:"declinedByViolation"`
+	// ParseErrors are the lines that couldn't be read, either unknown commands or invalid json
+	ParseErrors int `json:"parseErrors"`
+	// Errors are the operations that failed in the service, e.g. the storage failed, they are neither approved
+	// nor declined
+	Errors         int `json:"errors"`
+	ApprovedAmount int `json:"approvedAmount"`
+	// Balances is the final available limit of every account that appeared in a response
+	Balances       map[int]int    `json:"balances"`
+	ProcessingTime model.Duration `json:"processingTime"`
+}
+
+// NewReport creates an empty report
+func NewReport() *Report {
+	return &Report{
+		DeclinedByViolation: map[string]int{},
+		Balances:            map[int]int{},
+	}
+}
+
+func (r *Report) add(res result) {
+	r.Lines++
+
+	if res.failure != "" {
+		r.ParseErrors++
+
+		return
+	}
+
+	if res.err != nil {
+		r.Errors++
+
+		return
+	}
+
+	if len(res.response.Violations) > 0 {
+		r.Declined++
+		r.DeclinedByViolation[res.response.Violations[0]]++
+	} else {
+		r.Approved++
+		r.ApprovedAmount += res.amount
+	}
+
+	if res.response.Account.Id != 0 {
+		r.Balances[res.response.Account.Id] = res.response.Account.AvailableLimit
+	}
+}
+
+// Write writes the report as "json" or as a "table"
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(r)
+	case "table":
+		return r.writeTable(w)
+	default:
+		return fmt.Errorf("unknown report format %q, it must be json or table", format)
+	}
+}
+
+func (r *Report) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	rows := [][2]string{
+		{"lines", strconv.Itoa(r.Lines)},
+		{"approved", strconv.Itoa(r.Approved)},
+		{"declined", strconv.Itoa(r.Declined)},
+	}
+
+	violations := make([]string, 0, len(r.DeclinedByViolation))
+	for violation := range r.DeclinedByViolation {
+		violations = append(violations, violation)
+	}
+
+	sort.Strings(violations)
+
+	for _, violation := range violations {
+		rows = append(rows, [2]string{"  " + violation, strconv.Itoa(r.DeclinedByViolation[violation])})
+	}
+
+	rows = append(rows,
+		[2]string{"parse errors", strconv.Itoa(r.ParseErrors)},
+		[2]string{"errors", strconv.Itoa(r.Errors)},
+		[2]string{"approved amount", strconv.Itoa(r.ApprovedAmount)},
+	)
+
+	accounts := make([]int, 0, len(r.Balances))
+	for account := range r.Balances {
+		accounts = append(accounts, account)
+	}
+
+	sort.Ints(accounts)
+
+	for _, account := range accounts {
+		rows = append(rows, [2]string{"balance account " + strconv.Itoa(account), strconv.Itoa(r.Balances[account])})
+	}
+
+	rows = append(rows, [2]string{"processing time", r.ProcessingTime.String()})
+
+	for _, row := range rows {
+		if _, err := fmt.Fprintf(tw, "%s\t%s\n", row[0], row[1]); err != nil {
+			return err
+		}
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/service"
+	"authorizer/internal/app/storage"
+	"authorizer/internal/app/violations"
+)
+
+func TestExecute_withReport(t *testing.T) {
+	input := strings.Join([]string{
+		`{"account": {"activeCard": true, "availableLimit": 100}}`,
+		`{"transaction": {"merchant": "Burger King", "amount": 20, "time": "2019-02-13T10:00:00.000Z"}}`,
+		`{"transaction": {"merchant": "Habbib's", "amount": 90, "time": "2019-02-13T11:00:00.000Z"}}`,
+		`{"transaction": {"merchant": "McDonald's", "amount": 30, "time": "2019-02-13T12:00:00.000Z"}}`,
+		`{"transaction": {"merchant": "McDonald's", "amount": `,
+		`{"deposit": {"amount": 10}}`,
+		`{"account": {"activeCard": true, "availableLimit": 350}}`,
+	}, "\n")
+
+	report := NewReport()
+	out := bytes.Buffer{}
+	Execute(service.New(&storage.InMemory{}), strings.NewReader(input), &out, WithReport(report))
+
+	assert.Equal(t, 7, report.Lines)
+	assert.Equal(t, 3, report.Approved)
+	assert.Equal(t, 2, report.Declined)
+	assert.Equal(t, map[string]int{
+		violations.ViolationInsufficientLimit:    1,
+		violations.ViolationAccountAlreadyExists: 1,
+	}, report.DeclinedByViolation)
+	assert.Equal(t, 2, report.ParseErrors)
+	assert.Equal(t, 50, report.ApprovedAmount)
+	assert.Equal(t, map[int]int{1: 50}, report.Balances)
+	assert.Greater(t, int64(report.ProcessingTime.Duration), int64(0))
+	assert.Contains(t, out.String(), invalidInput)
+}
+
+// failingAuthorizer fails every transaction, like a service whose storage is unavailable
+type failingAuthorizer struct {
+	*service.Service
+}
+
+func (failingAuthorizer) ProcessTransaction(pt service.ProcessTransaction) (service.TransactionResponse, error) {
+	return service.TransactionResponse{Violations: []string{}}, errors.New("storage unavailable")
+}
+
+func TestExecute_withReportErrors(t *testing.T) {
+	input := `{"account": {"activeCard": true, "availableLimit": 100}}
+{"transaction": {"merchant": "Burger King", "amount": 20, "time": "2019-02-13T10:00:00.000Z"}}
+`
+	report := NewReport()
+	auth := failingAuthorizer{service.New(&storage.InMemory{})}
+
+	assert.NoError(t, Execute(auth, strings.NewReader(input), &bytes.Buffer{}, WithReport(report)))
+	assert.Equal(t, 2, report.Lines)
+	assert.Equal(t, 1, report.Approved)
+	assert.Equal(t, 1, report.Errors)
+	assert.Equal(t, 0, report.ApprovedAmount)
+	assert.Equal(t, map[int]int{1: 100}, report.Balances)
+}
+
+func TestReport_Write(t *testing.T) {
+	report := NewReport()
+	report.Lines = 4
+	report.Approved = 2
+	report.Declined = 1
+	report.DeclinedByViolation[violations.ViolationInsufficientLimit] = 1
+	report.ParseErrors = 1
+	report.ApprovedAmount = 30
+	report.Balances[1] = 70
+
+	t.Run("json", func(t *testing.T) {
+		out := bytes.Buffer{}
+		assert.NoError(t, report.Write(&out, "json"))
+
+		decoded := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+		assert.Equal(t, float64(4), decoded["lines"])
+		assert.Equal(t, map[string]interface{}{"1": float64(70)}, decoded["balances"])
+		assert.Equal(t, "0s", decoded["processingTime"])
+	})
+
+	t.Run("table", func(t *testing.T) {
+		out := bytes.Buffer{}
+		assert.NoError(t, report.Write(&out, "table"))
+		assert.Equal(t, "lines                 4\n"+
+			"approved              2\n"+
+			"declined              1\n"+
+			"  insufficient-limit  1\n"+
+			"parse errors          1\n"+
+			"errors                0\n"+
+			"approved amount       30\n"+
+			"balance account 1     70\n"+
+			"processing time       0s\n", out.String())
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		assert.Error(t, report.Write(&bytes.Buffer{}, "xml"))
+	})
+}
@@ -2,71 +2,245 @@ package cmd
 
 import (
 	reader3 "authorizer/internal/root/reader"
-	"bufio"
-	"encoding/json"
+	writer3 "authorizer/internal/root/writer"
+	"errors"
 	"fmt"
 	"io"
-	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 
+	"authorizer/internal/app/audit"
 	"authorizer/internal/app/service"
 )
 
-const createAccount = "account"
-const processTransaction = "transaction"
+const unknownCommand = "unknown-command"
+const invalidInput = "invalid-input"
 
 // Authorizer is the interface of the service with the basic operations createAccount and processTransaction
 type Authorizer interface {
 	CreateAccount(ca service.CreateAccount) (response service.TransactionResponse, err error)
 	ProcessTransaction(pt service.ProcessTransaction) (response service.TransactionResponse, err error)
+	SetRuleSettings(rs service.SetRuleSettings) (response service.TransactionResponse, err error)
+	ProcessPayment(pp service.ProcessPayment) (response service.TransactionResponse, err error)
 }
 
-// Execute is the function that controls the flow of the application getting the lines from the stdin
-// and executing the operation related to the json received
-func Execute(auth Authorizer, reader io.Reader, writer io.Writer) {
-	scanner := bufio.NewScanner(reader)
+// Auditor records every decision taken by the Authorizer
+type Auditor interface {
+	Append(e audit.Entry) error
+}
 
-	for scanner.Scan() {
-		var response []byte
+// Option modifies how Execute processes the lines
+type Option func(*options)
 
-		line := scanner.Text()
+type options struct {
+	auditor Auditor
+	report  *Report
+	format  reader3.Format
+	output  writer3.Format
+	fields  writer3.Fields
+}
 
-		switch {
-		case strings.Contains(line, createAccount):
-			createAccount := reader3.ReadCreateAccount(line)
+// WithAuditor records every line received and its response in the auditor,
+// if a record can't be written Execute stops and returns the error, no decision can be taken without being audited
+func WithAuditor(auditor Auditor) Option {
+	return func(o *options) {
+		o.auditor = auditor
+	}
+}
 
-			createAccountResponse, err := auth.CreateAccount(*createAccount)
-			if err != nil {
-				log.Errorf("error creating account: %+v", err)
-			}
+// WithInputFormat reads the input with the format instead of ndjson
+func WithInputFormat(format reader3.Format) Option {
+	return func(o *options) {
+		o.format = format
+	}
+}
 
-			response, err = json.Marshal(createAccountResponse)
-			if err != nil {
-				log.Fatalf("error marshaling response: %+v", err)
+// WithOutputFormat writes the responses with the format instead of ndjson, adding the enrichment fields
+func WithOutputFormat(format writer3.Format, fields writer3.Fields) Option {
+	return func(o *options) {
+		o.output = format
+		o.fields = fields
+	}
+}
+
+// WithReport adds the result of every line to the report
+func WithReport(report *Report) Option {
+	return func(o *options) {
+		o.report = report
+	}
+}
 
-				continue
+// result is the outcome of a single line
+type result struct {
+	operation string
+	response  service.TransactionResponse
+	requestID string
+	// amount of the transaction, it is 0 for other operations
+	amount int
+	// failure is unknownCommand or invalidInput when the line couldn't be executed
+	failure string
+	// err is the error of the service when the operation couldn't be completed, e.g. the storage failed
+	err error
+}
+
+// Execute is the function that controls the flow of the application getting the lines from the stdin
+// and executing the operation of every record, read as ndjson unless WithInputFormat is used.
+// When a response or an audit record can't be written the rest of the input is not read and the error is returned
+func Execute(auth Authorizer, reader io.Reader, writer io.Writer, opts ...Option) error {
+	o := options{format: reader3.NDJSON, output: writer3.NDJSON}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	start := time.Now()
+	decoder := o.format(reader)
+	encoder := o.output(writer, o.fields)
+
+	var execErr error
+
+	for {
+		req, err := decoder.Decode()
+		if err != nil && !errors.Is(err, reader3.ErrInvalidInput) && !errors.Is(err, reader3.ErrUnknownOperation) {
+			if !errors.Is(err, io.EOF) {
+				log.Errorf("error reading input: %+v", err)
 			}
 
-		case strings.Contains(line, processTransaction):
-			processTransaction := reader3.ReadProcessTransaction(line)
+			break
+		}
+
+		r := execute(auth, req, err)
+		if r.failure != "" {
+			r.response.Violations = []string{r.failure}
+		}
 
-			responseTransaction, err := auth.ProcessTransaction(*processTransaction)
-			if err != nil {
-				log.Errorf("error processing transaction: %+v", err)
+		if o.auditor != nil {
+			entry := audit.Entry{
+				Input:          req.Input,
+				Operation:      r.operation,
+				AccountID:      r.response.Account.Id,
+				Violations:     r.response.Violations,
+				AvailableLimit: r.response.Account.AvailableLimit,
 			}
 
-			response, err = json.Marshal(responseTransaction)
-			if err != nil {
-				log.Fatalf("error marshaling response: %+v", err)
+			if err := o.auditor.Append(entry); err != nil {
+				log.Errorf("error writing audit record: %+v", err)
 
-				continue
+				execErr = fmt.Errorf("error writing audit record: %w", err)
+
+				break
 			}
+		}
 
-		default:
-			response = []byte("unknown-command")
+		if o.report != nil {
+			o.report.add(r)
 		}
 
-		fmt.Fprintf(writer, "%s\n", string(response))
+		record := writer3.Record{
+			Line:        req.Line,
+			RequestID:   r.requestID,
+			Operation:   r.operation,
+			ProcessedAt: time.Now().UTC(),
+			Response:    r.response,
+			Failure:     r.failure,
+		}
+
+		if err := encoder.Encode(record); err != nil {
+			log.Errorf("error writing response: %+v", err)
+
+			execErr = fmt.Errorf("error writing response: %w", err)
+
+			break
+		}
+	}
+
+	if err := encoder.Flush(); err != nil && execErr == nil {
+		log.Errorf("error writing responses: %+v", err)
+
+		execErr = fmt.Errorf("error writing responses: %w", err)
 	}
+
+	if o.report != nil {
+		o.report.ProcessingTime.Duration += time.Since(start)
+	}
+
+	return execErr
+}
+
+// execute calls the operation of the request decoded, err is the error returned by the decoder
+func execute(auth Authorizer, req reader3.Request, err error) result {
+	if err != nil {
+		log.Errorf("error reading input: %+v", err)
+
+		if errors.Is(err, reader3.ErrInvalidInput) {
+			return result{operation: req.Operation, failure: invalidInput}
+		}
+
+		return result{operation: unknownCommand, failure: unknownCommand}
+	}
+
+	switch req.Operation {
+	case reader3.OperationAccount:
+		createAccountRequest := req.CreateAccount
+		createAccountRequest.RequestID = requestID(createAccountRequest.RequestID)
+
+		response, err := auth.CreateAccount(*createAccountRequest)
+		if err != nil {
+			log.WithField("requestId", createAccountRequest.RequestID).Errorf("error creating account: %+v", err)
+		}
+
+		return result{operation: req.Operation, response: response, requestID: createAccountRequest.RequestID, err: err}
+
+	case reader3.OperationRuleSettings:
+		setRuleSettingsRequest := req.SetRuleSettings
+		setRuleSettingsRequest.RequestID = requestID(setRuleSettingsRequest.RequestID)
+
+		response, err := auth.SetRuleSettings(*setRuleSettingsRequest)
+		if err != nil {
+			log.WithField("requestId", setRuleSettingsRequest.RequestID).Errorf("error setting rule settings: %+v", err)
+		}
+
+		return result{operation: req.Operation, response: response, requestID: setRuleSettingsRequest.RequestID, err: err}
+
+	case reader3.OperationPayment:
+		processPaymentRequest := req.ProcessPayment
+		processPaymentRequest.RequestID = requestID(processPaymentRequest.RequestID)
+
+		response, err := auth.ProcessPayment(*processPaymentRequest)
+		if err != nil {
+			log.WithField("requestId", processPaymentRequest.RequestID).Errorf("error processing payment: %+v", err)
+		}
+
+		return result{operation: req.Operation, response: response, requestID: processPaymentRequest.RequestID, err: err}
+
+	case reader3.OperationTransaction:
+		processTransactionRequest := req.ProcessTransaction
+		processTransactionRequest.RequestID = requestID(processTransactionRequest.RequestID)
+
+		response, err := auth.ProcessTransaction(*processTransactionRequest)
+		if err != nil {
+			log.WithField("requestId", processTransactionRequest.RequestID).Errorf("error processing transaction: %+v", err)
+		}
+
+		return result{
+			operation: req.Operation,
+			response:  response,
+			requestID: processTransactionRequest.RequestID,
+			amount:    processTransactionRequest.Transaction.Amount,
+			err:       err,
+		}
+
+	default:
+		return result{operation: unknownCommand, failure: unknownCommand}
+	}
+}
+
+// requestID keeps the request id received in the input or generates a new one
+func requestID(received string) string {
+	if received != "" {
+		return received
+	}
+
+	return uuid.New().String()
 }
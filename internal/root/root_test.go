@@ -2,15 +2,19 @@ package cmd
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"authorizer/internal/app/audit"
 	"authorizer/internal/app/model"
 	"authorizer/internal/app/service"
 	"authorizer/internal/app/violations"
+	"authorizer/internal/root/reader"
+	"authorizer/internal/root/writer"
 )
 
 type MockAuthorizer struct {
@@ -62,6 +66,33 @@ func (m *MockAuthorizer) ProcessTransaction(pt service.ProcessTransaction) (
 	return service.TransactionResponse{Account: account, Violations: []string{}}, nil
 }
 
+func (m *MockAuthorizer) SetRuleSettings(rs service.SetRuleSettings) (
+	response service.TransactionResponse,
+	err error,
+) {
+	account := model.Account{
+		Id:             1,
+		ActiveCard:     true,
+		AvailableLimit: 10,
+		RuleSettings:   rs.RuleSettings,
+	}
+
+	return service.TransactionResponse{Account: account, Violations: []string{}}, nil
+}
+
+func (m *MockAuthorizer) ProcessPayment(pp service.ProcessPayment) (
+	response service.TransactionResponse,
+	err error,
+) {
+	account := model.Account{
+		Id:             1,
+		ActiveCard:     true,
+		AvailableLimit: 10 + pp.Payment.Amount,
+	}
+
+	return service.TransactionResponse{Account: account, Violations: []string{}}, nil
+}
+
 func TestExecute(t *testing.T) {
 	type args struct {
 		auth   Authorizer
@@ -108,6 +139,21 @@ func TestExecute(t *testing.T) {
 			"{\"account\":{\"activeCard\":true,\"availableLimit\":10},\"violations\":[]}\n" +
 				"{\"account\":{\"activeCard\":false,\"availableLimit\":0},\"violations\":[\"account-already-initialized\"]}\n" +
 				"{\"account\":{\"activeCard\":true,\"availableLimit\":100},\"violations\":[]}\n"},
+		{"setRuleSettings",
+			new(bytes.Buffer),
+			args{
+				auth:   &MockAuthorizer{},
+				reader: strings.NewReader("{\"ruleSettings\": { \"highFrequency\": { \"disabled\": true } } }"),
+			},
+			"{\"account\":{\"activeCard\":true,\"availableLimit\":10," +
+				"\"ruleSettings\":{\"highFrequency\":{\"disabled\":true}}},\"violations\":[]}\n"},
+		{"payment",
+			new(bytes.Buffer),
+			args{
+				auth:   &MockAuthorizer{},
+				reader: strings.NewReader("{\"payment\": { \"amount\": 5, \"time\": \"2019-02-13T11:00:00.000Z\" } }"),
+			},
+			"{\"account\":{\"activeCard\":true,\"availableLimit\":15},\"violations\":[]}\n"},
 	}
 
 	for _, tt := range tests {
@@ -117,3 +163,123 @@ func TestExecute(t *testing.T) {
 		})
 	}
 }
+
+type mockAuditor struct {
+	entries []audit.Entry
+}
+
+func (m *mockAuditor) Append(e audit.Entry) error {
+	m.entries = append(m.entries, e)
+
+	return nil
+}
+
+func TestExecute_withAuditor(t *testing.T) {
+	auditor := &mockAuditor{}
+	input := "{\"account\": { \"activeCard\": true, \"availableLimit\": 10 } }\n" +
+		"abcde\n" +
+		"{ \"transaction\": { \"merchant\": \"Habbib's\", \"amount\": 90, \"time\": \"2019-02-13T11:00:00.000Z\" } }\n"
+
+	err := Execute(&MockAuthorizer{}, strings.NewReader(input), new(bytes.Buffer), WithAuditor(auditor))
+	assert.NoError(t, err)
+
+	lines := strings.Split(input, "\n")
+	want := []audit.Entry{
+		{Input: lines[0], Operation: "account", AccountID: 1, Violations: []string{}, AvailableLimit: 10},
+		{Input: lines[1], Operation: "unknown-command", Violations: []string{"unknown-command"}},
+		{Input: lines[2], Operation: "transaction", AccountID: 1, Violations: []string{}, AvailableLimit: 100},
+	}
+
+	assert.Equal(t, want, auditor.entries)
+}
+
+func TestExecute_operationDetectedFromStructure(t *testing.T) {
+	auth := &recordingAuthorizer{}
+	input := "{ \"transaction\": { \"merchant\": \"Savings account\", \"amount\": 90, " +
+		"\"time\": \"2019-02-13T11:00:00.000Z\" } }\n" +
+		"{ \"transaction\": { \"merchant\": \"Savings account\", \"amount\": \n"
+	out := new(bytes.Buffer)
+
+	Execute(auth, strings.NewReader(input), out)
+
+	assert.Equal(t, []string{"Savings account"}, auth.merchants)
+	assert.Equal(t, "{\"account\":{\"activeCard\":false,\"availableLimit\":0},\"violations\":null}\n"+
+		"invalid-input\n", out.String())
+}
+
+func TestExecute_withInputFormat(t *testing.T) {
+	auth := &recordingAuthorizer{}
+	input := "merchant,amount,time\nSavings account,90,2019-02-13T11:00:00Z\n"
+
+	Execute(auth, strings.NewReader(input), new(bytes.Buffer), WithInputFormat(reader.CSV(nil)))
+
+	assert.Equal(t, []string{"Savings account"}, auth.merchants)
+}
+
+// brokenWriter fails every write, like the connection of a client that is gone
+type brokenWriter struct{}
+
+func (brokenWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("connection reset by peer")
+}
+
+func TestExecute_writeError(t *testing.T) {
+	auth := &recordingAuthorizer{}
+	input := "{ \"transaction\": { \"merchant\": \"Oxxo\", \"amount\": 10, \"time\": \"2019-02-13T11:00:00.000Z\" } }\n" +
+		"{ \"transaction\": { \"merchant\": \"Walmart\", \"amount\": 10, \"time\": \"2019-02-13T11:01:00.000Z\" } }\n"
+
+	err := Execute(auth, strings.NewReader(input), brokenWriter{})
+	assert.EqualError(t, err, "error writing response: connection reset by peer")
+
+	// the input after the response that couldn't be written is not executed
+	assert.Equal(t, []string{"Oxxo"}, auth.merchants)
+}
+
+// failingAuditor fails every record, like an audit log in a full disk
+type failingAuditor struct{}
+
+func (failingAuditor) Append(audit.Entry) error {
+	return errors.New("no space left on device")
+}
+
+func TestExecute_auditError(t *testing.T) {
+	auth := &recordingAuthorizer{}
+	input := "{ \"transaction\": { \"merchant\": \"Oxxo\", \"amount\": 10, \"time\": \"2019-02-13T11:00:00.000Z\" } }\n" +
+		"{ \"transaction\": { \"merchant\": \"Walmart\", \"amount\": 10, \"time\": \"2019-02-13T11:01:00.000Z\" } }\n"
+	out := new(bytes.Buffer)
+
+	err := Execute(auth, strings.NewReader(input), out, WithAuditor(failingAuditor{}))
+	assert.EqualError(t, err, "error writing audit record: no space left on device")
+
+	// the response of the decision that couldn't be audited is not written and the rest of the input is not executed
+	assert.Equal(t, []string{"Oxxo"}, auth.merchants)
+	assert.Empty(t, out.String())
+}
+
+// recordingAuthorizer keeps the merchants of the transactions processed
+type recordingAuthorizer struct {
+	MockAuthorizer
+	merchants []string
+}
+
+func (r *recordingAuthorizer) ProcessTransaction(pt service.ProcessTransaction) (
+	response service.TransactionResponse,
+	err error,
+) {
+	r.merchants = append(r.merchants, pt.Transaction.Merchant)
+
+	return service.TransactionResponse{}, nil
+}
+
+func TestExecute_withOutputFormat(t *testing.T) {
+	input := "{\"account\": { \"activeCard\": true, \"availableLimit\": 10 }, \"requestId\": \"r1\" }\n" +
+		"abcde\n"
+	out := new(bytes.Buffer)
+
+	Execute(&MockAuthorizer{}, strings.NewReader(input), out,
+		WithOutputFormat(writer.CSV, writer.Fields{Line: true, RequestID: true, Operation: true}))
+
+	assert.Equal(t, "line,requestId,operation,activeCard,availableLimit,violations,ruleSetVersion\n"+
+		"1,r1,account,true,10,,\n"+
+		"2,,unknown-command,false,0,unknown-command,\n", out.String())
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/app/service"
+	"authorizer/internal/root/writer"
+)
+
+// History reads the transactions of the accounts
+type History interface {
+	QueryHistory(q service.HistoryQuery) (service.HistoryPage, error)
+	Statements(q service.StatementQuery) ([]service.Statement, error)
+}
+
+// accounts routes GET /accounts/{id}/history and GET /accounts/{id}/statement:
+// history returns a page of the transactions filtered by from, to (RFC 3339), merchant and outcome,
+// the next page is requested with offset=nextOffset and limit=N.
+// statement returns the statements of the range from-to split by period (day, week or month),
+// as json or as csv with format=csv
+func (s *Server) accounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/accounts/"), "/")
+	if len(parts) != 2 || (parts[1] != "history" && parts[1] != "statement") {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	accountID, err := strconv.Atoi(parts[0])
+	if err != nil || accountID < 1 {
+		http.Error(w, "the account id must be a positive number", http.StatusBadRequest)
+
+		return
+	}
+
+	values := r.URL.Query()
+
+	from, to, err := parseRange(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	// the history is read through the service, like the operations
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if parts[1] == "history" {
+		s.accountHistory(w, accountID, from, to, values)
+
+		return
+	}
+
+	s.accountStatement(w, service.StatementQuery{
+		AccountID: accountID,
+		From:      from,
+		To:        to,
+		Period:    values.Get("period"),
+	}, values.Get("format"))
+}
+
+func (s *Server) accountHistory(w http.ResponseWriter, accountID int, from, to time.Time, values url.Values) {
+	q := service.HistoryQuery{
+		AccountID: accountID,
+		From:      from,
+		To:        to,
+		Merchant:  values.Get("merchant"),
+		Outcome:   values.Get("outcome"),
+	}
+
+	var err error
+
+	if q.Offset, err = intParam(values, "offset"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if q.Limit, err = intParam(values, "limit"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	page, err := s.history.QueryHistory(q)
+	if err != nil {
+		historyError(w, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err = json.NewEncoder(w).Encode(page); err != nil {
+		log.Errorf("error writing history: %+v", err)
+	}
+}
+
+func (s *Server) accountStatement(w http.ResponseWriter, q service.StatementQuery, format string) {
+	if format == "" {
+		format = writer.StatementJSON
+	}
+
+	if format != writer.StatementJSON && format != writer.StatementCSV {
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+
+		return
+	}
+
+	statements, err := s.history.Statements(q)
+	if err != nil {
+		historyError(w, err)
+
+		return
+	}
+
+	if format == writer.StatementCSV {
+		w.Header().Set("Content-Type", "text/csv")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+
+	if err = writer.WriteStatements(w, statements, format); err != nil {
+		log.Errorf("error writing statements: %+v", err)
+	}
+}
+
+func parseRange(values url.Values) (from, to time.Time, err error) {
+	if v := values.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, errors.New("from must be a RFC 3339 time")
+		}
+	}
+
+	if v := values.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, errors.New("to must be a RFC 3339 time")
+		}
+	}
+
+	return from, to, nil
+}
+
+func intParam(values url.Values, name string) (int, error) {
+	v := values.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number", name)
+	}
+
+	return n, nil
+}
+
+func historyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, model.ErrAccountNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidQuery):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Errorf("error reading history: %+v", err)
+		http.Error(w, "error reading history", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/service"
+	"authorizer/internal/app/storage"
+	"authorizer/internal/common/metrics"
+)
+
+func newHistoryServer(t *testing.T) *httptest.Server {
+	svc := service.New(&storage.InMemory{})
+	ts := httptest.NewServer(New(svc, metrics.NewRegistry()).WithHistory(svc).Handler())
+
+	postOperations(t, ts.URL, "{\"account\": { \"activeCard\": true, \"availableLimit\": 1000 } }\n"+
+		"{\"transaction\": { \"merchant\": \"Oxxo\", \"amount\": 100, \"time\": \"2019-02-01T10:00:00.000Z\" } }\n"+
+		"{\"transaction\": { \"merchant\": \"Walmart\", \"amount\": 200, \"time\": \"2019-02-02T10:00:00.000Z\" } }\n"+
+		"{\"transaction\": { \"merchant\": \"Oxxo\", \"amount\": 50, \"time\": \"2019-02-03T10:00:00.000Z\" } }\n")
+
+	return ts
+}
+
+func get(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	assert.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	return resp.StatusCode, string(body)
+}
+
+func TestServer_accountHistory(t *testing.T) {
+	ts := newHistoryServer(t)
+	defer ts.Close()
+
+	status, body := get(t, ts.URL+"/accounts/1/history?merchant=Oxxo&limit=1")
+	assert.Equal(t, http.StatusOK, status)
+
+	var page service.HistoryPage
+	assert.NoError(t, json.Unmarshal([]byte(body), &page))
+	assert.Equal(t, 2, page.Total)
+	assert.Equal(t, 1, page.NextOffset)
+	assert.Len(t, page.Transactions, 1)
+	assert.Equal(t, 100, page.Transactions[0].Amount)
+	assert.Equal(t, service.OutcomeApproved, page.Transactions[0].Outcome)
+
+	status, body = get(t, ts.URL+"/accounts/1/history?merchant=Oxxo&offset=1&limit=1")
+	assert.Equal(t, http.StatusOK, status)
+
+	page = service.HistoryPage{}
+	assert.NoError(t, json.Unmarshal([]byte(body), &page))
+	assert.Equal(t, 50, page.Transactions[0].Amount)
+	assert.Equal(t, 0, page.NextOffset)
+
+	status, body = get(t, ts.URL+"/accounts/1/history?from=2019-02-02T00:00:00Z&to=2019-02-03T00:00:00Z")
+	assert.Equal(t, http.StatusOK, status)
+
+	page = service.HistoryPage{}
+	assert.NoError(t, json.Unmarshal([]byte(body), &page))
+	assert.Len(t, page.Transactions, 1)
+	assert.Equal(t, "Walmart", page.Transactions[0].Merchant)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/accounts/2/history", http.StatusNotFound},
+		{"/accounts/x/history", http.StatusBadRequest},
+		{"/accounts/1/balance", http.StatusNotFound},
+		{"/accounts/1/history?from=yesterday", http.StatusBadRequest},
+		{"/accounts/1/history?outcome=maybe", http.StatusBadRequest},
+		{"/accounts/1/history?offset=one", http.StatusBadRequest},
+		{"/accounts/1/statement", http.StatusBadRequest},
+		{"/accounts/1/statement?from=2019-02-01T00:00:00Z&to=2019-02-04T00:00:00Z&format=pdf",
+			http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		status, _ = get(t, ts.URL+tt.path)
+		assert.Equal(t, tt.wantStatus, status, tt.path)
+	}
+}
+
+func TestServer_accountStatement(t *testing.T) {
+	ts := newHistoryServer(t)
+	defer ts.Close()
+
+	status, body := get(t, ts.URL+"/accounts/1/statement?from=2019-02-01T00:00:00Z&to=2019-02-04T00:00:00Z")
+	assert.Equal(t, http.StatusOK, status)
+
+	var statements []service.Statement
+	assert.NoError(t, json.Unmarshal([]byte(body), &statements))
+	assert.Len(t, statements, 1)
+	assert.Equal(t, 1000, statements[0].OpeningLimit)
+	assert.Equal(t, 350, statements[0].Purchases)
+	assert.Equal(t, 650, statements[0].ClosingLimit)
+
+	status, body = get(t, ts.URL+"/accounts/1/statement?from=2019-02-01T00:00:00Z&to=2019-02-03T00:00:00Z"+
+		"&period=day&format=csv")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 1+2*6, strings.Count(body, "\n"), body)
+	assert.Contains(t, body, "1,2019-02-02T00:00:00Z,2019-02-03T00:00:00Z,opening,,,,900\n")
+}
+
+func TestServer_accountStatement_compacted(t *testing.T) {
+	db := &storage.InMemory{}
+	svc := service.New(db)
+	ts := httptest.NewServer(New(svc, metrics.NewRegistry()).WithHistory(svc).Handler())
+	defer ts.Close()
+
+	postOperations(t, ts.URL, "{\"account\": { \"activeCard\": true, \"availableLimit\": 1000 } }\n"+
+		"{\"transaction\": { \"merchant\": \"Oxxo\", \"amount\": 100, \"time\": \"2019-02-01T10:00:00.000Z\" } }\n"+
+		"{\"transaction\": { \"merchant\": \"Walmart\", \"amount\": 200, \"time\": \"2019-02-03T10:00:00.000Z\" } }\n")
+
+	removed, err := db.Compact(storage.Retention{Horizon: 24 * time.Hour})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	status, body := get(t, ts.URL+"/accounts/1/statement?from=2019-02-01T00:00:00Z&to=2019-02-04T00:00:00Z")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, "the history before 2019-02-03T10:00:00Z was compacted")
+
+	status, body = get(t, ts.URL+"/accounts/1/statement?from=2019-02-03T10:00:00Z&to=2019-02-04T00:00:00Z")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"openingLimit":900`)
+}
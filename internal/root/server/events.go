@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"authorizer/internal/app/model"
+)
+
+const (
+	defaultEventsLimit = 100
+	maxEventsLimit     = 1000
+	// maxEventsWait is the longest a long-poll request waits for events
+	maxEventsWait = time.Minute
+	// keepAliveInterval is how often a comment is sent to an idle event stream, so the proxies don't close it
+	keepAliveInterval = 15 * time.Second
+)
+
+// eventsQuery are the parameters of GET /events
+type eventsQuery struct {
+	after int
+	limit int
+	wait  time.Duration
+}
+
+// eventsHandler returns the authorization events with an offset greater than the parameter after (0 by default),
+// in the order they were committed. A consumer reads every event once by keeping the offset of the last event
+// it processed with its own writes and asking for the events after it.
+//
+// By default it responds up to limit events as json lines, with wait=30s it waits for the next event when there are
+// none. With "Accept: text/event-stream" the events are streamed as server-sent events whose id is the offset,
+// so a reconnection continues after the Last-Event-ID header.
+// The events removed by the retention respond 410 Gone and an offset after the last event 409 Conflict
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	q, err := parseEventsQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if r.Header.Get("Accept") == "text/event-stream" {
+		s.streamEvents(w, r, q)
+
+		return
+	}
+
+	events, committed, err := s.events.Events(q.after, q.limit)
+	if err == nil && len(events) == 0 && q.wait > 0 {
+		timer := time.NewTimer(q.wait)
+		defer timer.Stop()
+
+		select {
+		case <-committed:
+			events, _, err = s.events.Events(q.after, q.limit)
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if err != nil {
+		eventsError(w, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	encoder := json.NewEncoder(w)
+	for _, e := range events {
+		if err = encoder.Encode(e); err != nil {
+			log.Errorf("error writing events: %+v", err)
+
+			return
+		}
+	}
+}
+
+// streamEvents writes the events as server-sent events until the client disconnects
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request, q eventsQuery) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+
+		return
+	}
+
+	events, committed, err := s.events.Events(q.after, q.limit)
+	if err != nil {
+		eventsError(w, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		for _, e := range events {
+			b, err := json.Marshal(e)
+			if err != nil {
+				log.Errorf("error writing events: %+v", err)
+
+				return
+			}
+
+			fmt.Fprintf(w, "id: %d\nevent: authorization\ndata: %s\n\n", e.Offset, b)
+			q.after = e.Offset
+		}
+
+		flusher.Flush()
+
+		if len(events) == 0 {
+			select {
+			case <-committed:
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if events, committed, err = s.events.Events(q.after, q.limit); err != nil {
+			// the stream already started, the client reconnects and receives the error
+			log.Errorf("error reading events: %+v", err)
+
+			return
+		}
+	}
+}
+
+func parseEventsQuery(r *http.Request) (eventsQuery, error) {
+	q := eventsQuery{limit: defaultEventsLimit}
+	values := r.URL.Query()
+
+	after := values.Get("after")
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		after = id
+	}
+
+	var err error
+
+	if after != "" {
+		if q.after, err = strconv.Atoi(after); err != nil || q.after < 0 {
+			return q, errors.New("after must be an offset, a number greater or equal than 0")
+		}
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		if q.limit, err = strconv.Atoi(limit); err != nil || q.limit < 1 || q.limit > maxEventsLimit {
+			return q, fmt.Errorf("limit must be a number between 1 and %d", maxEventsLimit)
+		}
+	}
+
+	if wait := values.Get("wait"); wait != "" {
+		if q.wait, err = time.ParseDuration(wait); err != nil || q.wait < 0 || q.wait > maxEventsWait {
+			return q, fmt.Errorf("wait must be a duration between 0s and %s", maxEventsWait)
+		}
+	}
+
+	return q, nil
+}
+
+func eventsError(w http.ResponseWriter, err error) {
+	if errors.Is(err, model.ErrEventsCompacted) {
+		http.Error(w, err.Error(), http.StatusGone)
+
+		return
+	}
+
+	if errors.Is(err, model.ErrOffsetAhead) {
+		http.Error(w, err.Error(), http.StatusConflict)
+
+		return
+	}
+
+	log.Errorf("error reading events: %+v", err)
+	http.Error(w, "error reading events", http.StatusInternalServerError)
+}
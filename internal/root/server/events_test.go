@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/app/service"
+	"authorizer/internal/app/storage"
+	"authorizer/internal/common/metrics"
+)
+
+const eventsInput = "{\"account\": { \"activeCard\": true, \"availableLimit\": 100 } }\n" +
+	"{\"transaction\": { \"merchant\": \"Burger King\", \"amount\": 20, \"time\": \"2019-02-13T10:00:00.000Z\" } }\n" +
+	"{\"transaction\": { \"merchant\": \"Habbib's\", \"amount\": 90, \"time\": \"2019-02-13T11:00:00.000Z\" } }\n"
+
+func newEventsServer() (*httptest.Server, *storage.InMemory) {
+	db := &storage.InMemory{}
+	registry := metrics.NewRegistry()
+
+	return httptest.NewServer(New(service.New(db), registry).WithEvents(db).Handler()), db
+}
+
+func postOperations(t *testing.T, url, body string) {
+	resp, err := http.Post(url+"/operations", "application/x-ndjson", strings.NewReader(body))
+	assert.NoError(t, err)
+
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func getEvents(t *testing.T, url string) (int, []model.AuthorizationEvent) {
+	resp, err := http.Get(url)
+	assert.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	var events []model.AuthorizationEvent
+
+	decoder := json.NewDecoder(resp.Body)
+	for resp.StatusCode == http.StatusOK && decoder.More() {
+		var e model.AuthorizationEvent
+		assert.NoError(t, decoder.Decode(&e))
+
+		events = append(events, e)
+	}
+
+	return resp.StatusCode, events
+}
+
+func TestServer_events(t *testing.T) {
+	ts, db := newEventsServer()
+	defer ts.Close()
+
+	postOperations(t, ts.URL, eventsInput)
+
+	status, events := getEvents(t, ts.URL+"/events")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, events, 2)
+	assert.Equal(t, 1, events[0].Offset)
+	assert.True(t, events[0].Approved)
+	assert.Equal(t, 80, events[0].AvailableLimit)
+	assert.Equal(t, "Burger King", events[0].Transaction.Merchant)
+	assert.Equal(t, 2, events[1].Offset)
+	assert.Equal(t, []string{"insufficient-limit"}, events[1].Violations)
+
+	status, events = getEvents(t, ts.URL+"/events?after=1&limit=1")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, events, 1)
+	assert.Equal(t, 2, events[0].Offset)
+
+	status, events = getEvents(t, ts.URL+"/events?after=2")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, events)
+
+	status, _ = getEvents(t, ts.URL+"/events?after=3")
+	assert.Equal(t, http.StatusConflict, status)
+
+	for _, query := range []string{"after=-1", "limit=0", "limit=1001", "wait=2h", "wait=soon"} {
+		status, _ = getEvents(t, ts.URL+"/events?"+query)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+	}
+
+	_, err := db.Compact(storage.Retention{MaxEvents: 1})
+	assert.NoError(t, err)
+
+	status, _ = getEvents(t, ts.URL+"/events")
+	assert.Equal(t, http.StatusGone, status)
+}
+
+func TestServer_events_reservedMerchant(t *testing.T) {
+	ts, db := newEventsServer()
+	defer ts.Close()
+
+	postOperations(t, ts.URL, "{\"account\": { \"activeCard\": true, \"availableLimit\": 100 } }\n"+
+		"{\"transaction\": { \"merchant\": \"payment\", \"amount\": 20, \"time\": \"2019-02-13T10:00:00.000Z\" } }\n")
+
+	// the attempt is declined as the ones that fail a rule, with its event and out of the history
+	status, events := getEvents(t, ts.URL+"/events")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, events, 1)
+	assert.False(t, events[0].Approved)
+	assert.Equal(t, []string{"reserved-merchant"}, events[0].Violations)
+	assert.Equal(t, 100, events[0].AvailableLimit)
+
+	declined := db.GetDeclined(1)
+	assert.Len(t, declined, 1)
+	assert.Equal(t, "payment", declined[0].Transaction.Merchant)
+	assert.Equal(t, []string{"reserved-merchant"}, declined[0].Violations)
+
+	transactions := db.GetTransactions(1)
+	assert.Len(t, transactions, 1)
+	assert.Equal(t, model.InitialMerchant, transactions[0].Merchant)
+}
+
+func TestServer_events_longPoll(t *testing.T) {
+	ts, _ := newEventsServer()
+	defer ts.Close()
+
+	postOperations(t, ts.URL, "{\"account\": { \"activeCard\": true, \"availableLimit\": 100 } }\n")
+
+	type result struct {
+		status int
+		events []model.AuthorizationEvent
+	}
+
+	done := make(chan result)
+
+	go func() {
+		status, events := getEvents(t, ts.URL+"/events?wait=10s")
+		done <- result{status, events}
+	}()
+
+	// the account creation is not an event, the request waits for the transaction
+	time.Sleep(50 * time.Millisecond)
+	postOperations(t, ts.URL,
+		"{\"transaction\": { \"merchant\": \"Burger King\", \"amount\": 20, \"time\": \"2019-02-13T10:00:00.000Z\" } }\n")
+
+	select {
+	case got := <-done:
+		assert.Equal(t, http.StatusOK, got.status)
+		assert.Len(t, got.events, 1)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the long-poll didn't return the event")
+	}
+
+	status, events := getEvents(t, ts.URL+"/events?after=1&wait=10ms")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, events)
+}
+
+func TestServer_events_stream(t *testing.T) {
+	ts, _ := newEventsServer()
+	defer ts.Close()
+
+	postOperations(t, ts.URL, eventsInput)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/events", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Last-Event-ID", "1")
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func() string {
+		assert.True(t, lines.Scan())
+
+		return lines.Text()
+	}
+
+	assert.Equal(t, "id: 2", next())
+	assert.Equal(t, "event: authorization", next())
+	assert.Contains(t, next(), `"violations":["insufficient-limit"]`)
+	assert.Equal(t, "", next())
+
+	postOperations(t, ts.URL,
+		"{\"transaction\": { \"merchant\": \"Oxxo\", \"amount\": 10, \"time\": \"2019-02-13T12:00:00.000Z\" } }\n")
+
+	assert.Equal(t, "id: 3", next())
+	assert.Equal(t, "event: authorization", next())
+	assert.Contains(t, next(), `"merchant":"Oxxo"`)
+}
+
+func TestServer_events_notExposed(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/events")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+
+	"authorizer/internal/app/service"
+	cmd2 "authorizer/internal/root"
+)
+
+// maxBodyBytes is the largest body of POST /operations
+const maxBodyBytes = 10 << 20
+
+// Server exposes the authorizer over HTTP. The operations of a request are executed together, one request at a time,
+// so the responses of a request are the ones of its lines in order; the body is read before and the responses are
+// written after, so a slow client doesn't delay the others
+type Server struct {
+	mu   sync.Mutex
+	auth cmd2.Authorizer
+	// metricsHandler writes the metrics of the registry in the Prometheus text format
+	metricsHandler http.Handler
+	opts           []cmd2.Option
+	// maxBody is the limit of the body of POST /operations, larger bodies are answered with 413
+	maxBody int64
+	// events is optional, it is read by GET /events
+	events service.EventLog
+	// history is optional, it is read by GET /accounts/{id}/history and /accounts/{id}/statement
+	history History
+}
+
+// New creates a server that executes the operations with auth and exposes the metrics of the registry,
+// opts are used every time root.Execute is called
+func New(auth cmd2.Authorizer, registry prometheus.Gatherer, opts ...cmd2.Option) *Server {
+	return &Server{
+		auth:           auth,
+		metricsHandler: promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorLog: log.StandardLogger()}),
+		opts:           opts,
+		maxBody:        maxBodyBytes,
+	}
+}
+
+// WithEvents exposes the events of the storage in GET /events
+func (s *Server) WithEvents(events service.EventLog) *Server {
+	s.events = events
+
+	return s
+}
+
+// WithHistory exposes the history and the statements of the accounts in GET /accounts/{id}/...
+func (s *Server) WithHistory(history History) *Server {
+	s.history = history
+
+	return s
+}
+
+// Handler returns the routes of the server:
+// POST /operations receives the same json lines as the stdin and responds one line per operation
+// GET /metrics returns the metrics in the Prometheus text format
+// GET /events returns the authorization events after an offset, see Server.eventsHandler
+// GET /accounts/{id}/history and GET /accounts/{id}/statement read the transactions, see Server.accounts
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/operations", s.operations)
+	mux.HandleFunc("/metrics", s.metrics)
+
+	if s.events != nil {
+		mux.HandleFunc("/events", s.eventsHandler)
+	}
+
+	if s.history != nil {
+		mux.HandleFunc("/accounts/", s.accounts)
+	}
+
+	return mux
+}
+
+func (s *Server) operations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBody))
+	if err != nil && int64(len(body)) >= s.maxBody {
+		http.Error(w, "the operations are too large", http.StatusRequestEntityTooLarge)
+
+		return
+	}
+
+	if err != nil {
+		http.Error(w, "error reading the operations", http.StatusBadRequest)
+
+		return
+	}
+
+	responses := new(bytes.Buffer)
+
+	s.mu.Lock()
+	err = cmd2.Execute(s.auth, bytes.NewReader(body), responses, s.opts...)
+	s.mu.Unlock()
+
+	// the responses are written to memory, so the error is of the audit log, the operations after the one that
+	// couldn't be audited were not executed
+	if err != nil {
+		http.Error(w, "error executing the operations", http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	if _, err = w.Write(responses.Bytes()); err != nil {
+		log.Errorf("error writing responses: %+v", err)
+	}
+}
+
+func (s *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	// the gauges read the storage, so they can't be written while an operation is executed
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.metricsHandler.ServeHTTP(w, r)
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/audit"
+	"authorizer/internal/app/service"
+	"authorizer/internal/app/storage"
+	"authorizer/internal/common/metrics"
+	cmd2 "authorizer/internal/root"
+)
+
+func newTestServer() *httptest.Server {
+	registry := metrics.NewRegistry()
+	svc := service.New(&storage.InMemory{}, service.WithMetrics(service.NewMetrics(registry)))
+
+	return httptest.NewServer(New(svc, registry).Handler())
+}
+
+func TestServer_operations(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	body := "{\"account\": { \"activeCard\": true, \"availableLimit\": 100 } }\n" +
+		"{\"transaction\": { \"merchant\": \"Burger King\", \"amount\": 20, \"time\": \"2019-02-13T10:00:00.000Z\" } }\n" +
+		"{\"transaction\": { \"merchant\": \"Habbib's\", \"amount\": 90, \"time\": \"2019-02-13T11:00:00.000Z\" } }\n"
+
+	resp, err := http.Post(ts.URL+"/operations", "application/x-ndjson", strings.NewReader(body))
+	assert.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	got, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "{\"account\":{\"activeCard\":true,\"availableLimit\":100},\"violations\":[]}\n"+
+		"{\"account\":{\"activeCard\":true,\"availableLimit\":80},\"violations\":[],\"ruleSetVersion\":\"default\"}\n"+
+		"{\"account\":{\"activeCard\":true,\"availableLimit\":80},\"violations\":[\"insufficient-limit\"],"+
+		"\"ruleSetVersion\":\"default\"}\n",
+		string(got))
+
+	resp, err = http.Get(ts.URL + "/metrics")
+	assert.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	got, err = io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	metricsText := string(got)
+	assert.Contains(t, metricsText, `authorizer_operations_total{operation="account",outcome="approved"} 1`)
+	assert.Contains(t, metricsText, `authorizer_operations_total{operation="transaction",outcome="approved"} 1`)
+	assert.Contains(t, metricsText, `authorizer_operations_total{operation="transaction",outcome="declined"} 1`)
+	assert.Contains(t, metricsText,
+		`authorizer_rule_violations_total{rule="sufficientLimit",violation="insufficient-limit"} 1`)
+	assert.Contains(t, metricsText, "authorizer_process_transaction_duration_seconds_count 2")
+	assert.Contains(t, metricsText, `authorizer_storage_duration_seconds_count{method="ExecuteTransaction"} 1`)
+	assert.Contains(t, metricsText, "authorizer_accounts 1")
+	assert.Contains(t, metricsText, "authorizer_history_transactions 2")
+}
+
+func TestServer_methodNotAllowed(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/operations")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, err = http.Post(ts.URL+"/metrics", "text/plain", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestServer_operationsSlowClient(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	// the first client sends a line and never ends its body
+	slow, slowWriter := io.Pipe()
+	defer slowWriter.Close()
+
+	go func() {
+		resp, err := http.Post(ts.URL+"/operations", "application/x-ndjson", slow)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	_, err := slowWriter.Write([]byte("{\"account\": { \"activeCard\": true, \"availableLimit\": 100 } }\n"))
+	assert.NoError(t, err)
+
+	client := http.Client{Timeout: 5 * time.Second}
+
+	resp, err := client.Post(ts.URL+"/operations", "application/x-ndjson",
+		strings.NewReader("{\"account\": { \"activeCard\": true, \"availableLimit\": 50 }, \"accountId\": 2 }\n"))
+	assert.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	got, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"account\":{\"activeCard\":true,\"availableLimit\":50},\"violations\":[]}\n", string(got))
+
+	resp, err = client.Get(ts.URL + "/metrics")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestServer_operationsTooLarge(t *testing.T) {
+	registry := metrics.NewRegistry()
+	s := New(service.New(&storage.InMemory{}), registry)
+	s.maxBody = 10
+
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/operations", "application/x-ndjson",
+		strings.NewReader("{\"account\": { \"activeCard\": true, \"availableLimit\": 100 } }\n"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+// failingAuditor fails every record, like an audit log in a full disk
+type failingAuditor struct{}
+
+func (failingAuditor) Append(audit.Entry) error {
+	return errors.New("no space left on device")
+}
+
+func TestServer_operationsAuditError(t *testing.T) {
+	db := &storage.InMemory{}
+	registry := metrics.NewRegistry()
+
+	ts := httptest.NewServer(New(service.New(db), registry, cmd2.WithAuditor(failingAuditor{})).Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/operations", "application/x-ndjson",
+		strings.NewReader("{\"account\": { \"activeCard\": true, \"availableLimit\": 100 } }\n"+
+			"{\"transaction\": { \"merchant\": \"Oxxo\", \"amount\": 20, \"time\": \"2019-02-13T10:00:00.000Z\" } }\n"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	// the operation after the one that couldn't be audited is not executed and the server keeps running
+	assert.Equal(t, 100, db.GetAccount(1).AvailableLimit)
+	assert.Len(t, db.GetTransactions(1), 1)
+
+	resp, err = http.Get(ts.URL + "/metrics")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
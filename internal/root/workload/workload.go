@@ -0,0 +1,399 @@
+package workload
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"time"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/app/service/rules"
+	"authorizer/internal/app/violations"
+)
+
+// Fraud patterns injected in the workload
+const (
+	PatternDouble      = "double"
+	PatternBurst       = "burst"
+	PatternCardTesting = "card-testing"
+)
+
+const (
+	// doubleMaxDelay keeps the copy of a transaction inside the default window of doubleTransaction
+	doubleMaxDelay = 110 * time.Second
+	// burstSize is the number of transactions of a burst, from the third one they exceed the default threshold
+	// of highFrequency. The burst starts after the default window, so the transaction before it is not counted
+	burstSize     = 4
+	burstStart    = 3 * time.Minute
+	burstMaxDelay = 20 * time.Second
+	// cardTestingDelay separates the probes of a card-testing attack, so they don't raise high-frequency-small-interval
+	cardTestingDelay = 2*time.Minute + 10*time.Second
+)
+
+// Config describes the workload, the same config (seed included) always generates the same lines
+type Config struct {
+	Seed     int64
+	Accounts int
+	// Transactions is the number of legitimate transactions of every account, the fraud is added to them
+	Transactions int
+	Start        time.Time
+	// Rate is the mean number of legitimate transactions per hour of every account
+	Rate  float64
+	Limit int
+	// Merchants is the size of the catalog, MerchantSkew > 1 makes a few merchants receive most of the
+	// transactions (zipf), otherwise every merchant is equally likely
+	Merchants    int
+	MerchantSkew float64
+	// AmountMedian and AmountSpread are the parameters of the log-normal distribution of the amounts
+	AmountMedian int
+	AmountSpread float64
+	// Doubles, Bursts and CardTesting are the probabilities that a legitimate transaction is followed by the pattern
+	Doubles     float64
+	Bursts      float64
+	CardTesting float64
+}
+
+// DefaultConfig returns a small workload of a single account
+func DefaultConfig() Config {
+	return Config{
+		Seed:         1,
+		Accounts:     1,
+		Transactions: 100,
+		Start:        time.Date(2019, 2, 13, 10, 0, 0, 0, time.UTC),
+		Rate:         2,
+		Limit:        100000,
+		Merchants:    50,
+		MerchantSkew: 1.2,
+		AmountMedian: 40,
+		AmountSpread: 0.8,
+		Doubles:      0.01,
+		Bursts:       0.01,
+		CardTesting:  0.005,
+	}
+}
+
+// Validate verifies that the workload can be generated
+func (c Config) Validate() error {
+	switch {
+	case c.Accounts < 1:
+		return errors.New("accounts must be at least 1")
+	case c.Transactions < 0:
+		return errors.New("transactions can't be negative")
+	case c.Rate <= 0:
+		return errors.New("rate must be greater than 0")
+	case c.Limit < 0:
+		return errors.New("limit can't be negative")
+	case c.Merchants < rules.DefaultConfig().CardTesting.MinTransactions:
+		// the probes of a card-testing attack use distinct merchants
+		return fmt.Errorf("merchants must be at least %d", rules.DefaultConfig().CardTesting.MinTransactions)
+	case c.AmountMedian < 1:
+		return errors.New("amount median must be at least 1")
+	case c.AmountSpread < 0:
+		return errors.New("amount spread can't be negative")
+	}
+
+	probabilities := []struct {
+		name string
+		p    float64
+	}{{"doubles", c.Doubles}, {"bursts", c.Bursts}, {"card-testing", c.CardTesting}}
+
+	for _, p := range probabilities {
+		if p.p < 0 || p.p > 1 {
+			return fmt.Errorf("%s must be a probability between 0 and 1", p.name)
+		}
+	}
+
+	return nil
+}
+
+// Label is the expected outcome of a generated transaction, Violation is the violation that should decline it
+// with the default rules, it is empty when the transaction should be approved. Some fraudulent transactions
+// are expected to be approved, e.g. the first transactions of a burst
+type Label struct {
+	Fraud     bool   `json:"fraud"`
+	Pattern   string `json:"pattern,omitempty"`
+	Violation string `json:"violation,omitempty"`
+}
+
+// Summary counts the lines written by Generate
+type Summary struct {
+	Accounts     int
+	Transactions int
+	Fraud        int
+	// Declines is the number of transactions labeled with a violation
+	Declines int
+	Patterns map[string]int
+}
+
+// line is a record of the ndjson input, the account id and the label are keys of the object besides the operation
+type line struct {
+	Account     *model.Account     `json:"account,omitempty"`
+	Transaction *model.Transaction `json:"transaction,omitempty"`
+	AccountID   int                `json:"accountId"`
+	Label       *Label             `json:"label,omitempty"`
+}
+
+// Generate writes the ndjson lines of the workload: the accounts first and then the transactions of every account
+// merged in time order. The lines are generated as they are written, so the workload doesn't need to fit in memory
+func Generate(w io.Writer, c Config) (Summary, error) {
+	summary := Summary{Patterns: map[string]int{}}
+
+	if err := c.Validate(); err != nil {
+		return summary, err
+	}
+
+	out := bufio.NewWriter(w)
+	encoder := json.NewEncoder(out)
+	streams := make(streamHeap, 0, c.Accounts)
+
+	for id := 1; id <= c.Accounts; id++ {
+		account := model.Account{ActiveCard: true, AvailableLimit: c.Limit}
+		if err := encoder.Encode(line{Account: &account, AccountID: id}); err != nil {
+			return summary, err
+		}
+
+		summary.Accounts++
+
+		s := newStream(c, id)
+		if s.next() {
+			streams = append(streams, s)
+		}
+	}
+
+	heap.Init(&streams)
+
+	for streams.Len() > 0 {
+		s := streams[0]
+		e := s.current
+
+		if err := encoder.Encode(line{Transaction: &e.transaction, AccountID: s.id, Label: &e.label}); err != nil {
+			return summary, err
+		}
+
+		summary.add(e.label)
+
+		if s.next() {
+			heap.Fix(&streams, 0)
+		} else {
+			heap.Pop(&streams)
+		}
+	}
+
+	return summary, out.Flush()
+}
+
+func (s *Summary) add(l Label) {
+	s.Transactions++
+
+	if l.Fraud {
+		s.Fraud++
+	}
+
+	if l.Violation != "" {
+		s.Declines++
+	}
+
+	if l.Pattern != "" {
+		s.Patterns[l.Pattern]++
+	}
+}
+
+// event is a transaction of an account with its label
+type event struct {
+	transaction model.Transaction
+	label       Label
+}
+
+// stream generates the transactions of an account in time order, every account has its own random source,
+// so the transactions of an account don't depend on the number of accounts
+type stream struct {
+	id        int
+	config    Config
+	rand      *rand.Rand
+	merchants *rand.Zipf
+	// nextLegit is the time of the next legitimate transaction, remaining the number still to be generated
+	nextLegit time.Time
+	remaining int
+	// pending are the fraudulent transactions already scheduled, in time order
+	pending []event
+	current event
+}
+
+func newStream(c Config, id int) *stream {
+	s := &stream{
+		id:        id,
+		config:    c,
+		rand:      rand.New(rand.NewSource(c.Seed*1000003 + int64(id))), //nolint:gosec // reproducible, not secret
+		remaining: c.Transactions,
+	}
+
+	if c.MerchantSkew > 1 {
+		s.merchants = rand.NewZipf(s.rand, c.MerchantSkew, 1, uint64(c.Merchants-1))
+	}
+
+	s.nextLegit = c.Start.Add(s.interval())
+
+	return s
+}
+
+// next sets current to the next transaction of the account, it is false when the account has no more transactions
+func (s *stream) next() bool {
+	legit := s.remaining > 0 && (len(s.pending) == 0 || s.nextLegit.Before(s.pending[0].transaction.Time))
+
+	switch {
+	case legit:
+		s.current = event{transaction: model.Transaction{
+			Merchant: s.merchant(),
+			Amount:   s.amount(),
+			Time:     s.nextLegit,
+		}}
+		s.remaining--
+		s.nextLegit = s.nextLegit.Add(s.interval())
+		s.inject(s.current.transaction)
+	case len(s.pending) > 0:
+		s.current = s.pending[0]
+		s.pending = s.pending[1:]
+	default:
+		return false
+	}
+
+	return true
+}
+
+// inject schedules the fraud patterns that follow the legitimate transaction
+func (s *stream) inject(after model.Transaction) {
+	if s.rand.Float64() < s.config.Doubles {
+		s.double(after)
+	}
+
+	if s.rand.Float64() < s.config.Bursts {
+		s.burst(after.Time)
+	}
+
+	if s.rand.Float64() < s.config.CardTesting {
+		s.cardTesting(after.Time)
+	}
+}
+
+// double copies the transaction a few seconds later, the copy should be declined as doubled-transaction
+func (s *stream) double(original model.Transaction) {
+	tx := original
+	tx.Time = original.Time.Add(s.delay(doubleMaxDelay))
+
+	s.schedule(event{transaction: tx, label: Label{
+		Fraud:     true,
+		Pattern:   PatternDouble,
+		Violation: violations.ViolationDoubledTransaction,
+	}})
+}
+
+// burst executes transactions of distinct merchants and amounts within seconds, the ones after the second
+// should be declined as high-frequency-small-interval
+func (s *stream) burst(after time.Time) {
+	t := after.Add(burstStart)
+	merchants := s.rand.Perm(s.config.Merchants)[:burstSize]
+
+	for i, m := range merchants {
+		t = t.Add(s.delay(burstMaxDelay))
+		label := Label{Fraud: true, Pattern: PatternBurst}
+
+		if i >= 2 {
+			label.Violation = violations.ViolationHighFrequencySmallInterval
+		}
+
+		tx := model.Transaction{Merchant: merchantName(m), Amount: s.amount(), Time: t}
+		s.schedule(event{transaction: tx, label: label})
+	}
+}
+
+// cardTesting probes the card with tiny amounts in distinct merchants, the probe that completes the default
+// thresholds of cardTesting should be declined as card-testing-suspected
+func (s *stream) cardTesting(after time.Time) {
+	config := rules.DefaultConfig().CardTesting
+	merchants := s.rand.Perm(s.config.Merchants)[:config.MinTransactions]
+	t := after
+
+	for i, m := range merchants {
+		t = t.Add(cardTestingDelay)
+		label := Label{Fraud: true, Pattern: PatternCardTesting}
+
+		if i == len(merchants)-1 {
+			label.Violation = violations.ViolationCardTestingSuspected
+		}
+
+		tx := model.Transaction{Merchant: merchantName(m), Amount: 1 + s.rand.Intn(config.MaxAmount), Time: t}
+		s.schedule(event{transaction: tx, label: label})
+	}
+}
+
+// schedule inserts the event in pending keeping the time order, events with the same time keep their order
+func (s *stream) schedule(e event) {
+	i := len(s.pending)
+	for i > 0 && e.transaction.Time.Before(s.pending[i-1].transaction.Time) {
+		i--
+	}
+
+	s.pending = append(s.pending, event{})
+	copy(s.pending[i+1:], s.pending[i:])
+	s.pending[i] = e
+}
+
+// interval is the time between two legitimate transactions, exponential so they follow a poisson process
+func (s *stream) interval() time.Duration {
+	return time.Duration(s.rand.ExpFloat64() / s.config.Rate * float64(time.Hour)).Truncate(time.Second)
+}
+
+// delay is a random delay between 1 second and max
+func (s *stream) delay(max time.Duration) time.Duration {
+	return time.Second + time.Duration(s.rand.Int63n(int64(max-time.Second))).Truncate(time.Second)
+}
+
+func (s *stream) merchant() string {
+	if s.merchants != nil {
+		return merchantName(int(s.merchants.Uint64()))
+	}
+
+	return merchantName(s.rand.Intn(s.config.Merchants))
+}
+
+// amount is log-normal, most amounts are close to the median and a few are much bigger
+func (s *stream) amount() int {
+	amount := float64(s.config.AmountMedian) * math.Exp(s.rand.NormFloat64()*s.config.AmountSpread)
+
+	return int(math.Max(1, math.Round(amount)))
+}
+
+func merchantName(i int) string {
+	return fmt.Sprintf("merchant-%03d", i+1)
+}
+
+// streamHeap orders the streams by the time of their current transaction, the lowest account id first on ties
+type streamHeap []*stream
+
+func (h streamHeap) Len() int { return len(h) }
+
+func (h streamHeap) Less(i, j int) bool {
+	ti, tj := h[i].current.transaction.Time, h[j].current.transaction.Time
+	if ti.Equal(tj) {
+		return h[i].id < h[j].id
+	}
+
+	return ti.Before(tj)
+}
+
+func (h streamHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *streamHeap) Push(x interface{}) { *h = append(*h, x.(*stream)) }
+
+func (h *streamHeap) Pop() interface{} {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return s
+}
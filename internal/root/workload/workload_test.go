@@ -0,0 +1,141 @@
+package workload
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/service"
+	"authorizer/internal/app/storage"
+	cmd2 "authorizer/internal/root"
+)
+
+func TestGenerate_deterministic(t *testing.T) {
+	c := DefaultConfig()
+	c.Accounts = 3
+
+	first, second := new(bytes.Buffer), new(bytes.Buffer)
+
+	_, err := Generate(first, c)
+	assert.NoError(t, err)
+	_, err = Generate(second, c)
+	assert.NoError(t, err)
+	assert.Equal(t, first.String(), second.String())
+
+	c.Seed++
+	other := new(bytes.Buffer)
+
+	_, err = Generate(other, c)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.String(), other.String())
+}
+
+func TestGenerate(t *testing.T) {
+	c := DefaultConfig()
+	c.Accounts = 4
+	c.Transactions = 50
+	c.Doubles, c.Bursts, c.CardTesting = 0.05, 0.05, 0.05
+
+	out := new(bytes.Buffer)
+	summary, err := Generate(out, c)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 4, summary.Accounts)
+	assert.Equal(t, 200+summary.Fraud, summary.Transactions)
+	assert.Equal(t, summary.Fraud,
+		summary.Patterns[PatternDouble]+summary.Patterns[PatternBurst]+summary.Patterns[PatternCardTesting])
+
+	scanner := bufio.NewScanner(bytes.NewReader(out.Bytes()))
+	last := time.Time{}
+	lines := 0
+
+	for scanner.Scan() {
+		var l line
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &l))
+
+		lines++
+
+		if lines <= c.Accounts {
+			assert.Equal(t, lines, l.AccountID)
+			assert.Equal(t, c.Limit, l.Account.AvailableLimit)
+
+			continue
+		}
+
+		assert.False(t, l.Transaction.Time.Before(last), "line %d is not in time order", lines)
+		last = l.Transaction.Time
+	}
+
+	assert.Equal(t, summary.Accounts+summary.Transactions, lines)
+}
+
+// TestGenerate_labels executes the workload and compares the labels with the decisions of the default rules,
+// with low rates the legitimate transactions and the patterns don't interfere with each other
+func TestGenerate_labels(t *testing.T) {
+	c := DefaultConfig()
+	c.Accounts = 2
+	c.Transactions = 200
+	c.Rate = 0.5
+	c.Doubles, c.Bursts, c.CardTesting = 0.02, 0.02, 0.02
+
+	input := new(bytes.Buffer)
+	summary, err := Generate(input, c)
+	assert.NoError(t, err)
+	assert.NotZero(t, summary.Declines)
+
+	lines := bytes.Split(bytes.TrimSpace(input.Bytes()), []byte("\n"))
+
+	db := &storage.InMemory{}
+	output := new(bytes.Buffer)
+	cmd2.Execute(service.New(db), bytes.NewReader(input.Bytes()), output)
+
+	responses := bytes.Split(bytes.TrimSpace(output.Bytes()), []byte("\n"))
+	assert.Len(t, responses, len(lines))
+
+	for i := c.Accounts; i < len(lines); i++ {
+		var l line
+		assert.NoError(t, json.Unmarshal(lines[i], &l))
+
+		var response service.TransactionResponse
+		assert.NoError(t, json.Unmarshal(responses[i], &response))
+
+		if l.Label.Violation == "" {
+			assert.Empty(t, response.Violations, "line %d", i+1)
+		} else {
+			assert.Equal(t, []string{l.Label.Violation}, response.Violations, "line %d", i+1)
+		}
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string
+	}{
+		{"default", func(c *Config) {}, ""},
+		{"no accounts", func(c *Config) { c.Accounts = 0 }, "accounts must be at least 1"},
+		{"no rate", func(c *Config) { c.Rate = 0 }, "rate must be greater than 0"},
+		{"few merchants", func(c *Config) { c.Merchants = 4 }, "merchants must be at least 5"},
+		{"probability", func(c *Config) { c.Bursts = 1.5 }, "bursts must be a probability between 0 and 1"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultConfig()
+			tt.modify(&c)
+
+			err := c.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
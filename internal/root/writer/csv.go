@@ -0,0 +1,44 @@
+package writer
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+type csvEncoder struct {
+	w      *csv.Writer
+	fields Fields
+	header bool
+}
+
+// CSV writes a header row and one row per response, the violations are separated by ";"
+func CSV(w io.Writer, f Fields) Encoder {
+	return &csvEncoder{w: csv.NewWriter(w), fields: f}
+}
+
+func (e *csvEncoder) Encode(r Record) error {
+	header, values := e.fields.columns(r)
+
+	if !e.header {
+		if err := e.w.Write(header); err != nil {
+			return err
+		}
+
+		e.header = true
+	}
+
+	if err := e.w.Write(values); err != nil {
+		return err
+	}
+
+	// every row is flushed so the responses are received as soon as they are processed
+	e.w.Flush()
+
+	return e.w.Error()
+}
+
+func (e *csvEncoder) Flush() error {
+	e.w.Flush()
+
+	return e.w.Error()
+}
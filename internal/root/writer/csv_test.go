@@ -0,0 +1,13 @@
+package writer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSV(t *testing.T) {
+	assert.Equal(t, "line,requestId,activeCard,availableLimit,violations,ruleSetVersion\n"+
+		"1,r1,true,80,insufficient-limit;high-frequency-small-interval,\n"+
+		"2,,false,0,unknown-command,\n", encode(t, CSV, Fields{Line: true, RequestID: true}))
+}
@@ -0,0 +1,138 @@
+package writer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"authorizer/internal/app/service"
+)
+
+// Output formats
+const (
+	FormatNDJSON = "ndjson"
+	FormatPretty = "pretty"
+	FormatCSV    = "csv"
+	FormatTable  = "table"
+)
+
+// Enrichment fields that can be added to the responses
+const (
+	FieldLine      = "line"
+	FieldRequestID = "requestId"
+	FieldOperation = "operation"
+	FieldTimestamp = "timestamp"
+)
+
+// Record is the response of an operation and the data needed to join it to its input
+type Record struct {
+	// Line is the position of the record in the input
+	Line      int
+	RequestID string
+	Operation string
+	// ProcessedAt is when the operation was executed
+	ProcessedAt time.Time
+	Response    service.TransactionResponse
+	// Failure is set when the record couldn't be executed, it is also the only violation of the response
+	Failure string
+}
+
+// Encoder writes the responses in an output format
+type Encoder interface {
+	Encode(r Record) error
+	// Flush writes any buffered data, it is called once all the records were encoded
+	Flush() error
+}
+
+// Format creates the encoder of an output
+type Format func(w io.Writer, f Fields) Encoder
+
+// Fields are the enrichment fields added to every response
+type Fields struct {
+	Line      bool
+	RequestID bool
+	Operation bool
+	Timestamp bool
+}
+
+// IsZero is true when no field is added
+func (f Fields) IsZero() bool {
+	return f == Fields{}
+}
+
+// ParseFields parses a list of enrichment fields such as "line,requestId,operation,timestamp"
+func ParseFields(s string) (Fields, error) {
+	f := Fields{}
+
+	if s == "" {
+		return f, nil
+	}
+
+	for _, field := range strings.Split(s, ",") {
+		switch strings.TrimSpace(field) {
+		case FieldLine:
+			f.Line = true
+		case FieldRequestID:
+			f.RequestID = true
+		case FieldOperation:
+			f.Operation = true
+		case FieldTimestamp:
+			f.Timestamp = true
+		default:
+			return f, fmt.Errorf("unknown output field %q, it must be %s, %s, %s or %s",
+				field, FieldLine, FieldRequestID, FieldOperation, FieldTimestamp)
+		}
+	}
+
+	return f, nil
+}
+
+// NewFormat returns the Format with the name received
+func NewFormat(name string) (Format, error) {
+	switch name {
+	case FormatNDJSON, "":
+		return NDJSON, nil
+	case FormatPretty:
+		return Pretty, nil
+	case FormatCSV:
+		return CSV, nil
+	case FormatTable:
+		return Table, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q, it must be %s, %s, %s or %s",
+			name, FormatNDJSON, FormatPretty, FormatCSV, FormatTable)
+	}
+}
+
+// columns are the values of the flat formats, csv and table
+func (f Fields) columns(r Record) (header, values []string) {
+	if f.Line {
+		header = append(header, FieldLine)
+		values = append(values, fmt.Sprint(r.Line))
+	}
+
+	if f.RequestID {
+		header = append(header, FieldRequestID)
+		values = append(values, r.RequestID)
+	}
+
+	if f.Operation {
+		header = append(header, FieldOperation)
+		values = append(values, r.Operation)
+	}
+
+	if f.Timestamp {
+		header = append(header, FieldTimestamp)
+		values = append(values, r.ProcessedAt.Format(time.RFC3339Nano))
+	}
+
+	header = append(header, "activeCard", "availableLimit", "violations", "ruleSetVersion")
+	values = append(values,
+		fmt.Sprint(r.Response.Account.ActiveCard),
+		fmt.Sprint(r.Response.Account.AvailableLimit),
+		strings.Join(r.Response.Violations, ";"),
+		r.Response.RuleSetVersion)
+
+	return header, values
+}
@@ -0,0 +1,86 @@
+package writer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"authorizer/internal/app/service"
+)
+
+type jsonEncoder struct {
+	w      io.Writer
+	fields Fields
+	indent bool
+}
+
+// enrichedResponse adds the enrichment fields to the keys of the response
+type enrichedResponse struct {
+	Line        int        `json:"line,omitempty"`
+	RequestID   string     `json:"requestId,omitempty"`
+	Operation   string     `json:"operation,omitempty"`
+	ProcessedAt *time.Time `json:"timestamp,omitempty"`
+	service.TransactionResponse
+}
+
+// NDJSON writes one compact json object per line, without enrichment fields a record that couldn't be executed
+// is written as its failure, e.g. unknown-command
+func NDJSON(w io.Writer, f Fields) Encoder {
+	return &jsonEncoder{w: w, fields: f}
+}
+
+// Pretty writes every response as indented json
+func Pretty(w io.Writer, f Fields) Encoder {
+	return &jsonEncoder{w: w, fields: f, indent: true}
+}
+
+func (e *jsonEncoder) Encode(r Record) error {
+	if r.Failure != "" && e.fields.IsZero() && !e.indent {
+		_, err := fmt.Fprintf(e.w, "%s\n", r.Failure)
+
+		return err
+	}
+
+	response := enrichedResponse{TransactionResponse: r.Response}
+
+	if e.fields.Line {
+		response.Line = r.Line
+	}
+
+	if e.fields.RequestID {
+		response.RequestID = r.RequestID
+	}
+
+	if e.fields.Operation {
+		response.Operation = r.Operation
+	}
+
+	if e.fields.Timestamp {
+		processedAt := r.ProcessedAt
+		response.ProcessedAt = &processedAt
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+
+	if e.indent {
+		b, err = json.MarshalIndent(response, "", "  ")
+	} else {
+		b, err = json.Marshal(response)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error marshaling response: %w", err)
+	}
+
+	_, err = fmt.Fprintf(e.w, "%s\n", b)
+
+	return err
+}
+
+func (e *jsonEncoder) Flush() error {
+	return nil
+}
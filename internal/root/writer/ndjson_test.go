@@ -0,0 +1,86 @@
+package writer
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/app/service"
+)
+
+func records() []Record {
+	return []Record{
+		{
+			Line:        1,
+			RequestID:   "r1",
+			Operation:   "transaction",
+			ProcessedAt: time.Date(2019, 2, 13, 10, 0, 0, 0, time.UTC),
+			Response: service.TransactionResponse{
+				Account:    model.Account{Id: 1, ActiveCard: true, AvailableLimit: 80},
+				Violations: []string{"insufficient-limit", "high-frequency-small-interval"},
+			},
+		},
+		{
+			Line:        2,
+			Operation:   "unknown-command",
+			ProcessedAt: time.Date(2019, 2, 13, 10, 0, 1, 0, time.UTC),
+			Response:    service.TransactionResponse{Violations: []string{"unknown-command"}},
+			Failure:     "unknown-command",
+		},
+	}
+}
+
+func encode(t *testing.T, format Format, f Fields) string {
+	out := bytes.Buffer{}
+	encoder := format(&out, f)
+
+	for _, r := range records() {
+		assert.NoError(t, encoder.Encode(r))
+	}
+
+	assert.NoError(t, encoder.Flush())
+
+	return out.String()
+}
+
+func TestNDJSON(t *testing.T) {
+	t.Run("without enrichment", func(t *testing.T) {
+		assert.Equal(t, "{\"account\":{\"activeCard\":true,\"availableLimit\":80},"+
+			"\"violations\":[\"insufficient-limit\",\"high-frequency-small-interval\"]}\n"+
+			"unknown-command\n", encode(t, NDJSON, Fields{}))
+	})
+
+	t.Run("with enrichment", func(t *testing.T) {
+		f, err := ParseFields("line,requestId,operation,timestamp")
+		assert.NoError(t, err)
+
+		assert.Equal(t, "{\"line\":1,\"requestId\":\"r1\",\"operation\":\"transaction\","+
+			"\"timestamp\":\"2019-02-13T10:00:00Z\",\"account\":{\"activeCard\":true,\"availableLimit\":80},"+
+			"\"violations\":[\"insufficient-limit\",\"high-frequency-small-interval\"]}\n"+
+			"{\"line\":2,\"operation\":\"unknown-command\",\"timestamp\":\"2019-02-13T10:00:01Z\","+
+			"\"account\":{\"activeCard\":false,\"availableLimit\":0},\"violations\":[\"unknown-command\"]}\n",
+			encode(t, NDJSON, f))
+	})
+}
+
+func TestPretty(t *testing.T) {
+	out := encode(t, Pretty, Fields{Line: true})
+
+	assert.Contains(t, out, "{\n  \"line\": 1,\n  \"account\": {\n    \"activeCard\": true,")
+	assert.Contains(t, out, "  \"violations\": [\n    \"unknown-command\"\n  ]\n}\n")
+}
+
+func TestParseFields(t *testing.T) {
+	f, err := ParseFields("line, operation")
+	assert.NoError(t, err)
+	assert.Equal(t, Fields{Line: true, Operation: true}, f)
+
+	_, err = ParseFields("line,merchant")
+	assert.Error(t, err)
+
+	_, err = NewFormat("xml")
+	assert.Error(t, err)
+}
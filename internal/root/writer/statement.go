@@ -0,0 +1,91 @@
+package writer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/app/service"
+)
+
+// Formats of the statements
+const (
+	StatementJSON = "json"
+	StatementCSV  = "csv"
+)
+
+// WriteStatements writes the statements as a json array or as csv. The csv has a row for the opening limit,
+// one per transaction with the limit after it, the totals of purchases, refunds and payments and the closing limit
+func WriteStatements(w io.Writer, statements []service.Statement, format string) error {
+	switch format {
+	case StatementJSON:
+		return json.NewEncoder(w).Encode(statements)
+	case StatementCSV:
+		return writeStatementsCSV(w, statements)
+	default:
+		return fmt.Errorf("unknown statement format %q, it must be %s or %s", format, StatementJSON, StatementCSV)
+	}
+}
+
+func writeStatementsCSV(w io.Writer, statements []service.Statement) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"accountId", "from", "to", "entry", "time", "merchant", "amount",
+		"availableLimit"}); err != nil {
+		return err
+	}
+
+	for _, st := range statements {
+		row := func(entry, at, merchant, amount string, limit int) error {
+			return cw.Write([]string{strconv.Itoa(st.AccountID), st.From.Format(time.RFC3339),
+				st.To.Format(time.RFC3339), entry, at, merchant, amount, strconv.Itoa(limit)})
+		}
+
+		if err := row("opening", "", "", "", st.OpeningLimit); err != nil {
+			return err
+		}
+
+		limit := st.OpeningLimit
+
+		for _, tx := range st.Transactions {
+			entry := "purchase"
+
+			switch {
+			case tx.Merchant == model.PaymentMerchant:
+				entry = "payment"
+			case tx.Amount < 0:
+				entry = "refund"
+			}
+
+			limit -= tx.Amount
+
+			err := row(entry, tx.Time.Format(time.RFC3339), tx.Merchant, strconv.Itoa(tx.Amount), limit)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := row("purchases", "", "", strconv.Itoa(st.Purchases), limit); err != nil {
+			return err
+		}
+
+		if err := row("refunds", "", "", strconv.Itoa(st.Refunds), limit); err != nil {
+			return err
+		}
+
+		if err := row("payments", "", "", strconv.Itoa(st.Payments), limit); err != nil {
+			return err
+		}
+
+		if err := row("closing", "", "", "", st.ClosingLimit); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
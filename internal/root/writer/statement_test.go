@@ -0,0 +1,53 @@
+package writer
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"authorizer/internal/app/model"
+	"authorizer/internal/app/service"
+)
+
+func TestWriteStatements(t *testing.T) {
+	from := time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC)
+	statements := []service.Statement{{
+		AccountID:    1,
+		From:         from,
+		To:           from.AddDate(0, 0, 1),
+		OpeningLimit: 100,
+		Transactions: []service.HistoryEntry{
+			{Transaction: model.Transaction{Merchant: "Oxxo", Amount: 30, Time: from.Add(time.Hour)},
+				Outcome: service.OutcomeApproved, Violations: []string{}},
+			{Transaction: model.Transaction{Merchant: "Oxxo", Amount: -10, Time: from.Add(2 * time.Hour)},
+				Outcome: service.OutcomeApproved, Violations: []string{}},
+			{Transaction: model.Transaction{Merchant: "payment", Amount: -20, Time: from.Add(3 * time.Hour)},
+				Outcome: service.OutcomeApproved, Violations: []string{}},
+		},
+		Purchases:    30,
+		Refunds:      10,
+		Payments:     20,
+		ClosingLimit: 100,
+	}}
+
+	out := new(bytes.Buffer)
+	assert.NoError(t, WriteStatements(out, statements, StatementCSV))
+	assert.Equal(t, "accountId,from,to,entry,time,merchant,amount,availableLimit\n"+
+		"1,2019-02-01T00:00:00Z,2019-02-02T00:00:00Z,opening,,,,100\n"+
+		"1,2019-02-01T00:00:00Z,2019-02-02T00:00:00Z,purchase,2019-02-01T01:00:00Z,Oxxo,30,70\n"+
+		"1,2019-02-01T00:00:00Z,2019-02-02T00:00:00Z,refund,2019-02-01T02:00:00Z,Oxxo,-10,80\n"+
+		"1,2019-02-01T00:00:00Z,2019-02-02T00:00:00Z,payment,2019-02-01T03:00:00Z,payment,-20,100\n"+
+		"1,2019-02-01T00:00:00Z,2019-02-02T00:00:00Z,purchases,,,30,100\n"+
+		"1,2019-02-01T00:00:00Z,2019-02-02T00:00:00Z,refunds,,,10,100\n"+
+		"1,2019-02-01T00:00:00Z,2019-02-02T00:00:00Z,payments,,,20,100\n"+
+		"1,2019-02-01T00:00:00Z,2019-02-02T00:00:00Z,closing,,,,100\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, WriteStatements(out, statements, StatementJSON))
+	assert.Contains(t, out.String(), `"openingLimit":100,"transactions":[{"merchant":"Oxxo","amount":30,`)
+	assert.Contains(t, out.String(), `"purchases":30,"refunds":10,"payments":20,"closingLimit":100}]`)
+
+	assert.Error(t, WriteStatements(out, statements, "pdf"))
+}
@@ -0,0 +1,40 @@
+package writer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+type tableEncoder struct {
+	w      *tabwriter.Writer
+	fields Fields
+	header bool
+}
+
+// Table writes the responses as a table aligned with spaces, the columns can only be aligned
+// once every row was received so nothing is written until Flush
+func Table(w io.Writer, f Fields) Encoder {
+	return &tableEncoder{w: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0), fields: f}
+}
+
+func (e *tableEncoder) Encode(r Record) error {
+	header, values := e.fields.columns(r)
+
+	if !e.header {
+		if _, err := fmt.Fprintln(e.w, strings.Join(header, "\t")); err != nil {
+			return err
+		}
+
+		e.header = true
+	}
+
+	_, err := fmt.Fprintln(e.w, strings.Join(values, "\t"))
+
+	return err
+}
+
+func (e *tableEncoder) Flush() error {
+	return e.w.Flush()
+}
@@ -0,0 +1,15 @@
+package writer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTable(t *testing.T) {
+	assert.Equal(t, ""+
+		"operation        activeCard  availableLimit  violations                                        ruleSetVersion\n"+
+		"transaction      true        80              insufficient-limit;high-frequency-small-interval  \n"+
+		"unknown-command  false       0               unknown-command                                   \n",
+		encode(t, Table, Fields{Operation: true}))
+}
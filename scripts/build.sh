@@ -12,6 +12,12 @@ fi
 
 export CGO_ENABLED=0
 
-echo "Go building app"
-go build -v -o build/$APPNAME cmd/$APPNAME/main.go
-echo "Successfully built, exiting build script"
\ No newline at end of file
+# the version, the commit and the build date are printed by "authorizer version"
+VERSION=${VERSION:-$(git describe --tags --always --dirty 2>/dev/null || echo dev)}
+COMMIT=${COMMIT:-$(git rev-parse --short HEAD 2>/dev/null || echo unknown)}
+DATE=${DATE:-$(date -u +%Y-%m-%dT%H:%M:%SZ)}
+LDFLAGS="-X main.version=$VERSION -X main.commit=$COMMIT -X main.date=$DATE"
+
+echo "Go building app $VERSION"
+go build -v -ldflags "$LDFLAGS" -o build/$APPNAME ./cmd/$APPNAME
+echo "Successfully built, exiting build script"
@@ -1,3 +1,7 @@
 #!/usr/bin/env bash
 
-docker build -t authorizer .
\ No newline at end of file
+docker build -t authorizer \
+    --build-arg VERSION=$(git describe --tags --always --dirty 2>/dev/null || echo dev) \
+    --build-arg COMMIT=$(git rev-parse --short HEAD 2>/dev/null || echo unknown) \
+    --build-arg DATE=$(date -u +%Y-%m-%dT%H:%M:%SZ) \
+    .